@@ -7,17 +7,23 @@ import (
 	"os"
 	"os/signal"
 	"q7o/config"
+	"q7o/internal/admin"
+	"q7o/internal/audit"
 	"q7o/internal/auth"
 	"q7o/internal/call"
 	"q7o/internal/common/database"
 	"q7o/internal/contact"
 	"q7o/internal/email"
+	"q7o/internal/export"
 	"q7o/internal/meeting"
 	"q7o/internal/push"
 	"q7o/internal/settings"
+	"q7o/internal/sms"
 	"q7o/internal/upload"
 	"q7o/internal/user"
+	"q7o/internal/webhook"
 	"q7o/pkg/logger"
+	"strings"
 	"syscall"
 	"time"
 
@@ -81,10 +87,50 @@ func main() {
 	contactRepo := contact.NewRepository(db)
 	settingsRepo := settings.NewRepository(db)
 	pushRepo := push.NewRepository(db)
+	auditRepo := audit.NewRepository(db)
 
 	// Initialize services
-	userService := user.NewService(userRepo, emailService, uploadService)
-	authService := auth.NewService(authRepo, userRepo, emailService, cfg.JWT)
+	auditService := audit.NewService(auditRepo)
+	userService := user.NewService(userRepo, emailService, uploadService, cfg.AccountDeletion)
+	userService.SetAuditLog(auditService)
+	// JWT signing keys
+	keyManager, err := auth.NewKeyManager(cfg.JWT)
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys: ", err)
+	}
+	go keyManager.RunRotation(context.Background())
+	authMiddleware := auth.NewMiddleware(keyManager, authRepo, cfg.EmailVerification)
+
+	authService := auth.NewService(authRepo, userRepo, emailService, keyManager, cfg)
+	userService.SetSessionRevoker(authService)
+	authService.SetAuditLog(auditService)
+	if err := authService.RestoreSuspensions(context.Background()); err != nil {
+		log.Error("Failed to restore account suspensions: ", err)
+	}
+
+	// Защита регистрации: одноразовые почтовые домены
+	if domains, err := auth.LoadDomainList(cfg.SignupProtection.DisposableDomainsFile); err != nil {
+		log.Error("Disposable email domain list not loaded: ", err)
+	} else {
+		authService.SetDisposableDomains(domains)
+	}
+
+	// Passkeys (WebAuthn)
+	webAuthn, err := auth.NewWebAuthn(cfg.WebAuthn)
+	if err != nil {
+		log.Fatal("Failed to configure WebAuthn: ", err)
+	}
+	authService.SetWebAuthn(webAuthn)
+
+	// SMS (подтверждение телефона и вход по коду)
+	smsSender, err := sms.NewSender(cfg.SMS)
+	if err != nil {
+		log.Fatal("Failed to configure SMS sender: ", err)
+	}
+	authService.SetSMSSender(smsSender)
+	userService.SetPhoneVerifier(authService)
+	go userService.RunDeletionPurge(context.Background())
+
 	meetingService := meeting.NewService(meetingRepo, userRepo, cfg.LiveKit, redis)
 	settingsService := settings.NewService(settingsRepo)
 	pushService := push.NewService(pushRepo, cfg.Push)
@@ -93,10 +139,20 @@ func main() {
 	contactService := contact.NewService(contactRepo, userRepo, wsHub)
 
 	// Call service с contact service и push service
-	callService := call.NewService(callRepo, userRepo, cfg.LiveKit, cfg.JWT, redis, wsHub)
+	callService := call.NewService(callRepo, userRepo, cfg.LiveKit, authMiddleware, redis, wsHub)
 	// 🔥 КРИТИЧЕСКИ ВАЖНО: Устанавливаем зависимости в callService ПЕРЕД созданием handlers
 	callService.SetContactService(contactService)
 	callService.SetPushService(pushService)
+	go callService.RunTimeouts(context.Background())
+
+	// Выгрузка персональных данных
+	exportService := export.NewService(
+		userRepo, contactRepo, callRepo, meetingRepo, pushRepo, settingsRepo, authRepo,
+		redis, keyManager, emailService, cfg, uploadConfig.UploadPath,
+	)
+	go exportService.Run(context.Background())
+
+	adminService := admin.NewService(userRepo, authService, pushRepo, callRepo, meetingRepo, wsHub, auditService)
 
 	// Start cleanup goroutine for expired meetings
 	go meetingService.CleanupExpiredMeetings(context.Background())
@@ -113,12 +169,16 @@ func main() {
 	app.Use(helmet.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-PoW-Solution",
 		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS",
 	}))
 	app.Use(limiter.New(limiter.Config{
 		Max:        60,
 		Expiration: 1 * time.Minute,
+		// Вебхуки LiveKit приходят с одного адреса и подписаны — лимит на IP к ним не применяем
+		Next: func(c *fiber.Ctx) bool {
+			return strings.HasPrefix(c.Path(), "/webhooks/")
+		},
 	}))
 
 	// WebSocket upgrade middleware
@@ -136,37 +196,103 @@ func main() {
 	// Auth routes
 	authHandler := auth.NewHandler(authService)
 	authGroup := api.Group("/auth")
+	authGroup.Post("/challenge", authHandler.IssuePoWChallenge)
 	authGroup.Post("/register", authHandler.Register)
 	authGroup.Post("/login", authHandler.Login)
+	authGroup.Post("/login/email", authHandler.RequestEmailLogin)
+	authGroup.Get("/login/email/verify", authHandler.ShowEmailLogin)
+	authGroup.Post("/login/email/verify", authHandler.VerifyEmailLogin)
+	authGroup.Post("/login/phone", authHandler.RequestPhoneLogin)
+	authGroup.Post("/login/phone/verify", authHandler.VerifyPhoneLogin)
+	authGroup.Post("/phone/verify", authMiddleware.RequireAuth, authHandler.VerifyPhone)
+	authGroup.Post("/phone/resend", authMiddleware.RequireAuth, authHandler.ResendPhoneVerification)
+	authGroup.Post("/email/change", authMiddleware.RequireAuth, authHandler.RequestEmailChange)
+	authGroup.Post("/email/change/confirm", authMiddleware.RequireAuth, authHandler.ConfirmEmailChange)
+	authGroup.Get("/email/change/cancel", authHandler.ShowEmailChangeCancel)
+	authGroup.Post("/email/change/cancel", authHandler.CancelEmailChange)
 	authGroup.Post("/refresh", authHandler.RefreshToken)
 	authGroup.Post("/verify-email", authHandler.VerifyEmail)
 	authGroup.Post("/resend-verification", authHandler.ResendVerification)
-	authGroup.Post("/logout", auth.RequireAuth(cfg.JWT), authHandler.Logout)
-	authGroup.Post("/validate", auth.RequireAuth(cfg.JWT), authHandler.ValidateToken)
+	authGroup.Post("/forgot-password", authHandler.ForgotPassword)
+	authGroup.Post("/reset-password", authHandler.ResetPassword)
+	authGroup.Get("/unlock", authHandler.UnlockAccount)
+	authGroup.Post("/unlock", authHandler.UnlockAccount)
+	authGroup.Post("/logout", authMiddleware.RequireAuth, authHandler.Logout)
+	authGroup.Post("/validate", authMiddleware.RequireAuth, authHandler.ValidateToken)
+	authGroup.Get("/sessions", authMiddleware.RequireAuth, authHandler.GetSessions)
+	authGroup.Delete("/sessions/others", authMiddleware.RequireAuth, authHandler.RevokeOtherSessions)
+	authGroup.Delete("/sessions/:id", authMiddleware.RequireAuth, authHandler.RevokeSession)
+
+	// Персональные API ключи (принимаются RequireAuth вместо JWT на маршрутах из apiKeyRoutes)
+	authGroup.Post("/api-keys", authMiddleware.RequireAuth, authHandler.CreateAPIKey)
+	authGroup.Get("/api-keys", authMiddleware.RequireAuth, authHandler.ListAPIKeys)
+	authGroup.Delete("/api-keys/:id", authMiddleware.RequireAuth, authHandler.RevokeAPIKey)
+
 	authGroup.Get("/check-username", authHandler.CheckUsername)
 	authGroup.Post("/check-username", authHandler.CheckUsername)
 	authGroup.Post("/suggest-usernames", authHandler.SuggestUsernames)
 
+	// Two-factor authentication
+	authGroup.Post("/mfa/verify", authHandler.VerifyMFA)
+	authGroup.Get("/mfa", authMiddleware.RequireAuth, authHandler.GetMFAStatus)
+	authGroup.Post("/mfa/setup", authMiddleware.RequireAuth, authHandler.SetupMFA)
+	authGroup.Post("/mfa/enable", authMiddleware.RequireAuth, authHandler.EnableMFA)
+	authGroup.Post("/mfa/disable", authMiddleware.RequireAuth, authHandler.DisableMFA)
+	authGroup.Post("/mfa/recovery-codes", authMiddleware.RequireAuth, authHandler.RegenerateRecoveryCodes)
+
+	// Passkeys
+	authGroup.Post("/passkeys/login/begin", authHandler.BeginPasskeyLogin)
+	authGroup.Post("/passkeys/login/finish", authHandler.FinishPasskeyLogin)
+	authGroup.Post("/passkeys/register/begin", authMiddleware.RequireAuth, authHandler.BeginPasskeyRegistration)
+	authGroup.Post("/passkeys/register/finish", authMiddleware.RequireAuth, authHandler.FinishPasskeyRegistration)
+	authGroup.Get("/passkeys", authMiddleware.RequireAuth, authHandler.ListPasskeys)
+	authGroup.Delete("/passkeys/:id", authMiddleware.RequireAuth, authHandler.DeletePasskey)
+
+	// OpenID Connect (вход через внешних провайдеров)
+	authGroup.Get("/oidc/providers", authHandler.OIDCProviders)
+	authGroup.Post("/oidc/:provider/authorize", authHandler.BeginOIDCLogin)
+	authGroup.Get("/oidc/:provider/callback", authHandler.OIDCCallback)
+	authGroup.Post("/oidc/:provider/callback", authHandler.OIDCCallback)
+	authGroup.Get("/identities", authMiddleware.RequireAuth, authHandler.ListIdentities)
+	authGroup.Delete("/identities/:provider", authMiddleware.RequireAuth, authHandler.UnlinkIdentity)
+
 	// User routes - ПЕРЕДАЕМ contactService
 	userHandler := user.NewHandler(userService, contactService)
-	userGroup := api.Group("/users", auth.RequireAuth(cfg.JWT))
+	userGroup := api.Group("/users", authMiddleware.RequireAuth)
 	userGroup.Get("/me", userHandler.GetMe)
 	userGroup.Put("/me", userHandler.UpdateProfile)
 	userGroup.Post("/me/avatar", userHandler.UploadAvatar)
 	userGroup.Delete("/me/avatar", userHandler.DeleteAvatar)
 	userGroup.Put("/me/password", userHandler.ChangePassword)
+	userGroup.Delete("/me", userHandler.DeleteAccount)
+
 	userGroup.Get("/search", userHandler.SearchUsers)
 	userGroup.Get("/:id", userHandler.GetUser)
 
+	// Выгрузка персональных данных; ссылка на скачивание подписана и приходит в письме
+	exportHandler := export.NewHandler(exportService)
+	userGroup.Post("/me/export", exportHandler.RequestExport)
+	userGroup.Get("/me/export", exportHandler.GetExportStatus)
+	api.Get("/exports/download", exportHandler.Download)
+
+	// Журнал безопасности: своя активность и полный журнал для администраторов
+	auditHandler := audit.NewHandler(auditService)
+	userGroup.Get("/me/activity", auditHandler.GetMyActivity)
+
 	// 🚀 КРИТИЧЕСКИ ВАЖНО: Call handler создается ПОСЛЕ установки всех зависимостей
 	callHandler := call.NewHandler(callService, wsHub)
-	callGroup := api.Group("/calls", auth.RequireAuth(cfg.JWT))
+	callGroup := api.Group("/calls", authMiddleware.RequireAuth)
 	callGroup.Post("/token", callHandler.GetCallToken)
 	callGroup.Post("/initiate", callHandler.InitiateCall)
 	callGroup.Post("/answer", callHandler.AnswerCall)
 	callGroup.Post("/reject", callHandler.RejectCall)
 	callGroup.Post("/end", callHandler.EndCall)
 	callGroup.Get("/history", callHandler.GetCallHistory)
+	callGroup.Post("/invite", callHandler.InviteParticipants)
+	callGroup.Get("/:id/participants", callHandler.GetParticipants)
+	callGroup.Get("/forwarding", callHandler.GetForwardingRules)
+	callGroup.Put("/forwarding", callHandler.SetForwardingRule)
+	callGroup.Delete("/forwarding/:condition", callHandler.DeleteForwardingRule)
 
 	// Meeting routes
 	meetingHandler := meeting.NewHandler(meetingService)
@@ -177,7 +303,7 @@ func main() {
 	meetingGroup.Post("/join", meetingHandler.JoinMeeting)
 
 	// Authenticated endpoints
-	meetingAuthGroup := meetingGroup.Group("", auth.RequireAuth(cfg.JWT))
+	meetingAuthGroup := meetingGroup.Group("", authMiddleware.RequireAuth)
 	meetingAuthGroup.Post("/create", meetingHandler.CreateMeeting)
 	meetingAuthGroup.Post("/join-auth", meetingHandler.JoinMeetingAuth)
 	meetingAuthGroup.Post("/:id/leave", meetingHandler.LeaveMeeting)
@@ -188,7 +314,7 @@ func main() {
 
 	// Contact routes - ВСЕ ЭНДПОИНТЫ КОТОРЫЕ НУЖНЫ ФРОНТЕНДУ
 	contactHandler := contact.NewHandler(contactService)
-	contactGroup := api.Group("/contacts", auth.RequireAuth(cfg.JWT))
+	contactGroup := api.Group("/contacts", authMiddleware.RequireAuth)
 
 	// Эти эндпоинты нужны фронтенду для ContactsScreen
 	contactGroup.Get("/", contactHandler.GetContacts)                // GET /api/v1/contacts
@@ -203,17 +329,34 @@ func main() {
 
 	// Settings routes
 	settingsHandler := settings.NewHandler(settingsService)
-	settingsGroup := api.Group("/settings", auth.RequireAuth(cfg.JWT))
+	settingsGroup := api.Group("/settings", authMiddleware.RequireAuth)
 	settingsGroup.Get("/", settingsHandler.GetSettings)
 	settingsGroup.Put("/", settingsHandler.UpdateSettings)
 	settingsGroup.Delete("/", settingsHandler.DeleteSettings)
 
 	// Push notification routes
 	pushHandler := push.NewHandler(pushService)
-	pushGroup := api.Group("/push", auth.RequireAuth(cfg.JWT))
+	pushGroup := api.Group("/push", authMiddleware.RequireAuth)
 	pushGroup.Post("/register", pushHandler.RegisterToken)
 	pushGroup.Post("/deactivate", pushHandler.DeactivateToken)
 
+	// Admin routes (поддержка пользователей)
+	adminHandler := admin.NewHandler(adminService)
+	adminGroup := api.Group("/admin", authMiddleware.RequireAuth, authMiddleware.RequirePermission(auth.PermissionManageUsers))
+	adminGroup.Get("/users", adminHandler.SearchUsers)
+	adminGroup.Get("/users/:id", adminHandler.GetUser)
+	adminGroup.Get("/users/:id/sessions", adminHandler.GetSessions)
+	adminGroup.Get("/users/:id/devices", adminHandler.GetDevices)
+	adminGroup.Get("/users/:id/calls", adminHandler.GetCalls)
+	adminGroup.Get("/users/:id/meetings", adminHandler.GetMeetings)
+	adminGroup.Post("/users/:id/verify-email", adminHandler.VerifyEmail)
+	adminGroup.Post("/users/:id/reset-password", adminHandler.ResetPassword)
+	adminGroup.Post("/users/:id/suspend", adminHandler.Suspend)
+	adminGroup.Post("/users/:id/unsuspend", adminHandler.Unsuspend)
+	adminGroup.Post("/users/:id/revoke-sessions", adminHandler.RevokeSessions)
+	adminGroup.Put("/users/:id/role", adminHandler.SetRole)
+	adminGroup.Get("/audit-events", auditHandler.ListEvents)
+
 	// Static files для аватаров
 	app.Static("/uploads", "./uploads")
 
@@ -222,6 +365,13 @@ func main() {
 		callHandler.HandleWebSocket(c, wsHub)
 	}))
 
+	// LiveKit webhooks: сверка звонков и встреч с реальным состоянием комнат
+	webhookHandler := webhook.NewHandler(webhook.NewService(callService, meetingRepo), cfg.LiveKit)
+	app.Post("/webhooks/livekit", webhookHandler.LiveKit)
+
+	// Public keys for verifying our JWTs
+	app.Get("/.well-known/jwks.json", authHandler.JWKS)
+
 	// Health check
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "ok"})
@@ -3,17 +3,31 @@ package config
 import (
 	"github.com/joho/godotenv"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	AppEnv   string
 	AppPort  string
+	AppURL   string // публичный адрес API для ссылок в письмах
 	Database DatabaseConfig
 	Redis    RedisConfig
 	JWT      JWTConfig
 	LiveKit  LiveKitConfig
 	SMTP     SMTPConfig
 	Push     PushConfig
+	WebAuthn WebAuthnConfig
+	Security SecurityConfig
+
+	EmailVerification EmailVerificationConfig
+	OIDC              []OIDCProviderConfig
+	SMS               SMSConfig
+	AccountDeletion   AccountDeletionConfig
+	Export            ExportConfig
+	SignupProtection  SignupProtectionConfig
+	EmailLoginAppURL  string // deep link приложения, который открывает страница из письма со ссылкой входа
 }
 
 type DatabaseConfig struct {
@@ -32,10 +46,18 @@ type RedisConfig struct {
 }
 
 type JWTConfig struct {
+	// Secret и RefreshSecret — устаревшие HS256 ключи; если заданы,
+	// ранее выданные токены принимаются до LegacyAcceptUntil (см. auth.ParseToken)
 	Secret        string
 	RefreshSecret string
 	ExpireHours   int
 	RefreshDays   int
+	Algorithm     string // RS256 или EdDSA
+	KeysDir       string // каталог с PEM ключами подписи, имя файла — kid
+	RotationDays  int
+
+	// Дата отключения HS256 токенов; нулевое значение — не принимаются вовсе
+	LegacyAcceptUntil time.Time
 }
 
 type LiveKitConfig struct {
@@ -63,12 +85,85 @@ type PushConfig struct {
 	APNsSandbox             bool
 }
 
+// WebAuthnConfig — параметры Relying Party для passkeys
+type WebAuthnConfig struct {
+	RPID          string
+	RPDisplayName string
+	RPOrigins     []string
+}
+
+// SecurityConfig — защита от подбора паролей и кодов
+type SecurityConfig struct {
+	LoginFreeAttempts      int // неудачных попыток без задержки
+	LoginMaxFailures       int // после стольких неудач аккаунт блокируется
+	LoginMaxIPFailures     int // лимит неудач с одного IP за окно
+	FailureWindowMinutes   int
+	LockoutMinutes         int
+	BackoffMaxSeconds      int
+	VerifyEmailMaxAttempts int
+}
+
+// EmailVerificationConfig — ограничение доступа для аккаунтов с неподтвержденным email
+type EmailVerificationConfig struct {
+	Required         bool
+	GracePeriodHours int      // сколько часов после регистрации доступ не ограничивается
+	AllowedPaths     []string // маршруты, доступные без подтверждения; "/*" в конце — префикс
+}
+
+// OIDCProviderConfig — внешний провайдер OpenID Connect для входа.
+// Провайдеры перечисляются в OIDC_PROVIDERS, параметры читаются из OIDC_<NAME>_*.
+type OIDCProviderConfig struct {
+	Name         string
+	DisplayName  string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// SMSConfig — провайдер отправки SMS: log (по умолчанию) или file
+type SMSConfig struct {
+	Provider string
+	FilePath string
+}
+
+// AccountDeletionConfig — удаление аккаунта: в течение GraceDays его можно отменить входом
+type AccountDeletionConfig struct {
+	GraceDays            int
+	PurgeIntervalMinutes int
+}
+
+// ExportConfig — выгрузка персональных данных пользователя
+type ExportConfig struct {
+	Dir           string // каталог для готовых архивов
+	LinkTTLHours  int    // срок действия ссылки на скачивание; после него архив удаляется
+	CooldownHours int    // как часто пользователь может запрашивать выгрузку
+}
+
+// SignupProtectionConfig — защита публичных эндпоинтов регистрации от перебора и спама
+type SignupProtectionConfig struct {
+	PoWEnabled             bool
+	PoWBaseDifficulty      int    // число нулевых бит в начале SHA-256 решения
+	PoWMaxDifficulty       int    // потолок сложности при росте числа запросов с IP
+	PoWChallengeTTLSeconds int    // сколько живет выданный челлендж
+	PoWIPFreeChallenges    int    // челленджей с одного IP за окно до повышения сложности
+	PoWIPWindowMinutes     int    // окно подсчета челленджей по IP
+	UsernameChecksPerPoW   int    // сколько проверок username допускает одно решение
+	DisposableDomainsFile  string // список одноразовых почтовых доменов, по одному в строке
+}
+
 func Load() *Config {
 	_ = godotenv.Load()
 
+	appURL := strings.TrimRight(getEnv("APP_URL", "http://localhost:8080"), "/")
+
 	return &Config{
 		AppEnv:  getEnv("APP_ENV", "development"),
 		AppPort: getEnv("APP_PORT", "8080"),
+		AppURL:  appURL,
+
+		EmailLoginAppURL: getEnv("EMAIL_LOGIN_APP_URL", "q7o://login/email"),
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
@@ -83,10 +178,15 @@ func Load() *Config {
 			DB:       0,
 		},
 		JWT: JWTConfig{
-			Secret:        getEnv("JWT_SECRET", "secret"),
-			RefreshSecret: getEnv("JWT_REFRESH_SECRET", "refresh_secret"),
+			Secret:        getEnv("JWT_SECRET", ""),
+			RefreshSecret: getEnv("JWT_REFRESH_SECRET", ""),
 			ExpireHours:   1,
 			RefreshDays:   90,
+			Algorithm:     getEnv("JWT_ALGORITHM", "EdDSA"),
+			KeysDir:       getEnv("JWT_KEYS_DIR", "./keys/jwt"),
+			RotationDays:  getEnvInt("JWT_KEY_ROTATION_DAYS", 30),
+
+			LegacyAcceptUntil: getEnvDate("JWT_LEGACY_ACCEPT_UNTIL"),
 		},
 		LiveKit: LiveKitConfig{
 			Host:       getEnv("LIVEKIT_HOST", "localhost:7880"),
@@ -110,12 +210,102 @@ func Load() *Config {
 			APNsVoIPBundleID:        getEnv("APNS_VOIP_BUNDLE_ID", "com.q7o.app.voip"),
 			APNsSandbox:             getEnv("APNS_SANDBOX", "true") == "true",
 		},
+		WebAuthn: WebAuthnConfig{
+			RPID:          getEnv("WEBAUTHN_RP_ID", "localhost"),
+			RPDisplayName: getEnv("WEBAUTHN_RP_DISPLAY_NAME", "Q7O"),
+			RPOrigins:     getEnvList("WEBAUTHN_RP_ORIGINS", "http://localhost:8080"),
+		},
+		Security: SecurityConfig{
+			LoginFreeAttempts:      getEnvInt("LOGIN_FREE_ATTEMPTS", 3),
+			LoginMaxFailures:       getEnvInt("LOGIN_MAX_FAILURES", 10),
+			LoginMaxIPFailures:     getEnvInt("LOGIN_MAX_IP_FAILURES", 50),
+			FailureWindowMinutes:   getEnvInt("LOGIN_FAILURE_WINDOW_MINUTES", 15),
+			LockoutMinutes:         getEnvInt("LOGIN_LOCKOUT_MINUTES", 30),
+			BackoffMaxSeconds:      getEnvInt("LOGIN_BACKOFF_MAX_SECONDS", 60),
+			VerifyEmailMaxAttempts: getEnvInt("VERIFY_EMAIL_MAX_ATTEMPTS", 5),
+		},
+		EmailVerification: EmailVerificationConfig{
+			Required:         getEnv("EMAIL_VERIFICATION_REQUIRED", "true") == "true",
+			GracePeriodHours: getEnvInt("EMAIL_VERIFICATION_GRACE_HOURS", 24),
+			AllowedPaths: getEnvList("EMAIL_VERIFICATION_ALLOWED_PATHS",
+				"/api/v1/auth/*,/api/v1/users/me,/api/v1/users/me/*,/api/v1/settings/*,/api/v1/push/*"),
+		},
+		OIDC: loadOIDCProviders(appURL),
+		SMS: SMSConfig{
+			Provider: getEnv("SMS_PROVIDER", "log"),
+			FilePath: getEnv("SMS_FILE_PATH", "./tmp/sms.log"),
+		},
+		AccountDeletion: AccountDeletionConfig{
+			GraceDays:            getEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 30),
+			PurgeIntervalMinutes: getEnvInt("ACCOUNT_DELETION_PURGE_INTERVAL_MINUTES", 60),
+		},
+		Export: ExportConfig{
+			Dir:           getEnv("EXPORT_DIR", "./exports"),
+			LinkTTLHours:  getEnvInt("EXPORT_LINK_TTL_HOURS", 48),
+			CooldownHours: getEnvInt("EXPORT_COOLDOWN_HOURS", 24),
+		},
+		SignupProtection: SignupProtectionConfig{
+			PoWEnabled:             getEnv("SIGNUP_POW_ENABLED", "true") == "true",
+			PoWBaseDifficulty:      getEnvInt("SIGNUP_POW_BASE_DIFFICULTY", 18),
+			PoWMaxDifficulty:       getEnvInt("SIGNUP_POW_MAX_DIFFICULTY", 24),
+			PoWChallengeTTLSeconds: getEnvInt("SIGNUP_POW_CHALLENGE_TTL_SECONDS", 300),
+			PoWIPFreeChallenges:    getEnvInt("SIGNUP_POW_IP_FREE_CHALLENGES", 10),
+			PoWIPWindowMinutes:     getEnvInt("SIGNUP_POW_IP_WINDOW_MINUTES", 60),
+			UsernameChecksPerPoW:   getEnvInt("SIGNUP_USERNAME_CHECKS_PER_POW", 30),
+			DisposableDomainsFile:  getEnv("DISPOSABLE_EMAIL_DOMAINS_FILE", "./config/disposable_email_domains.txt"),
+		},
 	}
 }
 
+func loadOIDCProviders(appURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvList("OIDC_PROVIDERS", "") {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			DisplayName:  getEnv(prefix+"DISPLAY_NAME", name),
+			IssuerURL:    getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", appURL+"/api/v1/auth/oidc/"+name+"/callback"),
+			Scopes:       getEnvList(prefix+"SCOPES", "openid,email,profile"),
+		})
+	}
+	return providers
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvDate читает дату в формате YYYY-MM-DD (UTC); пустое или неверное значение — нулевое время
+func getEnvDate(key string) time.Time {
+	date, err := time.Parse("2006-01-02", os.Getenv(key))
+	if err != nil {
+		return time.Time{}
+	}
+	return date
+}
+
+// getEnvList читает список значений, разделенных запятыми
+func getEnvList(key, defaultValue string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,246 @@
+package admin
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"q7o/internal/common/response"
+	"q7o/internal/common/validator"
+	"q7o/internal/user"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// SearchUsers ищет пользователей по строке и фильтрам
+// GET /api/v1/admin/users?q=&role=&state=&email_verified=&limit=&offset=
+func (h *Handler) SearchUsers(c *fiber.Ctx) error {
+	var filter user.UserFilter
+	if err := c.QueryParser(&filter); err != nil {
+		return response.BadRequest(c, "Invalid query parameters")
+	}
+
+	if err := validator.ValidateStruct(filter); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	result, err := h.service.SearchUsers(c.Context(), &filter)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, result)
+}
+
+// GET /api/v1/admin/users/:id
+func (h *Handler) GetUser(c *fiber.Ctx) error {
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	u, err := h.service.GetUser(c.Context(), uid)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, u)
+}
+
+// GET /api/v1/admin/users/:id/sessions
+func (h *Handler) GetSessions(c *fiber.Ctx) error {
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	sessions, err := h.service.GetSessions(c.Context(), uid)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, sessions)
+}
+
+// GET /api/v1/admin/users/:id/devices
+func (h *Handler) GetDevices(c *fiber.Ctx) error {
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	devices, err := h.service.GetDevices(c.Context(), uid)
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, devices)
+}
+
+// GET /api/v1/admin/users/:id/calls?limit=&offset=
+func (h *Handler) GetCalls(c *fiber.Ctx) error {
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	calls, err := h.service.GetCalls(c.Context(), uid, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, calls)
+}
+
+// GET /api/v1/admin/users/:id/meetings?limit=&offset=
+func (h *Handler) GetMeetings(c *fiber.Ctx) error {
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	meetings, err := h.service.GetMeetings(c.Context(), uid, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, meetings)
+}
+
+// POST /api/v1/admin/users/:id/verify-email
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	adminID, _ := uuid.Parse(c.Locals("userID").(string))
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	if err := h.service.VerifyEmail(c.Context(), adminID, uid); err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Email verified",
+	})
+}
+
+// POST /api/v1/admin/users/:id/reset-password
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	adminID, _ := uuid.Parse(c.Locals("userID").(string))
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	if err := h.service.ResetPassword(c.Context(), adminID, uid); err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Password reset, the user was sent a code to set a new one",
+	})
+}
+
+// POST /api/v1/admin/users/:id/suspend
+func (h *Handler) Suspend(c *fiber.Ctx) error {
+	adminID, _ := uuid.Parse(c.Locals("userID").(string))
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	var req SuspendRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return response.BadRequest(c, "Invalid request body")
+		}
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.Suspend(c.Context(), adminID, uid, req.Reason); err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Account suspended",
+	})
+}
+
+// POST /api/v1/admin/users/:id/unsuspend
+func (h *Handler) Unsuspend(c *fiber.Ctx) error {
+	adminID, _ := uuid.Parse(c.Locals("userID").(string))
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	if err := h.service.Unsuspend(c.Context(), adminID, uid); err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Account unsuspended",
+	})
+}
+
+// POST /api/v1/admin/users/:id/revoke-sessions
+func (h *Handler) RevokeSessions(c *fiber.Ctx) error {
+	adminID, _ := uuid.Parse(c.Locals("userID").(string))
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	if err := h.service.RevokeSessions(c.Context(), adminID, uid); err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "All sessions revoked",
+	})
+}
+
+// PUT /api/v1/admin/users/:id/role
+func (h *Handler) SetRole(c *fiber.Ctx) error {
+	adminID, _ := uuid.Parse(c.Locals("userID").(string))
+	uid, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	var req SetRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.SetRole(c.Context(), adminID, uid, req.Role); err != nil {
+		return adminError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Role updated",
+	})
+}
+
+func adminError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "user not found":
+		return response.Error(c, fiber.StatusNotFound, "User not found")
+	case "account already suspended", "account not suspended", "email already verified":
+		return response.Conflict(c, err.Error())
+	case "cannot suspend yourself", "cannot change your own role", "invalid role":
+		return response.BadRequest(c, err.Error())
+	}
+	return response.InternalError(c, err)
+}
@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/user"
+)
+
+// UserResponse — пользователь глазами поддержки: вместе со служебными полями
+type UserResponse struct {
+	ID                  uuid.UUID  `json:"id"`
+	Username            string     `json:"username"`
+	FirstName           string     `json:"first_name"`
+	LastName            string     `json:"last_name"`
+	Email               string     `json:"email"`
+	EmailVerified       bool       `json:"email_verified"`
+	Phone               *string    `json:"phone"`
+	PhoneVerified       bool       `json:"phone_verified"`
+	AvatarURL           *string    `json:"avatar_url"`
+	Status              string     `json:"status"`
+	Role                string     `json:"role"`
+	AccountState        string     `json:"account_state"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	SuspendedAt         *time.Time `json:"suspended_at,omitempty"`
+	SuspensionReason    *string    `json:"suspension_reason,omitempty"`
+	LastSeen            time.Time  `json:"last_seen"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+type UserListResponse struct {
+	Users  []*UserResponse `json:"users"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+type SuspendRequest struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+func toUserResponse(u *user.User) *UserResponse {
+	return &UserResponse{
+		ID:                  u.ID,
+		Username:            u.Username,
+		FirstName:           u.FirstName,
+		LastName:            u.LastName,
+		Email:               u.Email,
+		EmailVerified:       u.EmailVerified,
+		Phone:               u.Phone,
+		PhoneVerified:       u.PhoneVerified,
+		AvatarURL:           u.AvatarURL,
+		Status:              u.Status,
+		Role:                u.Role,
+		AccountState:        u.AccountState,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+		SuspendedAt:         u.SuspendedAt,
+		SuspensionReason:    u.SuspensionReason,
+		LastSeen:            u.LastSeen,
+		CreatedAt:           u.CreatedAt,
+		UpdatedAt:           u.UpdatedAt,
+	}
+}
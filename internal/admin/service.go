@@ -0,0 +1,228 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"q7o/internal/audit"
+	"q7o/internal/auth"
+	"q7o/internal/call"
+	"q7o/internal/meeting"
+	"q7o/internal/push"
+	"q7o/internal/user"
+)
+
+// Service — операции поддержки над аккаунтами пользователей
+type Service struct {
+	userRepo    *user.Repository
+	authService *auth.Service
+	pushRepo    *push.Repository
+	callRepo    *call.Repository
+	meetingRepo *meeting.Repository
+	wsHub       *call.WSHub
+	auditLog    *audit.Service
+}
+
+func NewService(
+	userRepo *user.Repository,
+	authService *auth.Service,
+	pushRepo *push.Repository,
+	callRepo *call.Repository,
+	meetingRepo *meeting.Repository,
+	wsHub *call.WSHub,
+	auditLog *audit.Service,
+) *Service {
+	return &Service{
+		userRepo:    userRepo,
+		authService: authService,
+		pushRepo:    pushRepo,
+		callRepo:    callRepo,
+		meetingRepo: meetingRepo,
+		wsHub:       wsHub,
+		auditLog:    auditLog,
+	}
+}
+
+func (s *Service) SearchUsers(ctx context.Context, filter *user.UserFilter) (*UserListResponse, error) {
+	if filter.Limit == 0 {
+		filter.Limit = 20
+	}
+
+	users, total, err := s.userRepo.AdminSearch(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &UserListResponse{
+		Users:  make([]*UserResponse, 0, len(users)),
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	for _, u := range users {
+		result.Users = append(result.Users, toUserResponse(u))
+	}
+	return result, nil
+}
+
+func (s *Service) GetUser(ctx context.Context, userID uuid.UUID) (*UserResponse, error) {
+	u, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return toUserResponse(u), nil
+}
+
+func (s *Service) findUser(ctx context.Context, userID uuid.UUID) (*user.User, error) {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user not found")
+	}
+	return u, err
+}
+
+func (s *Service) GetSessions(ctx context.Context, userID uuid.UUID) ([]*auth.Session, error) {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.authService.GetSessions(ctx, userID, uuid.Nil)
+}
+
+// GetDevices возвращает активные push токены; сами токены маскируются
+func (s *Service) GetDevices(ctx context.Context, userID uuid.UUID) ([]*push.DeviceToken, error) {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	devices, err := s.pushRepo.GetActiveTokensForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []*push.DeviceToken{}
+	}
+	for _, device := range devices {
+		device.Token = push.MaskToken(device.Token)
+	}
+	return devices, nil
+}
+
+func (s *Service) GetCalls(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*call.Call, error) {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	calls, err := s.callRepo.GetUserCalls(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if calls == nil {
+		calls = []*call.Call{}
+	}
+	return calls, nil
+}
+
+func (s *Service) GetMeetings(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*meeting.Meeting, error) {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	meetings, err := s.meetingRepo.GetUserMeetings(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if meetings == nil {
+		meetings = []*meeting.Meeting{}
+	}
+	return meetings, nil
+}
+
+// VerifyEmail подтверждает email без кода — например, когда письма не доходят
+func (s *Service) VerifyEmail(ctx context.Context, adminID, userID uuid.UUID) error {
+	u, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.EmailVerified {
+		return errors.New("email already verified")
+	}
+
+	if err := s.userRepo.VerifyEmail(ctx, userID); err != nil {
+		return err
+	}
+
+	s.auditLog.RecordAdmin(ctx, adminID, userID, audit.EventAdminVerifyEmail, nil)
+	return nil
+}
+
+// ResetPassword сбрасывает пароль и отправляет пользователю код для установки нового
+func (s *Service) ResetPassword(ctx context.Context, adminID, userID uuid.UUID) error {
+	if err := s.authService.AdminResetPassword(ctx, userID); err != nil {
+		return err
+	}
+
+	s.auditLog.RecordAdmin(ctx, adminID, userID, audit.EventAdminResetPassword, nil)
+	return nil
+}
+
+// Suspend блокирует аккаунт и закрывает WebSocket соединение пользователя
+func (s *Service) Suspend(ctx context.Context, adminID, userID uuid.UUID, reason string) error {
+	if adminID == userID {
+		return errors.New("cannot suspend yourself")
+	}
+
+	if err := s.authService.SuspendAccount(ctx, userID, reason); err != nil {
+		return err
+	}
+	s.wsHub.Disconnect(userID)
+
+	s.auditLog.RecordAdmin(ctx, adminID, userID, audit.EventAdminSuspend, map[string]interface{}{
+		"reason": reason,
+	})
+	return nil
+}
+
+func (s *Service) Unsuspend(ctx context.Context, adminID, userID uuid.UUID) error {
+	if err := s.authService.UnsuspendAccount(ctx, userID); err != nil {
+		return err
+	}
+
+	s.auditLog.RecordAdmin(ctx, adminID, userID, audit.EventAdminUnsuspend, nil)
+	return nil
+}
+
+func (s *Service) RevokeSessions(ctx context.Context, adminID, userID uuid.UUID) error {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.authService.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	s.auditLog.RecordAdmin(ctx, adminID, userID, audit.EventAdminRevokeSession, nil)
+	return nil
+}
+
+func (s *Service) SetRole(ctx context.Context, adminID, userID uuid.UUID, role string) error {
+	if adminID == userID {
+		return errors.New("cannot change your own role")
+	}
+
+	u, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.authService.SetUserRole(ctx, userID, role); err != nil {
+		return err
+	}
+
+	s.auditLog.RecordAdmin(ctx, adminID, userID, audit.EventAdminSetRole, map[string]interface{}{
+		"old_role": u.Role,
+		"new_role": role,
+	})
+	return nil
+}
@@ -0,0 +1,63 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"q7o/internal/common/response"
+	"q7o/internal/common/validator"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// GetMyActivity — недавняя активность текущего пользователя (входы, смены пароля и т.д.)
+// GET /api/v1/users/me/activity?limit=&offset=
+func (h *Handler) GetMyActivity(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	events, err := h.service.ListForUser(c.Context(), uid, c.QueryInt("limit", 20), c.QueryInt("offset", 0))
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, events)
+}
+
+// ListEvents — журнал для администраторов
+// GET /api/v1/admin/audit-events?user_id=&actor_id=&type=&from=&to=&limit=&offset=
+func (h *Handler) ListEvents(c *fiber.Ctx) error {
+	var filter EventFilter
+	if err := c.QueryParser(&filter); err != nil {
+		return response.BadRequest(c, "Invalid query parameters")
+	}
+
+	if err := validator.ValidateStruct(filter); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return response.BadRequest(c, "from must be an RFC 3339 timestamp")
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return response.BadRequest(c, "to must be an RFC 3339 timestamp")
+		}
+	}
+
+	events, err := h.service.List(c.Context(), &filter)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, events)
+}
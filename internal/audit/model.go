@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Типы событий
+const (
+	EventLoginSuccess       = "login.success"
+	EventLoginFailure       = "login.failure"
+	EventTokenRefresh       = "token.refresh"
+	EventLogout             = "logout"
+	EventEmailVerify        = "email.verify"
+	EventEmailChange        = "email.change"
+	EventPasswordReset      = "password.reset"
+	EventPasswordChange     = "password.change"
+	EventProfileUpdate      = "profile.update"
+	EventUsernameChange     = "username.change"
+	EventAvatarChange       = "avatar.change"
+	EventAPIKeyCreate       = "api_key.create"
+	EventAPIKeyRevoke       = "api_key.revoke"
+	EventAdminVerifyEmail   = "admin.verify_email"
+	EventAdminResetPassword = "admin.reset_password"
+	EventAdminSuspend       = "admin.suspend"
+	EventAdminUnsuspend     = "admin.unsuspend"
+	EventAdminRevokeSession = "admin.revoke_sessions"
+	EventAdminSetRole       = "admin.set_role"
+)
+
+// Event — запись журнала. UserID — аккаунт, о котором событие;
+// ActorID — администратор, если действие выполнил не сам пользователь.
+type Event struct {
+	ID        uuid.UUID              `json:"id"`
+	UserID    *uuid.UUID             `json:"user_id,omitempty"`
+	ActorID   *uuid.UUID             `json:"actor_id,omitempty"`
+	Type      string                 `json:"type"`
+	IPAddress string                 `json:"ip_address"`
+	UserAgent string                 `json:"user_agent"`
+	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// EventFilter — фильтры журнала для администраторов
+type EventFilter struct {
+	UserID  string    `query:"user_id" validate:"omitempty,uuid"`
+	ActorID string    `query:"actor_id" validate:"omitempty,uuid"`
+	Type    string    `query:"type" validate:"omitempty,max=64"`
+	From    time.Time `query:"-"`
+	To      time.Time `query:"-"`
+	Limit   int       `query:"limit" validate:"omitempty,min=1,max=100"`
+	Offset  int       `query:"offset" validate:"omitempty,min=0"`
+}
+
+type EventListResponse struct {
+	Events []*Event `json:"events"`
+	Total  int      `json:"total"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
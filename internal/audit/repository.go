@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type Repository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+func (r *Repository) Insert(ctx context.Context, event *Event) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		return err
+	}
+	if event.Metadata == nil {
+		metadata = []byte("{}")
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+        INSERT INTO audit_events (id, user_id, actor_id, event_type, ip_address, user_agent, metadata, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `, event.ID, event.UserID, event.ActorID, event.Type, event.IPAddress, event.UserAgent, metadata, event.CreatedAt)
+	return err
+}
+
+// List возвращает события по фильтру (новые первыми) и их общее число
+func (r *Repository) List(ctx context.Context, filter *EventFilter) ([]*Event, int, error) {
+	var conditions []string
+	var args []interface{}
+	addArg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.UserID != "" {
+		conditions = append(conditions, "user_id = "+addArg(filter.UserID))
+	}
+	if filter.ActorID != "" {
+		conditions = append(conditions, "actor_id = "+addArg(filter.ActorID))
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "event_type = "+addArg(filter.Type))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "created_at >= "+addArg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "created_at < "+addArg(filter.To))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_events "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+        SELECT id, user_id, actor_id, event_type, ip_address, user_agent, metadata, created_at
+        FROM audit_events ` + where + `
+        ORDER BY created_at DESC
+        LIMIT ` + addArg(filter.Limit) + ` OFFSET ` + addArg(filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	events := []*Event{}
+	for rows.Next() {
+		event := &Event{}
+		var userID, actorID uuid.NullUUID
+		var metadata []byte
+		if err := rows.Scan(
+			&event.ID, &userID, &actorID, &event.Type,
+			&event.IPAddress, &event.UserAgent, &metadata, &event.CreatedAt,
+		); err != nil {
+			return nil, 0, err
+		}
+		if userID.Valid {
+			event.UserID = &userID.UUID
+		}
+		if actorID.Valid {
+			event.ActorID = &actorID.UUID
+		}
+		if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, event)
+	}
+
+	return events, total, rows.Err()
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/common/utils"
+)
+
+const maxUserAgentLength = 512
+
+// Service пишет события в журнал. Ошибка записи не прерывает основное действие — она только логируется.
+// Методы безопасно вызывать на nil *Service: журнал подключается через сеттеры и может отсутствовать.
+type Service struct {
+	repo *Repository
+}
+
+func NewService(repo *Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// requestInfo — то, что отдает контекст запроса fasthttp (c.Context() в обработчиках)
+type requestInfo interface {
+	RemoteIP() net.IP
+	UserAgent() []byte
+}
+
+// Record записывает действие пользователя; IP и User-Agent берутся из контекста запроса.
+// uuid.Nil в userID означает, что аккаунт неизвестен (например, вход с несуществующим email).
+func (s *Service) Record(ctx context.Context, userID uuid.UUID, eventType string, metadata map[string]interface{}) {
+	s.RecordClient(ctx, userID, eventType, "", "", metadata)
+}
+
+// RecordClient записывает действие пользователя с явно переданными IP и User-Agent
+func (s *Service) RecordClient(ctx context.Context, userID uuid.UUID, eventType, ipAddress, userAgent string, metadata map[string]interface{}) {
+	event := &Event{
+		Type:      eventType,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Metadata:  metadata,
+	}
+	if userID != uuid.Nil {
+		event.UserID = &userID
+	}
+	s.record(ctx, event)
+}
+
+// RecordAdmin записывает действие администратора над аккаунтом пользователя.
+// IP и User-Agent не заполняются: событие видно пользователю в его активности,
+// а адрес и браузер администратора раскрывать не нужно (администратор — в actor_id).
+func (s *Service) RecordAdmin(ctx context.Context, adminID, userID uuid.UUID, eventType string, metadata map[string]interface{}) {
+	s.record(ctx, &Event{
+		UserID:   &userID,
+		ActorID:  &adminID,
+		Type:     eventType,
+		Metadata: metadata,
+	})
+}
+
+func (s *Service) record(ctx context.Context, event *Event) {
+	if s == nil {
+		return
+	}
+
+	event.ID = uuid.New()
+	event.CreatedAt = time.Now()
+
+	if req, ok := ctx.(requestInfo); ok && event.ActorID == nil {
+		if event.IPAddress == "" {
+			if ip := req.RemoteIP(); ip != nil {
+				event.IPAddress = ip.String()
+			}
+		}
+		if event.UserAgent == "" {
+			event.UserAgent = string(req.UserAgent())
+		}
+	}
+	event.UserAgent = utils.TruncateString(event.UserAgent, maxUserAgentLength)
+
+	if err := s.repo.Insert(ctx, event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Type, err)
+	}
+}
+
+// ListForUser возвращает недавнюю активность пользователя
+func (s *Service) ListForUser(ctx context.Context, userID uuid.UUID, limit, offset int) (*EventListResponse, error) {
+	return s.List(ctx, &EventFilter{UserID: userID.String(), Limit: limit, Offset: offset})
+}
+
+func (s *Service) List(ctx context.Context, filter *EventFilter) (*EventListResponse, error) {
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	events, total, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventListResponse{
+		Events: events,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"q7o/internal/common/utils"
+)
+
+// SuspendAccount блокирует аккаунт: вход запрещается, все сессии завершаются,
+// уже выданные access токены отклоняет Middleware.Authenticate
+func (s *Service) SuspendAccount(ctx context.Context, userID uuid.UUID, reason string) error {
+	suspended, err := s.userRepo.Suspend(ctx, userID, reason)
+	if err != nil {
+		return err
+	}
+	if !suspended {
+		if _, err := s.userRepo.FindByID(ctx, userID); err == sql.ErrNoRows {
+			return errors.New("user not found")
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// Отметка в Redis и отзыв сессий повторяются и для уже заблокированного аккаунта:
+	// если прошлый вызов упал после записи в БД, повтор доводит блокировку до конца
+	if err := s.repo.SetUserSuspended(ctx, userID, true); err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	if !suspended {
+		return errors.New("account already suspended")
+	}
+	return nil
+}
+
+func (s *Service) UnsuspendAccount(ctx context.Context, userID uuid.UUID) error {
+	unsuspended, err := s.userRepo.Unsuspend(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !unsuspended {
+		return errors.New("account not suspended")
+	}
+
+	return s.repo.SetUserSuspended(ctx, userID, false)
+}
+
+// RestoreSuspensions восстанавливает отметки блокировки в Redis по данным БД
+func (s *Service) RestoreSuspensions(ctx context.Context) error {
+	ids, err := s.userRepo.FindSuspendedIDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.repo.SetUserSuspended(ctx, id, true); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Printf("Restored %d account suspensions", len(ids))
+	}
+	return nil
+}
+
+// AdminResetPassword заменяет пароль случайным, завершает все сессии
+// и отправляет пользователю код для установки нового пароля
+func (s *Service) AdminResetPassword(ctx context.Context, userID uuid.UUID) error {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	hashedPassword, err := utils.HashPassword(utils.GenerateToken(32))
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+
+	return s.sendPasswordReset(ctx, u)
+}
+
+// SetUserRole меняет роль. Роль зашита в access токены, поэтому сессии пользователя
+// завершаются — новая роль действует со следующего входа.
+func (s *Service) SetUserRole(ctx context.Context, userID uuid.UUID, role string) error {
+	if !ValidRole(role) {
+		return errors.New("invalid role")
+	}
+
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if u.Role == role {
+		return nil
+	}
+
+	if err := s.userRepo.UpdateRole(ctx, userID, role); err != nil {
+		return err
+	}
+	return s.RevokeAllSessions(ctx, userID)
+}
@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"q7o/internal/audit"
+	"q7o/internal/common/utils"
+	"q7o/internal/user"
+)
+
+// Ключ выглядит как q7o_<prefix>_<secret>: prefix виден в списке ключей, secret показывается один раз
+const (
+	apiKeyPrefix      = "q7o_"
+	maxAPIKeysPerUser = 20
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+
+	apiKeyDefaultExpiryDays = 90
+	apiKeyMaxExpiryDays     = 365
+)
+
+// Области действия API ключей
+const (
+	ScopeCallsRead     = "calls:read"
+	ScopeMeetingsRead  = "meetings:read"
+	ScopeMeetingsWrite = "meetings:write"
+	ScopeContactsRead  = "contacts:read"
+	ScopeProfileRead   = "profile:read"
+)
+
+// apiKeyRoutes — маршруты, доступные по API ключу, и нужная для них область.
+// Все остальные маршруты принимают только JWT; "/*" в конце — префикс.
+var apiKeyRoutes = []struct {
+	method string
+	path   string
+	scope  string
+}{
+	{fiber.MethodGet, "/api/v1/calls/history", ScopeCallsRead},
+	{fiber.MethodGet, "/api/v1/meetings/*", ScopeMeetingsRead},
+	{fiber.MethodPost, "/api/v1/meetings/*", ScopeMeetingsWrite},
+	{fiber.MethodPut, "/api/v1/meetings/*", ScopeMeetingsWrite},
+	{fiber.MethodGet, "/api/v1/contacts", ScopeContactsRead},
+	{fiber.MethodGet, "/api/v1/contacts/*", ScopeContactsRead},
+	{fiber.MethodGet, "/api/v1/users/me", ScopeProfileRead},
+}
+
+// apiKeyScope возвращает область, нужную для запроса по API ключу, или "" если маршрут ключам недоступен
+func apiKeyScope(method, path string) string {
+	path = strings.TrimSuffix(path, "/")
+	for _, route := range apiKeyRoutes {
+		if route.method == method && matchPath(path, route.path) {
+			return route.scope
+		}
+	}
+	return ""
+}
+
+// CreateAPIKey выпускает ключ; полный ключ возвращается только в ответе на создание.
+// Ключ переживает смену устройства, поэтому выпуск подтверждается текущим паролем.
+func (s *Service) CreateAPIKey(ctx context.Context, userID uuid.UUID, req CreateAPIKeyRequest) (*CreatedAPIKeyResponse, error) {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPassword(req.CurrentPassword, u.PasswordHash) {
+		return nil, errors.New("invalid password")
+	}
+	// Иначе ключ позволил бы обойти ограничения неподтвержденного аккаунта
+	if s.emailVerification.Required && !u.EmailVerified {
+		return nil, errors.New("email verification required")
+	}
+
+	keys, err := s.repo.GetAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) >= maxAPIKeysPerUser {
+		return nil, errors.New("too many api keys")
+	}
+
+	prefix := utils.GenerateToken(apiKeyPrefixBytes)
+	secret := apiKeyPrefix + prefix + "_" + utils.GenerateToken(apiKeySecretBytes)
+
+	key := &APIKey{
+		ID:      uuid.New(),
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Prefix:  prefix,
+		KeyHash: utils.HashToken(secret),
+		Scopes:  uniqueScopes(req.Scopes),
+	}
+	days := req.ExpiresInDays
+	if days <= 0 {
+		days = apiKeyDefaultExpiryDays
+	}
+	if days > apiKeyMaxExpiryDays {
+		days = apiKeyMaxExpiryDays
+	}
+	expiresAt := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	key.ExpiresAt = &expiresAt
+
+	if err := s.repo.CreateAPIKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.EventAPIKeyCreate, map[string]interface{}{
+		"key_id": key.ID,
+		"prefix": key.Prefix,
+		"scopes": key.Scopes,
+	})
+
+	return &CreatedAPIKeyResponse{
+		APIKeyResponse: toAPIKeyResponse(key),
+		Key:            secret,
+	}, nil
+}
+
+func (s *Service) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*APIKeyResponse, error) {
+	keys, err := s.repo.GetAPIKeys(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, toAPIKeyResponse(key))
+	}
+	return result, nil
+}
+
+// RevokeAPIKeys удаляет все ключи пользователя: вызывается вместе с завершением сессий
+// (сброс и смена пароля, смена email, блокировка), иначе ключ пережил бы смену учетных данных
+func (s *Service) RevokeAPIKeys(ctx context.Context, userID uuid.UUID) error {
+	count, err := s.repo.DeleteAPIKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		s.auditLog.Record(ctx, userID, audit.EventAPIKeyRevoke, map[string]interface{}{
+			"all":   true,
+			"count": count,
+		})
+	}
+	return nil
+}
+
+// RevokeAPIKey удаляет ключ — следующий запрос с ним получит 401
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	key, err := s.repo.DeleteAPIKey(ctx, userID, keyID)
+	if err == sql.ErrNoRows {
+		return errors.New("api key not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.EventAPIKeyRevoke, map[string]interface{}{
+		"key_id": key.ID,
+		"prefix": key.Prefix,
+	})
+	return nil
+}
+
+// AuthenticateAPIKey проверяет ключ, состояние аккаунта владельца и область, нужную для маршрута
+func (m *Middleware) AuthenticateAPIKey(ctx context.Context, secret, method, path, ip string) (*APIKey, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(secret, apiKeyPrefix), "_")
+	if !ok || prefix == "" {
+		return nil, errors.New("invalid api key")
+	}
+
+	key, err := m.repo.FindAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		return nil, errors.New("invalid api key")
+	}
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(secret)), []byte(key.KeyHash)) != 1 {
+		return nil, errors.New("invalid api key")
+	}
+	if key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt) {
+		return nil, errors.New("invalid api key")
+	}
+
+	switch key.AccountState {
+	case user.AccountStateActive:
+	case user.AccountStateSuspended:
+		return nil, errors.New("account suspended")
+	default:
+		return nil, errors.New("invalid api key")
+	}
+
+	scope := apiKeyScope(method, path)
+	if scope == "" {
+		return nil, errors.New("api key not allowed")
+	}
+	if !key.HasScope(scope) {
+		return nil, errors.New("insufficient scope")
+	}
+
+	if err := m.repo.TouchAPIKey(ctx, key.ID, ip); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// HasScope сообщает, выдана ли ключу область
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// isAPIKey отличает API ключ от JWT в заголовке Authorization
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	result := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+func toAPIKeyResponse(key *APIKey) *APIKeyResponse {
+	return &APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     apiKeyPrefix + key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		CreatedAt:  key.CreatedAt,
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"q7o/internal/common/utils"
+)
+
+// Одноразовые коды (email, SMS) хранятся в Redis как "<payload>:<sha256 кода>",
+// счетчик неверных попыток — в ключе "<key>:attempts".
+
+// storeOneTimeCode сохраняет код; новый код заменяет прежний и обнуляет счетчик попыток
+func (s *Service) storeOneTimeCode(ctx context.Context, key, payload, code string, ttl time.Duration) error {
+	if err := s.repo.SetKey(ctx, key, payload+":"+utils.HashToken(code), ttl); err != nil {
+		return err
+	}
+	return s.repo.DeleteKeys(ctx, key+":attempts")
+}
+
+// redeemOneTimeCode проверяет и гасит код, возвращает сохраненный вместе с ним payload.
+// После maxAttempts неверных попыток код аннулируется.
+func (s *Service) redeemOneTimeCode(ctx context.Context, key, code string, ttl time.Duration, maxAttempts int) (string, error) {
+	attempts, err := s.repo.IncrementCounter(ctx, key+":attempts", ttl)
+	if err != nil {
+		return "", err
+	}
+	if attempts > int64(maxAttempts) {
+		s.repo.DeleteKeys(ctx, key)
+		return "", errors.New("too many attempts, request a new code")
+	}
+
+	stored, err := s.repo.GetKey(ctx, key)
+	if err != nil {
+		return "", errors.New("invalid or expired code")
+	}
+
+	sep := strings.LastIndex(stored, ":")
+	if sep < 0 || subtle.ConstantTimeCompare([]byte(stored[sep+1:]), []byte(utils.HashToken(code))) != 1 {
+		return "", errors.New("invalid or expired code")
+	}
+
+	// Код одноразовый: при параллельных запросах GETDEL достанется только одному
+	if taken, err := s.repo.TakeKey(ctx, key); err != nil || taken != stored {
+		return "", errors.New("invalid or expired code")
+	}
+	s.repo.DeleteKeys(ctx, key+":attempts")
+
+	return stored[:sep], nil
+}
+
+// discardOneTimeCode аннулирует код и возвращает его payload, если код был
+func (s *Service) discardOneTimeCode(ctx context.Context, key string) (string, bool) {
+	s.repo.DeleteKeys(ctx, key+":attempts")
+
+	stored, err := s.repo.TakeKey(ctx, key)
+	if err != nil {
+		return "", false
+	}
+	sep := strings.LastIndex(stored, ":")
+	if sep < 0 {
+		return "", false
+	}
+	return stored[:sep], true
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/audit"
+	"q7o/internal/common/utils"
+)
+
+const (
+	emailChangeTTL         = time.Hour
+	emailChangeWindow      = time.Hour
+	emailChangeMaxRequests = 5
+	emailChangeMaxAttempts = 5
+)
+
+// RequestEmailChange начинает смену email: код подтверждения уходит на новый адрес,
+// уведомление со ссылкой отмены — на текущий. Email меняется только после ввода кода.
+func (s *Service) RequestEmailChange(ctx context.Context, userID uuid.UUID, newEmail, password string) error {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if !utils.CheckPassword(password, u.PasswordHash) {
+		return errors.New("invalid password")
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if strings.EqualFold(newEmail, u.Email) {
+		return errors.New("email unchanged")
+	}
+	if s.isDisposableEmail(newEmail) {
+		return errors.New("disposable email not allowed")
+	}
+	if exists, err := s.userRepo.EmailExists(ctx, newEmail); err != nil {
+		return err
+	} else if exists {
+		return errors.New("email already exists")
+	}
+
+	count, err := s.repo.IncrementCounter(ctx, fmt.Sprintf("email_change:rate:%s", userID), emailChangeWindow)
+	if err != nil {
+		return err
+	}
+	if count > emailChangeMaxRequests {
+		return errors.New("too many requests")
+	}
+
+	// Действует только последний запрос
+	s.discardEmailChange(ctx, userID)
+
+	changeID := uuid.New().String()
+	code := utils.GenerateCode(6)
+
+	cancelToken, err := s.keys.GenerateScopedToken(userID, TokenTypeEmailChange, changeID, time.Now().Add(emailChangeTTL))
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetKey(ctx, "email_change:cancel:"+changeID, userID.String(), emailChangeTTL); err != nil {
+		return err
+	}
+	// payload: "<changeID>:<новый email>"
+	if err := s.storeOneTimeCode(ctx, emailChangeKey(userID), changeID+":"+newEmail, code, emailChangeTTL); err != nil {
+		return err
+	}
+
+	fullName := u.FirstName + " " + u.LastName
+	cancelURL := fmt.Sprintf("%s/api/v1/auth/email/change/cancel?token=%s", s.appURL, cancelToken)
+	go s.emailService.SendEmailChangeCodeEmail(newEmail, fullName, code, int(emailChangeTTL.Minutes()))
+	go s.emailService.SendEmailChangeRequestedEmail(u.Email, fullName, newEmail, cancelURL)
+
+	return nil
+}
+
+// ConfirmEmailChange меняет email после ввода кода с нового адреса
+// и завершает все сессии, кроме текущей
+func (s *Service) ConfirmEmailChange(ctx context.Context, userID, currentSessionID uuid.UUID, code string) (string, error) {
+	payload, err := s.redeemOneTimeCode(ctx, emailChangeKey(userID), code, emailChangeTTL, emailChangeMaxAttempts)
+	if err != nil {
+		return "", err
+	}
+
+	changeID, newEmail, ok := strings.Cut(payload, ":")
+	if !ok {
+		return "", errors.New("invalid or expired code")
+	}
+
+	// Ссылку отмены из письма на старый адрес могли уже использовать
+	if owner, err := s.repo.TakeKey(ctx, "email_change:cancel:"+changeID); err != nil || owner != userID.String() {
+		return "", errors.New("invalid or expired code")
+	}
+
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	oldEmail := u.Email
+
+	changed, err := s.userRepo.ChangeEmail(ctx, userID, oldEmail, newEmail)
+	if err != nil {
+		return "", err
+	}
+	if !changed {
+		return "", errors.New("invalid or expired code")
+	}
+
+	// Ссылки и коды входа, отправленные на старый адрес, больше не действуют
+	s.discardEmailLogin(ctx, userID)
+
+	if currentSessionID == uuid.Nil {
+		err = s.RevokeAllSessions(ctx, userID)
+	} else if _, err = s.RevokeOtherSessions(ctx, userID, currentSessionID); err == nil {
+		err = s.RevokeAPIKeys(ctx, userID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.EventEmailChange, map[string]interface{}{
+		"old_email": oldEmail,
+		"new_email": newEmail,
+	})
+
+	go s.emailService.SendEmailChangedEmail(oldEmail, u.FirstName+" "+u.LastName, newEmail)
+
+	return newEmail, nil
+}
+
+// CancelEmailChange отменяет смену email по ссылке из письма на текущий адрес
+func (s *Service) CancelEmailChange(ctx context.Context, token string) error {
+	claims, err := s.keys.ParseScopedToken(token, TokenTypeEmailChange)
+	if err != nil {
+		return errors.New("invalid or expired cancel link")
+	}
+
+	owner, err := s.repo.TakeKey(ctx, "email_change:cancel:"+claims.ID)
+	if err != nil || owner != claims.UserID.String() {
+		return errors.New("invalid or expired cancel link")
+	}
+	s.discardOneTimeCode(ctx, emailChangeKey(claims.UserID))
+
+	return nil
+}
+
+func (s *Service) discardEmailChange(ctx context.Context, userID uuid.UUID) {
+	if payload, ok := s.discardOneTimeCode(ctx, emailChangeKey(userID)); ok {
+		if changeID, _, found := strings.Cut(payload, ":"); found {
+			s.repo.DeleteKeys(ctx, "email_change:cancel:"+changeID)
+		}
+	}
+}
+
+func emailChangeKey(userID uuid.UUID) string {
+	return fmt.Sprintf("email_change:%s", userID)
+}
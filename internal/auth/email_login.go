@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/common/utils"
+)
+
+const (
+	emailLoginTTL          = 15 * time.Minute
+	emailLoginWindow       = time.Hour
+	emailLoginMaxRequests  = 5  // писем на один email в час
+	emailLoginMaxIPRequest = 20 // запросов с одного IP в час
+	emailLoginMaxAttempts  = 5  // попыток ввода кода на одно письмо
+)
+
+// RequestEmailLogin отправляет письмо со ссылкой для входа и 6-значным кодом.
+// Действует только последнее отправленное письмо; ссылка и код одноразовые.
+// Для несуществующего email ошибка не возвращается, чтобы не раскрывать наличие аккаунта.
+func (s *Service) RequestEmailLogin(ctx context.Context, email string, client ClientInfo) error {
+	count, err := s.repo.IncrementCounter(ctx, "login_email:rate:"+normalizeEmail(email), emailLoginWindow)
+	if err != nil {
+		return err
+	}
+	if count > emailLoginMaxRequests {
+		return errors.New("too many requests")
+	}
+
+	if client.IPAddress != "" {
+		count, err := s.repo.IncrementCounter(ctx, "login_email:rate:ip:"+client.IPAddress, emailLoginWindow)
+		if err != nil {
+			return err
+		}
+		if count > emailLoginMaxIPRequest {
+			return errors.New("too many requests")
+		}
+	}
+
+	u, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	// Предыдущее письмо больше не действует
+	s.discardEmailLogin(ctx, u.ID)
+
+	linkID := uuid.New().String()
+	code := utils.GenerateCode(6)
+
+	link, err := s.keys.GenerateScopedToken(u.ID, TokenTypeMagicLink, linkID, time.Now().Add(emailLoginTTL))
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.SetKey(ctx, "login_email:link:"+linkID, u.ID.String(), emailLoginTTL); err != nil {
+		return err
+	}
+	if err := s.storeOneTimeCode(ctx, emailLoginCodeKey(u.ID), linkID, code, emailLoginTTL); err != nil {
+		return err
+	}
+
+	loginURL := fmt.Sprintf("%s/api/v1/auth/login/email/verify?token=%s", s.appURL, link)
+	fullName := u.FirstName + " " + u.LastName
+	go s.emailService.SendLoginLinkEmail(u.Email, fullName, loginURL, code, int(emailLoginTTL.Minutes()))
+
+	return nil
+}
+
+// RedeemEmailLoginLink входит по ссылке из письма
+func (s *Service) RedeemEmailLoginLink(ctx context.Context, token string, client ClientInfo) (*LoginResult, error) {
+	claims, err := s.keys.ParseScopedToken(token, TokenTypeMagicLink)
+	if err != nil {
+		return nil, errors.New("invalid or expired login link")
+	}
+
+	// GETDEL: ссылка срабатывает один раз, даже при параллельных запросах
+	userID, err := s.repo.TakeKey(ctx, "login_email:link:"+claims.ID)
+	if err != nil || userID != claims.UserID.String() {
+		return nil, errors.New("invalid or expired login link")
+	}
+	s.discardOneTimeCode(ctx, emailLoginCodeKey(claims.UserID))
+
+	return s.completeEmailLogin(ctx, claims.UserID, client)
+}
+
+// RedeemEmailLoginCode входит по коду из письма
+func (s *Service) RedeemEmailLoginCode(ctx context.Context, email, code string, client ClientInfo) (*LoginResult, error) {
+	normalized := normalizeEmail(email)
+	if err := s.checkLoginAllowed(ctx, normalized, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	u, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, s.failLogin(ctx, normalized, client.IPAddress, nil, errors.New("invalid or expired code"))
+	}
+
+	linkID, err := s.redeemOneTimeCode(ctx, emailLoginCodeKey(u.ID), code, emailLoginTTL, emailLoginMaxAttempts)
+	if err != nil {
+		return nil, s.failLogin(ctx, normalized, client.IPAddress, u, err)
+	}
+	s.repo.DeleteKeys(ctx, "login_email:link:"+linkID)
+	s.clearLoginFailures(ctx, normalized)
+
+	return s.completeEmailLogin(ctx, u.ID, client)
+}
+
+// completeEmailLogin: владение почтовым ящиком доказано, поэтому email считается подтвержденным.
+// Второй фактор (TOTP), если включен, по-прежнему запрашивается.
+func (s *Service) completeEmailLogin(ctx context.Context, userID uuid.UUID, client ClientInfo) (*LoginResult, error) {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("invalid or expired login link")
+	}
+
+	if !u.EmailVerified {
+		if err := s.userRepo.VerifyEmail(ctx, u.ID); err != nil {
+			return nil, err
+		}
+		u.EmailVerified = true
+	}
+
+	return s.completeLogin(ctx, u, client)
+}
+
+func (s *Service) discardEmailLogin(ctx context.Context, userID uuid.UUID) {
+	if linkID, ok := s.discardOneTimeCode(ctx, emailLoginCodeKey(userID)); ok {
+		s.repo.DeleteKeys(ctx, "login_email:link:"+linkID)
+	}
+}
+
+func emailLoginCodeKey(userID uuid.UUID) string {
+	return fmt.Sprintf("login_email:code:%s", userID)
+}
+
+// EmailLoginAppLink — deep link, который передает токен из письма приложению; вход по нему выполняет POST
+func (s *Service) EmailLoginAppLink(token string) string {
+	return s.emailLoginAppURL + "?token=" + url.QueryEscape(token)
+}
@@ -1,25 +1,647 @@
 package auth
 
 import (
+	"errors"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"q7o/internal/common/response"
+	"q7o/internal/common/utils"
 )
 
-type Handler struct {
-	service  *Service
-	validate *validator.Validate
+type Handler struct {
+	service  *Service
+	validate *validator.Validate
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service:  service,
+		validate: validator.New(),
+	}
+}
+
+func (h *Handler) Register(c *fiber.Ctx) error {
+	var req RegisterRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if ok, err := h.checkProofOfWork(c, PoWPurposeRegister); !ok {
+		return err
+	}
+
+	user, tokens, err := h.service.Register(c.Context(), req, clientInfo(c))
+	if err != nil {
+		if err.Error() == "email already exists" || err.Error() == "username.go already exists" {
+			return response.Conflict(c, err.Error())
+		}
+		if err.Error() == "disposable email not allowed" {
+			return response.BadRequest(c, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"user":          user,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+	})
+}
+
+// IssuePoWChallenge выдает задачу proof-of-work для регистрации или проверки username
+func (h *Handler) IssuePoWChallenge(c *fiber.Ctx) error {
+	var req PoWChallengeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	challenge, err := h.service.IssuePoWChallenge(c.Context(), req.Purpose, c.IP())
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, challenge)
+}
+
+// checkProofOfWork проверяет и расходует решенный челлендж из заголовка X-PoW-Solution.
+// Вызывается после валидации тела, чтобы ошибка в форме не сжигала решение.
+// false — ответ с ошибкой уже записан.
+func (h *Handler) checkProofOfWork(c *fiber.Ctx, purpose string) (bool, error) {
+	if err := h.service.VerifyProofOfWork(c.Context(), purpose, c.Get("X-PoW-Solution")); err != nil {
+		switch err.Error() {
+		case "proof of work required", "invalid proof of work", "proof of work already used":
+			return false, response.Error(c, fiber.StatusForbidden, err.Error())
+		}
+		return false, response.InternalError(c, err)
+	}
+	return true, nil
+}
+
+func (h *Handler) Login(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	result, err := h.service.Login(c.Context(), req, clientInfo(c))
+	if err != nil {
+		if lockErr := asLockout(err); lockErr != nil {
+			return lockoutResponse(c, lockErr)
+		}
+		if err.Error() == "invalid credentials" {
+			return response.Unauthorized(c, "Invalid email or password")
+		}
+		if err.Error() == "account suspended" {
+			return response.Error(c, fiber.StatusForbidden, "Account suspended")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, result)
+}
+
+func asLockout(err error) *LockoutError {
+	var lockErr *LockoutError
+	if errors.As(err, &lockErr) {
+		return lockErr
+	}
+	return nil
+}
+
+// lockoutResponse отвечает 429 с Retry-After
+func lockoutResponse(c *fiber.Ctx, lockErr *LockoutError) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockErr.RetryAfter.Seconds()))))
+	return response.TooManyRequests(c, lockErr.Error())
+}
+
+func (h *Handler) VerifyMFA(c *fiber.Ctx) error {
+	var req MFAVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	result, err := h.service.VerifyMFA(c.Context(), req.MFAToken, req.Code, clientInfo(c))
+	if err != nil {
+		if lockErr := asLockout(err); lockErr != nil {
+			return lockoutResponse(c, lockErr)
+		}
+		if err.Error() == "invalid or expired mfa token" || err.Error() == "invalid code" {
+			return response.Unauthorized(c, err.Error())
+		}
+		if err.Error() == "account suspended" {
+			return response.Error(c, fiber.StatusForbidden, "Account suspended")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, result)
+}
+
+func (h *Handler) GetMFAStatus(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	status, err := h.service.GetMFAStatus(c.Context(), uid)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, status)
+}
+
+func (h *Handler) SetupMFA(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	setup, err := h.service.SetupMFA(c.Context(), uid)
+	if err != nil {
+		if err.Error() == "mfa already enabled" {
+			return response.Conflict(c, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, setup)
+}
+
+func (h *Handler) EnableMFA(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req MFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	codes, err := h.service.EnableMFA(c.Context(), uid, req.Code)
+	if err != nil {
+		switch err.Error() {
+		case "mfa already enabled":
+			return response.Conflict(c, err.Error())
+		case "mfa setup not started", "invalid code":
+			return response.BadRequest(c, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"enabled":        true,
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handler) DisableMFA(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req MFADisableRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.DisableMFA(c.Context(), uid, req.Password, req.Code); err != nil {
+		switch err.Error() {
+		case "invalid credentials", "invalid code", "mfa not enabled":
+			return response.BadRequest(c, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req MFACodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(c.Context(), uid, req.Code)
+	if err != nil {
+		if err.Error() == "invalid code" || err.Error() == "mfa not enabled" {
+			return response.BadRequest(c, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// BeginPasskeyRegistration — параметры для создания passkey (тело запроса не требуется)
+func (h *Handler) BeginPasskeyRegistration(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	options, err := h.service.BeginPasskeyRegistration(c.Context(), uid)
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return response.Success(c, options)
+}
+
+// FinishPasskeyRegistration принимает PublicKeyCredential в теле запроса, имя — в ?name=
+func (h *Handler) FinishPasskeyRegistration(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	passkey, err := h.service.FinishPasskeyRegistration(c.Context(), uid, c.Query("name"), c.Body())
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return response.Success(c, passkey)
+}
+
+func (h *Handler) BeginPasskeyLogin(c *fiber.Ctx) error {
+	options, sessionID, err := h.service.BeginPasskeyLogin(c.Context())
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"session_id": sessionID,
+		"options":    options,
+	})
+}
+
+// FinishPasskeyLogin принимает PublicKeyCredential в теле запроса, сессию — в ?session_id=
+func (h *Handler) FinishPasskeyLogin(c *fiber.Ctx) error {
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		return response.BadRequest(c, "session_id is required")
+	}
+
+	result, err := h.service.FinishPasskeyLogin(c.Context(), sessionID, c.Body(), clientInfo(c))
+	if err != nil {
+		return passkeyError(c, err)
+	}
+
+	return response.Success(c, result)
+}
+
+func (h *Handler) ListPasskeys(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	passkeys, err := h.service.ListPasskeys(c.Context(), uid)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, passkeys)
+}
+
+func (h *Handler) DeletePasskey(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	passkeyID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid passkey ID")
+	}
+
+	if err := h.service.DeletePasskey(c.Context(), uid, passkeyID); err != nil {
+		if err.Error() == "passkey not found" {
+			return response.Error(c, fiber.StatusNotFound, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Passkey deleted",
+	})
+}
+
+// CreateAPIKey выпускает персональный API ключ; ключ показывается только в этом ответе
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	key, err := h.service.CreateAPIKey(c.Context(), uid, req)
+	if err != nil {
+		switch err.Error() {
+		case "invalid password":
+			return response.Unauthorized(c, "Invalid password")
+		case "too many api keys":
+			return response.BadRequest(c, err.Error())
+		case "email verification required":
+			return response.Error(c, fiber.StatusForbidden, "Email verification required")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, key)
+}
+
+func (h *Handler) ListAPIKeys(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	keys, err := h.service.ListAPIKeys(c.Context(), uid)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, keys)
+}
+
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	keyID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid API key ID")
+	}
+
+	if err := h.service.RevokeAPIKey(c.Context(), uid, keyID); err != nil {
+		if err.Error() == "api key not found" {
+			return response.Error(c, fiber.StatusNotFound, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "API key revoked",
+	})
+}
+
+// clientInfo собирает сведения об устройстве для записи в sessions
+func clientInfo(c *fiber.Ctx) ClientInfo {
+	return ClientInfo{
+		DeviceInfo: utils.TruncateString(c.Get(fiber.HeaderUserAgent), 512),
+		IPAddress:  c.IP(),
+	}
+}
+
+func passkeyError(c *fiber.Ctx, err error) error {
+	if lockErr := asLockout(err); lockErr != nil {
+		return lockoutResponse(c, lockErr)
+	}
+	switch err.Error() {
+	case "invalid passkey", "login session expired":
+		return response.Unauthorized(c, err.Error())
+	case "invalid passkey response", "registration session expired", "too many passkeys":
+		return response.BadRequest(c, err.Error())
+	case "passkeys not configured":
+		return response.Error(c, fiber.StatusServiceUnavailable, err.Error())
+	case "account suspended":
+		return response.Error(c, fiber.StatusForbidden, "Account suspended")
+	}
+	return response.InternalError(c, err)
+}
+
+// RequestEmailLogin отправляет ссылку и код для входа без пароля
+func (h *Handler) RequestEmailLogin(c *fiber.Ctx) error {
+	var req EmailLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.RequestEmailLogin(c.Context(), req.Email, clientInfo(c)); err != nil {
+		if err.Error() == "too many requests" {
+			return response.TooManyRequests(c, "Too many requests, try again later")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "If the email is registered, a sign-in link has been sent",
+	})
+}
+
+var emailLoginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Q7O</title>
+</head>
+<body>
+    {{if .Message}}
+    <p>{{.Message}}</p>
+    {{else}}
+    <p>Sign in to Q7O on this device?</p>
+    <p><a href="{{.AppLink}}">Open Q7O and sign in</a></p>
+    <p>On another device, enter the code from the email instead.</p>
+    {{end}}
+</body>
+</html>
+`))
+
+// ShowEmailLogin — ссылка из письма входа. GET ее не расходует (ссылку могут открыть сканеры почты),
+// а показывает страницу, которая открывает приложение; приложение входит POST-запросом с токеном.
+func (h *Handler) ShowEmailLogin(c *fiber.Ctx) error {
+	c.Type("html", "utf-8")
+	token := c.Query("token")
+	if token == "" {
+		c.Status(fiber.StatusBadRequest)
+		return emailLoginPage.Execute(c, fiber.Map{"Message": "Invalid or expired login link."})
+	}
+	// Адрес собран из конфигурации и экранированного токена; template.URL нужен для схемы приложения
+	return emailLoginPage.Execute(c, fiber.Map{"AppLink": template.URL(h.service.EmailLoginAppLink(token))})
+}
+
+// VerifyEmailLogin входит по токену из ссылки либо по email и коду
+func (h *Handler) VerifyEmailLogin(c *fiber.Ctx) error {
+	var req EmailLoginVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	var result *LoginResult
+	var err error
+	if req.Token != "" {
+		result, err = h.service.RedeemEmailLoginLink(c.Context(), req.Token, clientInfo(c))
+	} else {
+		result, err = h.service.RedeemEmailLoginCode(c.Context(), req.Email, req.Code, clientInfo(c))
+	}
+	if err != nil {
+		if lockErr := asLockout(err); lockErr != nil {
+			return lockoutResponse(c, lockErr)
+		}
+		switch err.Error() {
+		case "invalid or expired login link", "invalid or expired code":
+			return response.Unauthorized(c, err.Error())
+		case "too many attempts, request a new code":
+			return response.TooManyRequests(c, err.Error())
+		case "account suspended":
+			return response.Error(c, fiber.StatusForbidden, "Account suspended")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, result)
+}
+
+// RequestPhoneLogin отправляет SMS с кодом входа на подтвержденный номер
+func (h *Handler) RequestPhoneLogin(c *fiber.Ctx) error {
+	var req PhoneLoginRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.RequestPhoneLogin(c.Context(), req.Phone, clientInfo(c)); err != nil {
+		return phoneError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "If the phone number is registered, a sign-in code has been sent",
+	})
+}
+
+func (h *Handler) VerifyPhoneLogin(c *fiber.Ctx) error {
+	var req PhoneLoginVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	result, err := h.service.VerifyPhoneLogin(c.Context(), req.Phone, req.Code, clientInfo(c))
+	if err != nil {
+		if err.Error() == "invalid or expired code" {
+			return response.Unauthorized(c, err.Error())
+		}
+		return phoneError(c, err)
+	}
+
+	return response.Success(c, result)
 }
 
-func NewHandler(service *Service) *Handler {
-	return &Handler{
-		service:  service,
-		validate: validator.New(),
+// ResendPhoneVerification повторно отправляет код подтверждения на номер из профиля
+func (h *Handler) ResendPhoneVerification(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	if err := h.service.SendPhoneVerification(c.Context(), uid); err != nil {
+		return phoneError(c, err)
 	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Verification code sent",
+	})
 }
 
-func (h *Handler) Register(c *fiber.Ctx) error {
-	var req RegisterRequest
+func (h *Handler) VerifyPhone(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req PhoneVerifyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.VerifyPhone(c.Context(), uid, req.Code); err != nil {
+		return phoneError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Phone number verified",
+	})
+}
+
+func phoneError(c *fiber.Ctx, err error) error {
+	if lockErr := asLockout(err); lockErr != nil {
+		return lockoutResponse(c, lockErr)
+	}
+	switch err.Error() {
+	case "too many requests":
+		return response.TooManyRequests(c, "Too many requests, try again later")
+	case "too many attempts, request a new code":
+		return response.TooManyRequests(c, err.Error())
+	case "invalid or expired code", "phone number not set", "phone already verified":
+		return response.BadRequest(c, err.Error())
+	case "sms not configured":
+		return response.Error(c, fiber.StatusServiceUnavailable, err.Error())
+	case "account suspended":
+		return response.Error(c, fiber.StatusForbidden, "Account suspended")
+	}
+	return response.InternalError(c, err)
+}
+
+// RequestEmailChange отправляет код подтверждения на новый адрес
+func (h *Handler) RequestEmailChange(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req EmailChangeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.RequestEmailChange(c.Context(), uid, req.NewEmail, req.Password); err != nil {
+		return emailChangeError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Confirmation code sent to the new email address",
+	})
+}
+
+// ConfirmEmailChange меняет email; остальные сессии завершаются
+func (h *Handler) ConfirmEmailChange(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+	sessionID, _ := uuid.Parse(c.Locals("sessionID").(string))
+
+	var req EmailChangeConfirmRequest
 	if err := c.BodyParser(&req); err != nil {
 		return response.BadRequest(c, "Invalid request body")
 	}
@@ -28,23 +650,57 @@ func (h *Handler) Register(c *fiber.Ctx) error {
 		return response.ValidationError(c, err)
 	}
 
-	user, tokens, err := h.service.Register(c.Context(), req)
+	newEmail, err := h.service.ConfirmEmailChange(c.Context(), uid, sessionID, req.Code)
 	if err != nil {
-		if err.Error() == "email already exists" || err.Error() == "username.go already exists" {
-			return response.Conflict(c, err.Error())
-		}
-		return response.InternalError(c, err)
+		return emailChangeError(c, err)
 	}
 
 	return response.Success(c, fiber.Map{
-		"user":          user,
-		"access_token":  tokens.AccessToken,
-		"refresh_token": tokens.RefreshToken,
+		"message": "Email address changed",
+		"email":   newEmail,
 	})
 }
 
-func (h *Handler) Login(c *fiber.Ctx) error {
-	var req LoginRequest
+var emailChangeCancelPage = template.Must(template.New("cancel").Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>Q7O</title>
+</head>
+<body>
+    {{if .Message}}
+    <p>{{.Message}}</p>
+    {{else}}
+    <p>Cancel the requested change of your Q7O email address?</p>
+    <form method="POST">
+        <input type="hidden" name="token" value="{{.Token}}">
+        <button type="submit">Cancel email change</button>
+    </form>
+    {{end}}
+</body>
+</html>
+`))
+
+func renderEmailChangeCancelPage(c *fiber.Ctx, status int, token, message string) error {
+	c.Status(status).Type("html", "utf-8")
+	return emailChangeCancelPage.Execute(c, fiber.Map{"Token": token, "Message": message})
+}
+
+// ShowEmailChangeCancel — ссылка из уведомления на текущий адрес. GET ничего не меняет
+// (ссылку могут открыть сканеры почты), а показывает форму, которая отправляет POST.
+func (h *Handler) ShowEmailChangeCancel(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return renderEmailChangeCancelPage(c, fiber.StatusBadRequest, "", "Invalid or expired cancel link.")
+	}
+	return renderEmailChangeCancelPage(c, fiber.StatusOK, token, "")
+}
+
+// CancelEmailChange отменяет смену email по токену из ссылки: JSON от клиента или форма со страницы подтверждения
+func (h *Handler) CancelEmailChange(c *fiber.Ctx) error {
+	fromPage := strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationForm)
+
+	var req EmailChangeCancelRequest
 	if err := c.BodyParser(&req); err != nil {
 		return response.BadRequest(c, "Invalid request body")
 	}
@@ -53,29 +709,132 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		return response.ValidationError(c, err)
 	}
 
-	user, tokens, err := h.service.Login(c.Context(), req)
+	if err := h.service.CancelEmailChange(c.Context(), req.Token); err != nil {
+		if fromPage && err.Error() == "invalid or expired cancel link" {
+			return renderEmailChangeCancelPage(c, fiber.StatusBadRequest, "", "Invalid or expired cancel link.")
+		}
+		return emailChangeError(c, err)
+	}
+
+	if fromPage {
+		return renderEmailChangeCancelPage(c, fiber.StatusOK, "", "Email change cancelled.")
+	}
+	return response.Success(c, fiber.Map{
+		"message": "Email change cancelled",
+	})
+}
+
+func emailChangeError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "invalid password":
+		return response.Unauthorized(c, "Invalid password")
+	case "email already exists":
+		return response.Conflict(c, "Email already in use")
+	case "too many requests":
+		return response.TooManyRequests(c, "Too many requests, try again later")
+	case "too many attempts, request a new code":
+		return response.TooManyRequests(c, err.Error())
+	case "email unchanged", "invalid or expired code", "invalid or expired cancel link", "disposable email not allowed":
+		return response.BadRequest(c, err.Error())
+	}
+	return response.InternalError(c, err)
+}
+
+func (h *Handler) OIDCProviders(c *fiber.Ctx) error {
+	return response.Success(c, h.service.ListOIDCProviders())
+}
+
+// BeginOIDCLogin возвращает адрес, на который клиент открывает страницу входа провайдера
+func (h *Handler) BeginOIDCLogin(c *fiber.Ctx) error {
+	authorization, err := h.service.BeginOIDCLogin(c.Context(), c.Params("provider"))
 	if err != nil {
-		if err.Error() == "invalid credentials" {
-			return response.Unauthorized(c, "Invalid email or password")
+		return oidcError(c, err)
+	}
+
+	return response.Success(c, authorization)
+}
+
+// OIDCCallback завершает вход: провайдер перенаправляет сюда (?code=&state=),
+// мобильный клиент может передать code и state в теле запроса
+func (h *Handler) OIDCCallback(c *fiber.Ctx) error {
+	var req OIDCCallbackRequest
+	if c.Method() == fiber.MethodGet {
+		if providerErr := c.Query("error"); providerErr != "" {
+			return response.BadRequest(c, "Authorization denied: "+providerErr)
+		}
+		req.Code = c.Query("code")
+		req.State = c.Query("state")
+	} else if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	result, err := h.service.FinishOIDCLogin(c.Context(), c.Params("provider"), req.Code, req.State, clientInfo(c))
+	if err != nil {
+		return oidcError(c, err)
+	}
+
+	return response.Success(c, result)
+}
+
+func (h *Handler) ListIdentities(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	identities, err := h.service.ListIdentities(c.Context(), uid)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, identities)
+}
+
+func (h *Handler) UnlinkIdentity(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	if err := h.service.UnlinkIdentity(c.Context(), uid, c.Params("provider")); err != nil {
+		if err.Error() == "identity not found" {
+			return response.Error(c, fiber.StatusNotFound, err.Error())
 		}
 		return response.InternalError(c, err)
 	}
 
 	return response.Success(c, fiber.Map{
-		"user":          user,
-		"access_token":  tokens.AccessToken,
-		"refresh_token": tokens.RefreshToken,
+		"message": "Identity unlinked",
 	})
 }
 
+func oidcError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "unknown provider":
+		return response.Error(c, fiber.StatusNotFound, err.Error())
+	case "invalid or expired state", "authorization failed", "invalid id token":
+		return response.Unauthorized(c, err.Error())
+	case "email not verified by provider":
+		return response.Error(c, fiber.StatusForbidden, err.Error())
+	case "identity already linked":
+		return response.Conflict(c, "Another account of this provider is already linked")
+	case "account suspended":
+		return response.Error(c, fiber.StatusForbidden, "Account suspended")
+	case "provider unavailable":
+		return response.Error(c, fiber.StatusServiceUnavailable, err.Error())
+	}
+	return response.InternalError(c, err)
+}
+
 func (h *Handler) RefreshToken(c *fiber.Ctx) error {
 	var req RefreshRequest
 	if err := c.BodyParser(&req); err != nil {
 		return response.BadRequest(c, "Invalid request body")
 	}
 
-	tokens, err := h.service.RefreshToken(c.Context(), req.RefreshToken)
+	tokens, err := h.service.RefreshToken(c.Context(), req.RefreshToken, clientInfo(c))
 	if err != nil {
+		if err.Error() == "account suspended" {
+			return response.Error(c, fiber.StatusForbidden, "Account suspended")
+		}
 		return response.Unauthorized(c, "Invalid refresh token")
 	}
 
@@ -88,13 +847,22 @@ func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
 		return response.BadRequest(c, "Invalid request body")
 	}
 
-	if err := h.service.VerifyEmail(c.Context(), req.Email, req.Code); err != nil {
+	tokens, err := h.service.VerifyEmail(c.Context(), req.Email, req.Code, req.RefreshToken, clientInfo(c))
+	if err != nil {
+		if err.Error() == "too many attempts, request a new code" {
+			return response.TooManyRequests(c, err.Error())
+		}
 		return response.BadRequest(c, "Invalid verification code")
 	}
 
-	return response.Success(c, fiber.Map{
+	result := fiber.Map{
 		"message": "Email verified successfully",
-	})
+	}
+	if tokens != nil {
+		result["tokens"] = tokens
+	}
+
+	return response.Success(c, result)
 }
 
 func (h *Handler) ResendVerification(c *fiber.Ctx) error {
@@ -104,6 +872,9 @@ func (h *Handler) ResendVerification(c *fiber.Ctx) error {
 	}
 
 	if err := h.service.ResendVerification(c.Context(), req.Email); err != nil {
+		if err.Error() == "too many requests" {
+			return response.TooManyRequests(c, "Too many requests, try again later")
+		}
 		return response.BadRequest(c, err.Error())
 	}
 
@@ -112,6 +883,78 @@ func (h *Handler) ResendVerification(c *fiber.Ctx) error {
 	})
 }
 
+// UnlockAccount снимает блокировку входа; токен приходит в письме (?token=) или в теле запроса
+func (h *Handler) UnlockAccount(c *fiber.Ctx) error {
+	var req UnlockAccountRequest
+	if c.Method() == fiber.MethodGet {
+		req.Token = c.Query("token")
+	} else if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.UnlockAccount(c.Context(), req.Token); err != nil {
+		if err.Error() == "invalid or expired unlock token" {
+			return response.BadRequest(c, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Account unlocked, you can log in again",
+	})
+}
+
+func (h *Handler) ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.ForgotPassword(c.Context(), req.Email); err != nil {
+		if err.Error() == "too many reset requests" {
+			return response.TooManyRequests(c, "Too many reset requests, try again later")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "If an account with this email exists, a reset code has been sent",
+	})
+}
+
+func (h *Handler) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	if err := h.service.ResetPassword(c.Context(), req); err != nil {
+		if err.Error() == "invalid or expired reset code" {
+			return response.BadRequest(c, "Invalid or expired reset code")
+		}
+		if err.Error() == "too many failed attempts" {
+			return response.TooManyRequests(c, "Too many failed attempts, request a new code")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Password has been reset, please log in again",
+	})
+}
+
 func (h *Handler) Logout(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
@@ -120,7 +963,7 @@ func (h *Handler) Logout(c *fiber.Ctx) error {
 		return response.BadRequest(c, "Invalid request body")
 	}
 
-	if err := h.service.Logout(c.Context(), userID, req.RefreshToken); err != nil {
+	if err := h.service.Logout(c.Context(), userID, req.RefreshToken, c.Locals("accessToken").(AccessTokenInfo)); err != nil {
 		return response.InternalError(c, err)
 	}
 
@@ -129,6 +972,57 @@ func (h *Handler) Logout(c *fiber.Ctx) error {
 	})
 }
 
+func (h *Handler) GetSessions(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+	currentID, _ := uuid.Parse(c.Locals("sessionID").(string))
+
+	sessions, err := h.service.GetSessions(c.Context(), uid, currentID)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, sessions)
+}
+
+func (h *Handler) RevokeSession(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	sessionID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid session ID")
+	}
+
+	if err := h.service.RevokeSession(c.Context(), uid, sessionID); err != nil {
+		if err.Error() == "session not found" {
+			return response.Error(c, fiber.StatusNotFound, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions — "выйти на всех остальных устройствах"
+func (h *Handler) RevokeOtherSessions(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+	currentID, _ := uuid.Parse(c.Locals("sessionID").(string))
+
+	count, err := h.service.RevokeOtherSessions(c.Context(), uid, currentID)
+	if err != nil {
+		if err.Error() == "current session unknown" {
+			return response.BadRequest(c, "Current session unknown, please log in again")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Other sessions revoked",
+		"revoked": count,
+	})
+}
+
 func (h *Handler) ValidateToken(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 
@@ -143,6 +1037,12 @@ func (h *Handler) ValidateToken(c *fiber.Ctx) error {
 	})
 }
 
+// JWKS отдает открытые ключи подписи в формате RFC 7517
+func (h *Handler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.service.JWKS())
+}
+
 func (h *Handler) CheckUsername(c *fiber.Ctx) error {
 	// Для GET запроса
 	username := c.Query("username")
@@ -166,6 +1066,10 @@ func (h *Handler) CheckUsername(c *fiber.Ctx) error {
 			return response.BadRequest(c, "Last name must be 2-100 characters")
 		}
 
+		if ok, err := h.checkProofOfWork(c, PoWPurposeUsername); !ok {
+			return err
+		}
+
 		result, err := h.service.CheckUsernameAvailability(c.Context(), username, firstName, lastName)
 		if err != nil {
 			return response.InternalError(c, err)
@@ -184,6 +1088,10 @@ func (h *Handler) CheckUsername(c *fiber.Ctx) error {
 		return response.ValidationError(c, err)
 	}
 
+	if ok, err := h.checkProofOfWork(c, PoWPurposeUsername); !ok {
+		return err
+	}
+
 	result, err := h.service.CheckUsernameAvailability(c.Context(), req.Username, req.FirstName, req.LastName)
 	if err != nil {
 		return response.InternalError(c, err)
@@ -202,6 +1110,10 @@ func (h *Handler) SuggestUsernames(c *fiber.Ctx) error {
 		return response.ValidationError(c, err)
 	}
 
+	if ok, err := h.checkProofOfWork(c, PoWPurposeUsername); !ok {
+		return err
+	}
+
 	suggestions, err := h.service.GenerateUsernameSuggestions(c.Context(), req.FirstName, req.LastName)
 	if err != nil {
 		return response.InternalError(c, err)
@@ -221,11 +1133,29 @@ type RegisterRequest struct {
 	Password  string `json:"password" validate:"required,min=6"`
 }
 
+type PoWChallengeRequest struct {
+	Purpose string `json:"purpose" validate:"required,oneof=register username"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"` // TOTP или код восстановления
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type MFADisableRequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
@@ -233,12 +1163,78 @@ type RefreshRequest struct {
 type VerifyEmailRequest struct {
 	Email string `json:"email" validate:"required,email"`
 	Code  string `json:"code" validate:"required,len=6"`
+
+	// Если передан, в ответе придет новая пара токенов с подтвержденным email
+	RefreshToken string `json:"refresh_token"`
 }
 
 type ResendVerificationRequest struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
+type UnlockAccountRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type EmailLoginRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type EmailLoginVerifyRequest struct {
+	Token string `json:"token"`
+	Email string `json:"email" validate:"required_without=Token,omitempty,email"`
+	Code  string `json:"code" validate:"required_without=Token,omitempty,len=6"`
+}
+
+type PhoneVerifyRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type PhoneLoginRequest struct {
+	Phone string `json:"phone" validate:"required,e164"`
+}
+
+type PhoneLoginVerifyRequest struct {
+	Phone string `json:"phone" validate:"required,e164"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type EmailChangeRequest struct {
+	NewEmail string `json:"new_email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type EmailChangeConfirmRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type EmailChangeCancelRequest struct {
+	Token string `json:"token" form:"token" validate:"required"`
+}
+
+// CreateAPIKeyRequest — expires_in_days не задан: ключ действует 90 дней
+type CreateAPIKeyRequest struct {
+	Name            string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes          []string `json:"scopes" validate:"required,min=1,dive,oneof=calls:read meetings:read meetings:write contacts:read profile:read"`
+	ExpiresInDays   int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+	CurrentPassword string   `json:"current_password" validate:"required"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" validate:"required"`
+	State string `json:"state" validate:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Email       string `json:"email" validate:"required,email"`
+	Code        string `json:"code" validate:"required,len=6"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
 type LogoutRequest struct {
 	RefreshToken string `json:"refresh_token" validate:"required"`
 }
@@ -7,77 +7,161 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"q7o/config"
+	"q7o/internal/user"
+)
+
+const (
+	TokenTypeAccess      = "access"
+	TokenTypeRefresh     = "refresh"
+	TokenTypeMagicLink   = "magic_link"
+	TokenTypeDataExport  = "data_export"
+	TokenTypeEmailChange = "email_change"
+
+	tokenIssuer = "q7o"
 )
 
 type TokenClaims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	SessionID uuid.UUID `json:"sid"`            // строка sessions, к которой привязан токен
+	TokenType string    `json:"token_type"`     // access или refresh; пусто у устаревших HS256 токенов
+	Role      string    `json:"role,omitempty"` // пусто у токенов, выпущенных до появления ролей
+
+	// EmailVerified == false ограничивает доступ после VerifyBy (см. Middleware.RequireAuth)
+	EmailVerified bool             `json:"email_verified"`
+	VerifyBy      *jwt.NumericDate `json:"verify_by,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
+
+	// jti и срок жизни access токена — для списка отозванных токенов
+	accessID        string
+	accessExpiresAt time.Time
 }
 
-func GenerateTokenPair(userID uuid.UUID, username string, cfg config.JWTConfig) (*TokenPair, error) {
+// GenerateTokenPair выпускает пару токенов для сессии.
+// verifyBy — срок подтверждения email для неподтвержденных аккаунтов, нулевое значение — без срока.
+func (m *KeyManager) GenerateTokenPair(u *user.User, sessionID uuid.UUID, verifyBy time.Time) (*TokenPair, error) {
+	var verifyByClaim *jwt.NumericDate
+	if !u.EmailVerified && !verifyBy.IsZero() {
+		verifyByClaim = jwt.NewNumericDate(verifyBy)
+	}
+
 	// Access token
 	accessClaims := TokenClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:        u.ID,
+		Username:      u.Username,
+		SessionID:     sessionID,
+		TokenType:     TokenTypeAccess,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerified,
+		VerifyBy:      verifyByClaim,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.ExpireHours) * time.Hour)),
+			Issuer:    tokenIssuer,
+			Subject:   u.ID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(m.cfg.ExpireHours) * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ID:        uuid.New().String(),
 		},
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(cfg.Secret))
+	accessTokenString, err := m.Sign(accessClaims)
 	if err != nil {
 		return nil, err
 	}
 
 	// Refresh token
 	refreshClaims := TokenClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:    u.ID,
+		Username:  u.Username,
+		SessionID: sessionID,
+		TokenType: TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(cfg.RefreshDays) * 24 * time.Hour)),
+			Issuer:    tokenIssuer,
+			Subject:   u.ID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(m.cfg.RefreshDays) * 24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ID:        uuid.New().String(),
 		},
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(cfg.RefreshSecret))
+	refreshTokenString, err := m.Sign(refreshClaims)
 	if err != nil {
 		return nil, err
 	}
 
 	return &TokenPair{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
+		AccessToken:     accessTokenString,
+		RefreshToken:    refreshTokenString,
+		accessID:        accessClaims.ID,
+		accessExpiresAt: accessClaims.ExpiresAt.Time,
 	}, nil
 }
 
-func ValidateToken(tokenString string, secret string) (*TokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return []byte(secret), nil
+// GenerateScopedToken выпускает одноцелевой токен для ссылок из писем
+// (вход по ссылке, скачивание выгрузки). id — jti, по которому вызывающий код обеспечивает одноразовость.
+func (m *KeyManager) GenerateScopedToken(userID uuid.UUID, tokenType, id string, expiresAt time.Time) (string, error) {
+	return m.Sign(TokenClaims{
+		UserID:    userID,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   userID.String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        id,
+		},
 	})
+}
+
+// ParseScopedToken проверяет токен, выпущенный GenerateScopedToken.
+// Устаревшие HS256 токены не принимаются.
+func (m *KeyManager) ParseScopedToken(tokenString, tokenType string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+	if err := m.Parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.TokenType != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+	return claims, nil
+}
+
+// ParseToken проверяет access или refresh токен.
+// Токены, подписанные устаревшим HS256 секретом, принимаются, только пока секрет задан в конфиге
+// и не наступила дата отключения LegacyAcceptUntil.
+func (m *KeyManager) ParseToken(tokenString, tokenType string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+			secret := m.cfg.Secret
+			if tokenType == TokenTypeRefresh {
+				secret = m.cfg.RefreshSecret
+			}
+			if secret == "" || !time.Now().Before(m.cfg.LegacyAcceptUntil) {
+				return nil, errors.New("legacy tokens are not accepted")
+			}
+			return []byte(secret), nil
+		}
+		return m.verificationKey(token)
+	}, jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA, jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(*TokenClaims)
-	if !ok || !token.Valid {
+	if !token.Valid {
 		return nil, errors.New("invalid token")
 	}
 
+	// У асимметричных токенов тип обязателен, чтобы refresh нельзя было использовать как access
+	if _, legacy := token.Method.(*jwt.SigningMethodHMAC); !legacy && claims.TokenType != tokenType {
+		return nil, errors.New("invalid token type")
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"q7o/config"
+	"q7o/internal/common/utils"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	kidTimeLayout         = "20060102T150405"
+	keyRotationCheckEvery = time.Hour
+	keyReloadMinInterval  = 30 * time.Second
+)
+
+// signingKey — ключ из каталога ключей; Private == nil для ключей только для проверки
+type signingKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+	Path      string
+}
+
+// KeyManager хранит ключи подписи JWT, загруженные из cfg.KeysDir.
+// Подписывает самый новый приватный ключ настроенного алгоритма,
+// проверка выполняется любым загруженным ключом по заголовку kid.
+// Каталог может быть общим для нескольких инстансов.
+type KeyManager struct {
+	cfg config.JWTConfig
+
+	mu       sync.RWMutex
+	keys     map[string]*signingKey
+	current  *signingKey
+	loadedAt time.Time
+}
+
+func NewKeyManager(cfg config.JWTConfig) (*KeyManager, error) {
+	if cfg.Algorithm != AlgorithmRS256 && cfg.Algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	if err := os.MkdirAll(cfg.KeysDir, 0700); err != nil {
+		return nil, err
+	}
+
+	if (cfg.Secret != "" || cfg.RefreshSecret != "") && cfg.LegacyAcceptUntil.IsZero() {
+		log.Printf("JWT_SECRET is set but JWT_LEGACY_ACCEPT_UNTIL is not: legacy HS256 tokens are rejected")
+	}
+
+	m := &KeyManager{cfg: cfg}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	if m.needsRotation() {
+		if err := m.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// RunRotation периодически перечитывает каталог, выпускает новый ключ
+// по истечении RotationDays и удаляет ключи, которыми уже не может быть подписан ни один живой токен
+func (m *KeyManager) RunRotation(ctx context.Context) {
+	ticker := time.NewTicker(keyRotationCheckEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.load(); err != nil {
+				log.Printf("Failed to reload JWT keys: %v", err)
+				continue
+			}
+			if m.needsRotation() {
+				if err := m.rotate(); err != nil {
+					log.Printf("Failed to rotate JWT signing key: %v", err)
+				}
+			}
+			m.prune()
+		}
+	}
+}
+
+// Sign подписывает claims текущим ключом и проставляет kid
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key := m.current
+	m.mu.RUnlock()
+
+	if key == nil {
+		return "", errors.New("no signing key available")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// Parse проверяет токен, подписанный одним из асимметричных ключей, и заполняет claims
+func (m *KeyManager) Parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.verificationKey,
+		jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}),
+	)
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+func (m *KeyManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("missing kid")
+	}
+
+	key := m.lookup(kid)
+	if key == nil {
+		// Ключ мог быть выпущен другим инстансом после нашей последней загрузки
+		m.mu.RLock()
+		stale := time.Since(m.loadedAt) > keyReloadMinInterval
+		m.mu.RUnlock()
+		if stale {
+			if err := m.load(); err != nil {
+				log.Printf("Failed to reload JWT keys: %v", err)
+			}
+			key = m.lookup(kid)
+		}
+	}
+
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("signing method mismatch")
+	}
+
+	return key.Public, nil
+}
+
+func (m *KeyManager) lookup(kid string) *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.keys[kid]
+}
+
+// JWK — открытый ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает все ключи проверки для /.well-known/jwks.json
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		jwk := JWK{Use: "sig", Alg: key.Algorithm, Kid: key.ID}
+
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// load перечитывает каталог ключей
+func (m *KeyManager) load() error {
+	entries, err := os.ReadDir(m.cfg.KeysDir)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey)
+	var current *signingKey
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+
+		key, err := loadKeyFile(filepath.Join(m.cfg.KeysDir, entry.Name()))
+		if err != nil {
+			log.Printf("Skipping JWT key %s: %v", entry.Name(), err)
+			continue
+		}
+		keys[key.ID] = key
+
+		if key.Private != nil && key.Algorithm == m.cfg.Algorithm &&
+			(current == nil || key.CreatedAt.After(current.CreatedAt)) {
+			current = key
+		}
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.current = current
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *KeyManager) needsRotation() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.current == nil {
+		return true
+	}
+	if m.cfg.RotationDays <= 0 {
+		return false
+	}
+	return time.Since(m.current.CreatedAt) > time.Duration(m.cfg.RotationDays)*24*time.Hour
+}
+
+// rotate выпускает новый приватный ключ; он сразу становится ключом подписи
+func (m *KeyManager) rotate() error {
+	var private crypto.Signer
+	var err error
+
+	switch m.cfg.Algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+
+	kid := time.Now().UTC().Format(kidTimeLayout) + "-" + utils.GenerateToken(4)
+	path := filepath.Join(m.cfg.KeysDir, kid+".pem")
+
+	// Пишем во временный файл, чтобы другие инстансы не прочитали ключ наполовину
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	log.Printf("Generated new JWT signing key %s (%s)", kid, m.cfg.Algorithm)
+
+	return m.load()
+}
+
+// prune удаляет выведенные из оборота приватные ключи, после того как истекли
+// все подписанные ими токены. Ключи только для проверки (*.pub.pem) не трогаем.
+func (m *KeyManager) prune() {
+	m.mu.RLock()
+	current := m.current
+	var expired []*signingKey
+	retention := time.Duration(m.cfg.RotationDays)*24*time.Hour +
+		time.Duration(m.cfg.RefreshDays)*24*time.Hour + 24*time.Hour
+	for _, key := range m.keys {
+		if key == current || key.Private == nil {
+			continue
+		}
+		if time.Since(key.CreatedAt) > retention {
+			expired = append(expired, key)
+		}
+	}
+	m.mu.RUnlock()
+
+	if m.cfg.RotationDays <= 0 || len(expired) == 0 {
+		return
+	}
+
+	for _, key := range expired {
+		if err := os.Remove(key.Path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove JWT key %s: %v", key.ID, err)
+			continue
+		}
+		log.Printf("Removed retired JWT key %s", key.ID)
+	}
+
+	if err := m.load(); err != nil {
+		log.Printf("Failed to reload JWT keys: %v", err)
+	}
+}
+
+// loadKeyFile читает PEM ключ; kid — имя файла без .pem / .pub.pem
+func loadKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	name := filepath.Base(path)
+	kid := strings.TrimSuffix(strings.TrimSuffix(name, ".pem"), ".pub")
+	key := &signingKey{ID: kid, Path: path}
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm, key.Private, key.Public = AlgorithmRS256, k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Algorithm, key.Private, key.Public = AlgorithmEdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.Algorithm, key.Public = AlgorithmRS256, k
+	case ed25519.PublicKey:
+		key.Algorithm, key.Public = AlgorithmEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	// Время создания берем из kid, для ключей с произвольным именем — из mtime файла
+	if created, err := time.Parse(kidTimeLayout, strings.SplitN(kid, "-", 2)[0]); err == nil {
+		key.CreatedAt = created
+	} else if info, err := os.Stat(path); err == nil {
+		key.CreatedAt = info.ModTime()
+	}
+
+	return key, nil
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"q7o/internal/audit"
+	"q7o/internal/common/utils"
+	"q7o/internal/user"
+
+	"github.com/google/uuid"
+)
+
+// LockoutError — попытка входа отклонена до проверки пароля.
+// RetryAfter передается клиенту в заголовке Retry-After.
+type LockoutError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return e.Message
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (s *Service) failureWindow() time.Duration {
+	return time.Duration(s.security.FailureWindowMinutes) * time.Minute
+}
+
+// checkLoginAllowed проверяет блокировку аккаунта, лимит IP и текущую задержку.
+// email == "" — аккаунт неизвестен (например, чужой passkey), проверяется только IP.
+func (s *Service) checkLoginAllowed(ctx context.Context, email, ip string) error {
+	if email == "" {
+		return s.checkIPAllowed(ctx, ip)
+	}
+
+	if ttl, err := s.repo.KeyTTL(ctx, "login_lock:"+email); err != nil {
+		return err
+	} else if ttl > 0 {
+		return &LockoutError{Message: "account temporarily locked", RetryAfter: ttl}
+	}
+
+	if err := s.checkIPAllowed(ctx, ip); err != nil {
+		return err
+	}
+
+	if ttl, err := s.repo.KeyTTL(ctx, "login_backoff:"+email); err != nil {
+		return err
+	} else if ttl > 0 {
+		return &LockoutError{Message: "too many login attempts", RetryAfter: ttl}
+	}
+
+	return nil
+}
+
+func (s *Service) checkIPAllowed(ctx context.Context, ip string) error {
+	if ip == "" {
+		return nil
+	}
+	failures, ttl, err := s.repo.GetCounter(ctx, "login_fail:ip:"+ip)
+	if err != nil {
+		return err
+	}
+	if failures >= int64(s.security.LoginMaxIPFailures) {
+		return &LockoutError{Message: "too many login attempts", RetryAfter: ttl}
+	}
+	return nil
+}
+
+// recordLoginFailure учитывает неудачную попытку: после LoginFreeAttempts вводит
+// экспоненциальную задержку, после LoginMaxFailures блокирует аккаунт и отправляет письмо для разблокировки.
+// u == nil, если аккаунта с таким email нет — счетчики ведутся одинаково, чтобы не раскрывать это.
+func (s *Service) recordLoginFailure(ctx context.Context, email, ip string, u *user.User) error {
+	userID := uuid.Nil
+	if u != nil {
+		userID = u.ID
+	}
+	s.auditLog.RecordClient(ctx, userID, audit.EventLoginFailure, ip, "", map[string]interface{}{
+		"email": email,
+	})
+
+	if ip != "" {
+		if _, err := s.repo.IncrementCounter(ctx, "login_fail:ip:"+ip, s.failureWindow()); err != nil {
+			return err
+		}
+	}
+
+	if email == "" {
+		return errors.New("invalid credentials")
+	}
+
+	failures, err := s.repo.IncrementCounter(ctx, "login_fail:acct:"+email, s.failureWindow())
+	if err != nil {
+		return err
+	}
+
+	if failures >= int64(s.security.LoginMaxFailures) {
+		return s.lockAccount(ctx, email, ip, failures, u)
+	}
+
+	if over := failures - int64(s.security.LoginFreeAttempts); over > 0 {
+		maxDelay := time.Duration(s.security.BackoffMaxSeconds) * time.Second
+		delay := maxDelay
+		if over < 16 {
+			delay = time.Second << (over - 1) // 1s, 2s, 4s, ...
+		}
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		if err := s.repo.SetKey(ctx, "login_backoff:"+email, 1, delay); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("invalid credentials")
+}
+
+// lockAccount блокирует аккаунт на LockoutMinutes; письмо для разблокировки уходит один раз за блокировку
+func (s *Service) lockAccount(ctx context.Context, email, ip string, failures int64, u *user.User) error {
+	lockout := time.Duration(s.security.LockoutMinutes) * time.Minute
+	locked, err := s.repo.SetKeyNX(ctx, "login_lock:"+email, 1, lockout)
+	if err != nil {
+		return err
+	}
+	if locked {
+		log.Printf("SECURITY: account %s locked after %d failed logins (last ip=%s)", email, failures, ip)
+		if u != nil {
+			s.sendUnlockEmail(ctx, u, email, lockout)
+		}
+	}
+	return &LockoutError{Message: "account temporarily locked", RetryAfter: lockout}
+}
+
+// recordMFAFailure учитывает неверный код второго фактора. Счетчик mfa_fail ведется на пользователя,
+// общий для всех челленджей, и не сбрасывается верным паролем — иначе перебор TOTP
+// можно продолжать, запрашивая новые челленджи. Ошибка также идет в счетчики входа по email.
+func (s *Service) recordMFAFailure(ctx context.Context, u *user.User, ip string) error {
+	email := normalizeEmail(u.Email)
+
+	failures, err := s.repo.IncrementCounter(ctx, "mfa_fail:"+u.ID.String(), s.failureWindow())
+	if err != nil {
+		return err
+	}
+	if failures >= int64(s.security.LoginMaxFailures) {
+		return s.lockAccount(ctx, email, ip, failures, u)
+	}
+
+	return s.failLogin(ctx, email, ip, u, errors.New("invalid code"))
+}
+
+// failLogin учитывает неудачный вход без пароля (код, passkey, второй фактор) в общих счетчиках
+// и возвращает cause, если аккаунт не заблокирован
+func (s *Service) failLogin(ctx context.Context, email, ip string, u *user.User, cause error) error {
+	if err := s.recordLoginFailure(ctx, email, ip, u); err != nil && err.Error() != "invalid credentials" {
+		return err
+	}
+	return cause
+}
+
+// clearLoginFailures сбрасывает счетчики аккаунта после успешного входа (счетчик IP остается)
+func (s *Service) clearLoginFailures(ctx context.Context, email string) {
+	s.repo.DeleteKeys(ctx, "login_fail:acct:"+email, "login_backoff:"+email)
+}
+
+func (s *Service) sendUnlockEmail(ctx context.Context, u *user.User, email string, lockout time.Duration) {
+	token := utils.GenerateToken(32)
+	if err := s.repo.SetKey(ctx, "login_unlock:"+utils.HashToken(token), email, lockout); err != nil {
+		log.Printf("Failed to store unlock token for %s: %v", email, err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/api/v1/auth/unlock?token=%s", s.appURL, token)
+	fullName := u.FirstName + " " + u.LastName
+	go s.emailService.SendAccountLockedEmail(u.Email, fullName, link, int(lockout.Minutes()))
+}
+
+// UnlockAccount снимает блокировку по токену из письма
+func (s *Service) UnlockAccount(ctx context.Context, token string) error {
+	email, err := s.repo.TakeKey(ctx, "login_unlock:"+utils.HashToken(token))
+	if err != nil {
+		return errors.New("invalid or expired unlock token")
+	}
+
+	keys := []string{"login_lock:" + email, "login_fail:acct:" + email, "login_backoff:" + email}
+	if u, err := s.userRepo.FindByEmail(ctx, email); err == nil {
+		keys = append(keys, "mfa_fail:"+u.ID.String())
+	}
+	return s.repo.DeleteKeys(ctx, keys...)
+}
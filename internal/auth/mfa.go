@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/common/utils"
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+)
+
+// SetupMFA создает новый TOTP секрет; MFA включается только после EnableMFA
+func (s *Service) SetupMFA(ctx context.Context, userID uuid.UUID) (*MFASetupResponse, error) {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	enabled, err := s.repo.IsMFAEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("mfa already enabled")
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveMFASecret(ctx, userID, secret); err != nil {
+		return nil, err
+	}
+
+	return &MFASetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(secret, u.Email),
+	}, nil
+}
+
+// EnableMFA подтверждает привязку аутентификатора и возвращает коды восстановления
+func (s *Service) EnableMFA(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil {
+		return nil, errors.New("mfa setup not started")
+	}
+
+	if mfa.Enabled {
+		return nil, errors.New("mfa already enabled")
+	}
+
+	if !s.checkTOTP(ctx, mfa, code) {
+		return nil, errors.New("invalid code")
+	}
+
+	if err := s.repo.EnableMFA(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return s.generateRecoveryCodes(ctx, userID)
+}
+
+// DisableMFA отключает MFA после проверки пароля и текущего кода
+func (s *Service) DisableMFA(ctx context.Context, userID uuid.UUID, password, code string) error {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+
+	if !utils.CheckPassword(password, u.PasswordHash) {
+		return errors.New("invalid credentials")
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil || !mfa.Enabled {
+		return errors.New("mfa not enabled")
+	}
+
+	if !s.checkSecondFactor(ctx, mfa, code) {
+		return errors.New("invalid code")
+	}
+
+	return s.repo.DeleteMFA(ctx, userID)
+}
+
+// RegenerateRecoveryCodes выпускает новый набор кодов, старые перестают действовать
+func (s *Service) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil || !mfa.Enabled {
+		return nil, errors.New("mfa not enabled")
+	}
+
+	if !s.checkTOTP(ctx, mfa, code) {
+		return nil, errors.New("invalid code")
+	}
+
+	return s.generateRecoveryCodes(ctx, userID)
+}
+
+func (s *Service) GetMFAStatus(ctx context.Context, userID uuid.UUID) (*MFAStatusResponse, error) {
+	enabled, err := s.repo.IsMFAEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MFAStatusResponse{Enabled: enabled}
+	if enabled {
+		status.RecoveryCodesRemaining, _ = s.repo.CountRecoveryCodes(ctx, userID)
+	}
+
+	return status, nil
+}
+
+// VerifyMFA обменивает челлендж "mfa_pending" и код (TOTP или восстановления) на пару токенов
+func (s *Service) VerifyMFA(ctx context.Context, challenge, code string, client ClientInfo) (*LoginResult, error) {
+	userID, err := s.repo.GetMFAChallenge(ctx, challenge)
+	if err != nil {
+		return nil, errors.New("invalid or expired mfa token")
+	}
+
+	attemptsKey := fmt.Sprintf("mfa_pending:attempts:%s", challenge)
+	attempts, err := s.repo.IncrementCounter(ctx, attemptsKey, mfaChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > mfaChallengeMaxAttempts {
+		s.repo.DeleteMFAChallenge(ctx, challenge)
+		return nil, errors.New("invalid or expired mfa token")
+	}
+
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	// Блокировка аккаунта действует и на второй фактор
+	email := normalizeEmail(u.Email)
+	if err := s.checkLoginAllowed(ctx, email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.repo.GetUserMFA(ctx, userID)
+	if err != nil || !mfa.Enabled {
+		return nil, errors.New("invalid or expired mfa token")
+	}
+
+	if !s.checkSecondFactor(ctx, mfa, code) {
+		return nil, s.recordMFAFailure(ctx, u, client.IPAddress)
+	}
+
+	s.repo.DeleteMFAChallenge(ctx, challenge)
+	s.repo.DeleteKeys(ctx, "mfa_fail:"+userID.String())
+	s.clearLoginFailures(ctx, email)
+
+	return s.finishLogin(ctx, u, client)
+}
+
+// checkSecondFactor принимает TOTP код или одноразовый код восстановления
+func (s *Service) checkSecondFactor(ctx context.Context, mfa *UserMFA, code string) bool {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.checkTOTP(ctx, mfa, code)
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, mfa.UserID, utils.HashToken(normalizeRecoveryCode(code)))
+	return err == nil && used
+}
+
+func (s *Service) checkTOTP(ctx context.Context, mfa *UserMFA, code string) bool {
+	step, ok := validateTOTP(mfa.Secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return false
+	}
+
+	// Один и тот же код нельзя использовать дважды
+	fresh, err := s.repo.MarkTOTPStepUsed(ctx, mfa.UserID, step)
+	return err == nil && fresh
+}
+
+func (s *Service) generateRecoveryCodes(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// randomRecoveryCode генерирует код вида xxxxx-xxxxx
+func randomRecoveryCode() (string, error) {
+	const charset = "abcdefghjkmnpqrstuvwxyz23456789"
+	b := make([]byte, 10)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return "", err
+		}
+		b[i] = charset[n.Int64()]
+	}
+	return string(b[:5]) + "-" + string(b[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
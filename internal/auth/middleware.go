@@ -1,37 +1,196 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"q7o/config"
+	"q7o/internal/user"
 	"strings"
+	"time"
 )
 
-func RequireAuth(cfg config.JWTConfig) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Authorization header required",
-			})
+// Middleware проверяет access токены для HTTP маршрутов и WebSocket
+type Middleware struct {
+	keys              *KeyManager
+	repo              *Repository
+	emailVerification config.EmailVerificationConfig
+}
+
+func NewMiddleware(keys *KeyManager, repo *Repository, emailVerification config.EmailVerificationConfig) *Middleware {
+	return &Middleware{
+		keys:              keys,
+		repo:              repo,
+		emailVerification: emailVerification,
+	}
+}
+
+// Authenticate проверяет access token, включая список отозванных jti и блокировку аккаунта, и возвращает его claims
+func (m *Middleware) Authenticate(ctx context.Context, token string) (*TokenClaims, error) {
+	claims, err := m.keys.ParseToken(token, TokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID != "" {
+		revoked, err := m.repo.IsAccessTokenRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, errors.New("token revoked")
 		}
+	}
+
+	suspended, err := m.repo.IsUserSuspended(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if suspended {
+		return nil, errors.New("account suspended")
+	}
+
+	return claims, nil
+}
+
+// AuthenticateWebSocket — Authenticate для WebSocket: после льготного периода
+// неподтвержденный email закрывает доступ так же, как в RequireAuth
+func (m *Middleware) AuthenticateWebSocket(ctx context.Context, token string) (*TokenClaims, error) {
+	claims, err := m.Authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if m.verificationPending(claims) {
+		return nil, errors.New("email verification required")
+	}
+	return claims, nil
+}
+
+func (m *Middleware) RequireAuth(c *fiber.Ctx) error {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Authorization header required",
+		})
+	}
+
+	tokenParts := strings.Split(authHeader, " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid authorization header format",
+		})
+	}
+
+	if isAPIKey(tokenParts[1]) {
+		return m.requireAPIKey(c, tokenParts[1])
+	}
 
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization header format",
+	claims, err := m.Authenticate(c.Context(), tokenParts[1])
+	if err != nil {
+		if err.Error() == "account suspended" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account suspended",
 			})
 		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid token",
+		})
+	}
 
-		claims, err := ValidateToken(tokenParts[1], cfg.Secret)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid token",
+	if m.verificationPending(claims) && !m.allowedUnverified(c.Path()) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Email verification required",
+		})
+	}
+
+	c.Locals("userID", claims.UserID.String())
+	c.Locals("username", claims.Username)
+	c.Locals("role", roleOf(claims))
+	c.Locals("sessionID", claims.SessionID.String())
+	c.Locals("accessToken", accessTokenInfo(claims))
+
+	return c.Next()
+}
+
+// requireAPIKey пропускает запрос по API ключу на маршруты из apiKeyRoutes.
+// Locals заполняются так же, как для JWT, но без сессии и с ролью обычного пользователя.
+func (m *Middleware) requireAPIKey(c *fiber.Ctx, secret string) error {
+	key, err := m.AuthenticateAPIKey(c.Context(), secret, c.Method(), c.Path(), c.IP())
+	if err != nil {
+		switch err.Error() {
+		case "account suspended":
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account suspended",
 			})
+		case "api key not allowed":
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This endpoint does not accept API keys",
+			})
+		case "insufficient scope":
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "API key does not have the required scope",
+			})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid API key",
+		})
+	}
+
+	c.Locals("userID", key.UserID.String())
+	c.Locals("username", key.Username)
+	c.Locals("role", user.RoleUser)
+	c.Locals("sessionID", uuid.Nil.String())
+	c.Locals("accessToken", AccessTokenInfo{ExpiresAt: time.Now()})
+	c.Locals("apiKeyID", key.ID.String())
+
+	return c.Next()
+}
+
+// verificationPending — email не подтвержден, и льготный период закончился.
+// Устаревшие HS256 токены не несут этого claim и не ограничиваются.
+func (m *Middleware) verificationPending(claims *TokenClaims) bool {
+	if !m.emailVerification.Required || claims.EmailVerified || claims.TokenType == "" {
+		return false
+	}
+	return claims.VerifyBy == nil || time.Now().After(claims.VerifyBy.Time)
+}
+
+// allowedUnverified проверяет путь по списку EmailVerification.AllowedPaths
+func (m *Middleware) allowedUnverified(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, allowed := range m.emailVerification.AllowedPaths {
+		if matchPath(path, allowed) {
+			return true
 		}
+	}
+	return false
+}
 
-		c.Locals("userID", claims.UserID.String())
-		c.Locals("username", claims.Username)
+// matchPath сравнивает путь с шаблоном; "/*" в конце шаблона — префикс
+func matchPath(path, pattern string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+	return path == strings.TrimSuffix(pattern, "/")
+}
+
+func accessTokenInfo(claims *TokenClaims) AccessTokenInfo {
+	info := AccessTokenInfo{
+		ID:        claims.ID,
+		SessionID: claims.SessionID,
+		ExpiresAt: time.Now(),
+	}
+	if claims.ExpiresAt != nil {
+		info.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return info
+}
 
-		return c.Next()
+// roleOf — роль из access токена; устаревшие HS256 токены всегда получают роль обычного пользователя
+func roleOf(claims *TokenClaims) string {
+	if claims.TokenType == "" || claims.Role == "" {
+		return user.RoleUser
 	}
+	return claims.Role
 }
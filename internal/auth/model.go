@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/user"
+)
+
+// ClientInfo — сведения об устройстве, с которого выполняется вход
+type ClientInfo struct {
+	DeviceInfo string
+	IPAddress  string
+}
+
+// AccessTokenInfo — сведения о предъявленном access токене, которые middleware кладет в locals
+type AccessTokenInfo struct {
+	ID        string
+	SessionID uuid.UUID
+	ExpiresAt time.Time
+}
+
+// Session — активная сессия (устройство) пользователя
+type Session struct {
+	ID              uuid.UUID  `json:"id"`
+	DeviceInfo      string     `json:"device_info"`
+	IPAddress       string     `json:"ip_address"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	Current         bool       `json:"current"`
+}
+
+// RefreshToken — выданный refresh token; все токены одной сессии образуют семейство
+type RefreshToken struct {
+	ID        uuid.UUID
+	SessionID uuid.UUID
+	UserID    uuid.UUID
+	ParentID  *uuid.UUID
+	RotatedAt *time.Time
+	ExpiresAt time.Time
+}
+
+type PasswordReset struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	Attempts  int
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// LoginResult — результат входа: либо пара токенов, либо MFA-челлендж
+type LoginResult struct {
+	User         *user.UserResponse `json:"user,omitempty"`
+	AccessToken  string             `json:"access_token,omitempty"`
+	RefreshToken string             `json:"refresh_token,omitempty"`
+	MFARequired  bool               `json:"mfa_required,omitempty"`
+	MFAToken     string             `json:"mfa_token,omitempty"`
+	ExpiresIn    int                `json:"expires_in,omitempty"`
+
+	// Вход отменил запланированное удаление аккаунта
+	DeletionCancelled bool `json:"deletion_cancelled,omitempty"`
+}
+
+type UserMFA struct {
+	UserID      uuid.UUID
+	Secret      string
+	Enabled     bool
+	ConfirmedAt *time.Time
+	CreatedAt   time.Time
+}
+
+type MFASetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFAStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// WebAuthnCredential — зарегистрированный passkey пользователя
+type WebAuthnCredential struct {
+	ID              uuid.UUID
+	UserID          uuid.UUID
+	CredentialID    []byte
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	BackupState     bool
+	Name            string
+	CreatedAt       time.Time
+	LastUsedAt      *time.Time
+}
+
+type PasskeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// APIKey — персональный ключ для скриптов и интеграций; в БД хранится только хеш
+type APIKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIP string
+	CreatedAt  time.Time
+
+	// Владелец ключа, для проверки в middleware
+	Username     string
+	AccountState string
+}
+
+type APIKeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKeyResponse — ответ на создание ключа; сам ключ больше нигде не показывается
+type CreatedAPIKeyResponse struct {
+	*APIKeyResponse
+	Key string `json:"key"`
+}
+
+// PoWChallenge — задача proof-of-work: найти nonce, при котором SHA-256("<challenge>:<nonce>")
+// начинается с difficulty нулевых бит. Решение передается в заголовке X-PoW-Solution: <challenge>:<nonce>
+type PoWChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	Algorithm  string    `json:"algorithm"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// UserIdentity — аккаунт у внешнего OIDC провайдера, привязанный к пользователю
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"-"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+type OIDCProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+}
+
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
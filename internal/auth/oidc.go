@@ -0,0 +1,361 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+	"q7o/config"
+	"q7o/internal/common/utils"
+	"q7o/internal/user"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// oidcProvider — провайдер из реестра. Discovery выполняется при первом обращении,
+// чтобы недоступный провайдер не мешал запуску сервера.
+type oidcProvider struct {
+	cfg config.OIDCProviderConfig
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// oidcState хранится в Redis между редиректом к провайдеру и callback
+type oidcState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// oidcClaims — нужные нам claims ID токена
+type oidcClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"` // bool, у некоторых провайдеров — строка "true"
+	GivenName     string      `json:"given_name"`
+	FamilyName    string      `json:"family_name"`
+	Name          string      `json:"name"`
+}
+
+func (c *oidcClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func newOIDCProviders(providers []config.OIDCProviderConfig) map[string]*oidcProvider {
+	registry := make(map[string]*oidcProvider, len(providers))
+	for _, cfg := range providers {
+		if cfg.IssuerURL == "" || cfg.ClientID == "" {
+			log.Printf("OIDC provider %s skipped: issuer and client ID are required", cfg.Name)
+			continue
+		}
+		registry[cfg.Name] = &oidcProvider{cfg: cfg}
+	}
+	return registry
+}
+
+// SetOIDCHTTPClient задает HTTP клиент для обращений к провайдерам
+// (например, с доверием к сертификату локального тестового issuer)
+func (s *Service) SetOIDCHTTPClient(client *http.Client) {
+	s.oidcHTTPClient = client
+}
+
+func (s *Service) oidcContext(ctx context.Context) context.Context {
+	if s.oidcHTTPClient != nil {
+		return oidc.ClientContext(ctx, s.oidcHTTPClient)
+	}
+	return ctx
+}
+
+func (p *oidcProvider) discover(ctx context.Context) (*oidc.Provider, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.provider == nil {
+		provider, err := oidc.NewProvider(ctx, p.cfg.IssuerURL)
+		if err != nil {
+			return nil, err
+		}
+		p.provider = provider
+	}
+	return p.provider, nil
+}
+
+func (p *oidcProvider) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}
+}
+
+func (s *Service) lookupOIDCProvider(ctx context.Context, name string) (*oidcProvider, *oidc.Provider, error) {
+	p, ok := s.oidcProviders[name]
+	if !ok {
+		return nil, nil, errors.New("unknown provider")
+	}
+
+	provider, err := p.discover(s.oidcContext(ctx))
+	if err != nil {
+		log.Printf("OIDC discovery failed for %s: %v", name, err)
+		return nil, nil, errors.New("provider unavailable")
+	}
+	return p, provider, nil
+}
+
+// ListOIDCProviders возвращает провайдеров, доступных для входа
+func (s *Service) ListOIDCProviders() []OIDCProviderResponse {
+	providers := make([]OIDCProviderResponse, 0, len(s.oidcProviders))
+	for _, cfg := range s.oidcConfig {
+		if _, ok := s.oidcProviders[cfg.Name]; ok {
+			providers = append(providers, OIDCProviderResponse{Name: cfg.Name, DisplayName: cfg.DisplayName})
+		}
+	}
+	return providers
+}
+
+// BeginOIDCLogin возвращает адрес авторизации провайдера (code flow с PKCE)
+func (s *Service) BeginOIDCLogin(ctx context.Context, name string) (*OIDCAuthorization, error) {
+	p, provider, err := s.lookupOIDCProvider(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	state := utils.GenerateToken(32)
+	st := oidcState{
+		Provider:     name,
+		Nonce:        utils.GenerateToken(32),
+		CodeVerifier: oauth2.GenerateVerifier(),
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetKey(ctx, "oidc:state:"+state, data, oidcStateTTL); err != nil {
+		return nil, err
+	}
+
+	authURL := p.oauth2Config(provider).AuthCodeURL(state,
+		oidc.Nonce(st.Nonce),
+		oauth2.S256ChallengeOption(st.CodeVerifier),
+	)
+
+	return &OIDCAuthorization{AuthorizationURL: authURL, State: state}, nil
+}
+
+// FinishOIDCLogin обменивает код на токены провайдера, проверяет ID токен
+// и входит в привязанный аккаунт (создавая или привязывая его при первом входе)
+func (s *Service) FinishOIDCLogin(ctx context.Context, name, code, state string, client ClientInfo) (*LoginResult, error) {
+	data, err := s.repo.TakeKey(ctx, "oidc:state:"+state)
+	if err != nil {
+		return nil, errors.New("invalid or expired state")
+	}
+
+	var st oidcState
+	if err := json.Unmarshal([]byte(data), &st); err != nil || st.Provider != name {
+		return nil, errors.New("invalid or expired state")
+	}
+
+	subject, claims, err := s.exchangeOIDCCode(ctx, name, code, &st)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := s.resolveOIDCUser(ctx, name, subject, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, u, client)
+}
+
+// exchangeOIDCCode обменивает код на токены провайдера и возвращает subject и claims проверенного ID токена
+func (s *Service) exchangeOIDCCode(ctx context.Context, name, code string, st *oidcState) (string, *oidcClaims, error) {
+	p, provider, err := s.lookupOIDCProvider(ctx, name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	octx := s.oidcContext(ctx)
+	token, err := p.oauth2Config(provider).Exchange(octx, code, oauth2.VerifierOption(st.CodeVerifier))
+	if err != nil {
+		log.Printf("OIDC code exchange failed for %s: %v", name, err)
+		return "", nil, errors.New("authorization failed")
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", nil, errors.New("authorization failed")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID}).Verify(octx, rawIDToken)
+	if err != nil {
+		log.Printf("OIDC ID token rejected for %s: %v", name, err)
+		return "", nil, errors.New("invalid id token")
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(st.Nonce)) != 1 {
+		return "", nil, errors.New("invalid id token")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return "", nil, errors.New("invalid id token")
+	}
+
+	return idToken.Subject, &claims, nil
+}
+
+// resolveOIDCUser находит пользователя по привязанной identity, иначе — по подтвержденному
+// провайдером email; если аккаунта нет, создает новый
+func (s *Service) resolveOIDCUser(ctx context.Context, provider, subject string, claims *oidcClaims) (*user.User, error) {
+	identity, err := s.repo.FindIdentity(ctx, provider, subject)
+	if err == nil {
+		s.repo.TouchIdentity(ctx, identity.ID, claims.Email)
+		return s.userRepo.FindByID(ctx, identity.UserID)
+	}
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.emailVerified() {
+		return nil, errors.New("email not verified by provider")
+	}
+
+	u, err := s.userRepo.FindByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if err := s.linkUnverifiedAccount(ctx, u, provider); err != nil {
+			return nil, err
+		}
+	case err == sql.ErrNoRows:
+		if u, err = s.createOIDCUser(ctx, claims); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := s.repo.CreateIdentity(ctx, &UserIdentity{
+		ID:          uuid.New(),
+		UserID:      u.ID,
+		Provider:    provider,
+		Subject:     subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// linkUnverifiedAccount: аккаунт с неподтвержденным email мог зарегистрировать кто угодно.
+// Провайдер подтвердил владение адресом, поэтому email помечается подтвержденным,
+// а пароль и сессии того, кто регистрировался, сбрасываются.
+func (s *Service) linkUnverifiedAccount(ctx context.Context, u *user.User, provider string) error {
+	if u.EmailVerified {
+		return nil
+	}
+
+	log.Printf("SECURITY: %s identity claimed unverified account %s, resetting password and sessions", provider, u.ID)
+
+	hashedPassword, err := utils.HashPassword(utils.GenerateToken(32))
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, u.ID, hashedPassword); err != nil {
+		return err
+	}
+	if err := s.RevokeAllSessions(ctx, u.ID); err != nil {
+		return err
+	}
+	if err := s.userRepo.VerifyEmail(ctx, u.ID); err != nil {
+		return err
+	}
+
+	u.EmailVerified = true
+	return nil
+}
+
+func (s *Service) createOIDCUser(ctx context.Context, claims *oidcClaims) (*user.User, error) {
+	firstName, lastName := strings.TrimSpace(claims.GivenName), strings.TrimSpace(claims.FamilyName)
+	if firstName == "" && lastName == "" {
+		parts := strings.Fields(claims.Name)
+		if len(parts) > 0 {
+			firstName, lastName = parts[0], strings.Join(parts[1:], " ")
+		}
+	}
+	if firstName == "" {
+		firstName = strings.Split(claims.Email, "@")[0]
+	}
+
+	// Пароля у такого аккаунта нет; при необходимости его можно задать через восстановление
+	hashedPassword, err := utils.HashPassword(utils.GenerateToken(32))
+	if err != nil {
+		return nil, err
+	}
+
+	newUser := &user.User{
+		ID:           uuid.New(),
+		Username:     s.pickUsername(ctx, firstName, lastName, claims.Email),
+		FirstName:    firstName,
+		LastName:     lastName,
+		Email:        claims.Email,
+		PasswordHash: hashedPassword,
+		Status:       "offline",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if err := s.userRepo.Create(ctx, newUser); err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.VerifyEmail(ctx, newUser.ID); err != nil {
+		return nil, err
+	}
+
+	newUser.EmailVerified = true
+	return newUser, nil
+}
+
+// ListIdentities возвращает привязанные к пользователю внешние аккаунты
+func (s *Service) ListIdentities(ctx context.Context, userID uuid.UUID) ([]*UserIdentity, error) {
+	identities, err := s.repo.GetIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if identities == nil {
+		identities = []*UserIdentity{}
+	}
+	return identities, nil
+}
+
+func (s *Service) UnlinkIdentity(ctx context.Context, userID uuid.UUID, provider string) error {
+	deleted, err := s.repo.DeleteIdentity(ctx, userID, provider)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("identity not found")
+	}
+	return nil
+}
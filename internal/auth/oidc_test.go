@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"q7o/config"
+)
+
+const (
+	testOIDCClientID = "q7o-test"
+	testOIDCCode     = "test-code"
+	testOIDCKeyID    = "test-key"
+)
+
+// mockIssuer — минимальный OIDC провайдер: discovery, JWKS и token endpoint
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// claims ID токена, который выдаст token endpoint
+	nonce    string
+	audience string
+	verifier string // ожидаемый PKCE code_verifier
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	m := &mockIssuer{key: key, audience: testOIDCClientID}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                m.server.URL,
+			"authorization_endpoint":                m.server.URL + "/authorize",
+			"token_endpoint":                        m.server.URL + "/token",
+			"jwks_uri":                              m.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": testOIDCKeyID,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.handleToken(t))
+
+	m.server = httptest.NewTLSServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) handleToken(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("code") != testOIDCCode || r.PostForm.Get("code_verifier") != m.verifier {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            m.server.URL,
+			"sub":            "subject-1",
+			"aud":            m.audience,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          m.nonce,
+			"email":          "Alice@Example.com",
+			"email_verified": "true",
+			"given_name":     "Alice",
+		})
+		idToken.Header["kid"] = testOIDCKeyID
+		signed, err := idToken.SignedString(m.key)
+		if err != nil {
+			t.Errorf("sign id token: %v", err)
+			http.Error(w, "sign failed", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     signed,
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func newOIDCTestService(m *mockIssuer) *Service {
+	s := &Service{
+		oidcProviders: newOIDCProviders([]config.OIDCProviderConfig{{
+			Name:        "mock",
+			IssuerURL:   m.server.URL,
+			ClientID:    testOIDCClientID,
+			RedirectURL: "https://q7o.test/callback",
+			Scopes:      []string{"openid", "email", "profile"},
+		}}),
+	}
+	s.SetOIDCHTTPClient(m.server.Client())
+	return s
+}
+
+func TestExchangeOIDCCode(t *testing.T) {
+	m := newMockIssuer(t)
+	s := newOIDCTestService(m)
+
+	st := &oidcState{Provider: "mock", Nonce: "nonce-1", CodeVerifier: oauth2.GenerateVerifier()}
+	m.nonce, m.verifier = st.Nonce, st.CodeVerifier
+
+	subject, claims, err := s.exchangeOIDCCode(context.Background(), "mock", testOIDCCode, st)
+	if err != nil {
+		t.Fatalf("exchangeOIDCCode: %v", err)
+	}
+	if subject != "subject-1" {
+		t.Errorf("subject = %q, want subject-1", subject)
+	}
+	if claims.Email != "Alice@Example.com" || !claims.emailVerified() || claims.GivenName != "Alice" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+}
+
+func TestExchangeOIDCCodeRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(m *mockIssuer, st *oidcState)
+		code    string
+		wantErr string
+	}{
+		{
+			name:    "nonce mismatch",
+			setup:   func(m *mockIssuer, st *oidcState) { m.nonce = "other" },
+			code:    testOIDCCode,
+			wantErr: "invalid id token",
+		},
+		{
+			name:    "wrong audience",
+			setup:   func(m *mockIssuer, st *oidcState) { m.audience = "another-client" },
+			code:    testOIDCCode,
+			wantErr: "invalid id token",
+		},
+		{
+			name:    "wrong code verifier",
+			setup:   func(m *mockIssuer, st *oidcState) { m.verifier = "other" },
+			code:    testOIDCCode,
+			wantErr: "authorization failed",
+		},
+		{
+			name:    "unknown code",
+			code:    "bad-code",
+			wantErr: "authorization failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIssuer(t)
+			s := newOIDCTestService(m)
+
+			st := &oidcState{Provider: "mock", Nonce: "nonce-1", CodeVerifier: oauth2.GenerateVerifier()}
+			m.nonce, m.verifier = st.Nonce, st.CodeVerifier
+			if tt.setup != nil {
+				tt.setup(m, st)
+			}
+
+			_, _, err := s.exchangeOIDCCode(context.Background(), "mock", tt.code, st)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLookupOIDCProviderUnknown(t *testing.T) {
+	m := newMockIssuer(t)
+	s := newOIDCTestService(m)
+
+	if _, _, err := s.lookupOIDCProvider(context.Background(), "missing"); err == nil || err.Error() != "unknown provider" {
+		t.Fatalf("err = %v, want unknown provider", err)
+	}
+}
@@ -0,0 +1,309 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"q7o/config"
+	"q7o/internal/common/utils"
+	"q7o/internal/user"
+)
+
+const (
+	webAuthnSessionTTL = 5 * time.Minute
+	maxPasskeysPerUser = 10
+)
+
+// NewWebAuthn создает Relying Party для passkeys.
+// Аттестация не запрашивается ("none"): нам важен только открытый ключ.
+func NewWebAuthn(cfg config.WebAuthnConfig) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:                  cfg.RPID,
+		RPDisplayName:         cfg.RPDisplayName,
+		RPOrigins:             cfg.RPOrigins,
+		AttestationPreference: protocol.PreferNoAttestation,
+	})
+}
+
+// SetWebAuthn включает вход по passkeys
+func (s *Service) SetWebAuthn(w *webauthn.WebAuthn) {
+	s.webAuthn = w
+}
+
+// webAuthnUser адаптирует пользователя к интерфейсу webauthn.User.
+// В качестве user handle используется UUID пользователя.
+type webAuthnUser struct {
+	user        *user.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	id := u.user.ID
+	return id[:]
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.user.FirstName + " " + u.user.LastName)
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (s *Service) loadWebAuthnUser(ctx context.Context, userID uuid.UUID) (*webAuthnUser, error) {
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	creds, err := s.repo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	wu := &webAuthnUser{user: u}
+	for _, cred := range creds {
+		wu.credentials = append(wu.credentials, toWebAuthnCredential(cred))
+	}
+	return wu, nil
+}
+
+// BeginPasskeyRegistration выдает параметры для navigator.credentials.create()
+func (s *Service) BeginPasskeyRegistration(ctx context.Context, userID uuid.UUID) (*protocol.CredentialCreation, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("passkeys not configured")
+	}
+
+	wu, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wu.credentials) >= maxPasskeysPerUser {
+		return nil, errors.New("too many passkeys")
+	}
+
+	options, session, err := s.webAuthn.BeginRegistration(wu,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(wu.credentials).CredentialDescriptors()),
+		webauthn.WithConveyancePreference(protocol.PreferNoAttestation),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveWebAuthnSession(ctx, "register:"+userID.String(), session, webAuthnSessionTTL); err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// FinishPasskeyRegistration проверяет ответ аутентификатора и сохраняет passkey
+func (s *Service) FinishPasskeyRegistration(ctx context.Context, userID uuid.UUID, name string, body []byte) (*PasskeyResponse, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("passkeys not configured")
+	}
+
+	session, err := s.repo.TakeWebAuthnSession(ctx, "register:"+userID.String())
+	if err != nil {
+		return nil, errors.New("registration session expired")
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.New("invalid passkey response")
+	}
+
+	wu, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.CreateCredential(wu, *session, parsed)
+	if err != nil {
+		log.Printf("Passkey registration failed for user %s: %v", userID, err)
+		return nil, errors.New("invalid passkey response")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = fmt.Sprintf("Passkey %d", len(wu.credentials)+1)
+	}
+	if runes := []rune(name); len(runes) > 100 {
+		name = string(runes[:100])
+	}
+
+	cred := &WebAuthnCredential{
+		ID:              uuid.New(),
+		UserID:          userID,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+		CreatedAt:       time.Now(),
+	}
+	for _, transport := range credential.Transport {
+		cred.Transports = append(cred.Transports, string(transport))
+	}
+
+	if err := s.repo.CreateWebAuthnCredential(ctx, cred); err != nil {
+		return nil, err
+	}
+
+	return toPasskeyResponse(cred), nil
+}
+
+// BeginPasskeyLogin начинает вход без пароля (discoverable credentials).
+// Возвращает параметры для navigator.credentials.get() и идентификатор сессии.
+func (s *Service) BeginPasskeyLogin(ctx context.Context) (*protocol.CredentialAssertion, string, error) {
+	if s.webAuthn == nil {
+		return nil, "", errors.New("passkeys not configured")
+	}
+
+	options, session, err := s.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sessionID := utils.GenerateToken(16)
+	if err := s.repo.SaveWebAuthnSession(ctx, "login:"+sessionID, session, webAuthnSessionTTL); err != nil {
+		return nil, "", err
+	}
+
+	return options, sessionID, nil
+}
+
+// FinishPasskeyLogin проверяет подпись и выдает пару токенов.
+// Passkey с проверкой пользователя уже является двухфакторным, поэтому TOTP не запрашивается.
+func (s *Service) FinishPasskeyLogin(ctx context.Context, sessionID string, body []byte, client ClientInfo) (*LoginResult, error) {
+	if s.webAuthn == nil {
+		return nil, errors.New("passkeys not configured")
+	}
+
+	session, err := s.repo.TakeWebAuthnSession(ctx, "login:"+sessionID)
+	if err != nil {
+		return nil, errors.New("login session expired")
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, s.failLogin(ctx, "", client.IPAddress, nil, errors.New("invalid passkey"))
+	}
+
+	// Аккаунт определяется по userHandle; неизвестный handle учитывается только по IP
+	var owner *user.User
+	account := ""
+	if userID, err := uuid.FromBytes(parsed.Response.UserHandle); err == nil {
+		if u, err := s.userRepo.FindByID(ctx, userID); err == nil {
+			owner, account = u, normalizeEmail(u.Email)
+		}
+	}
+	if err := s.checkLoginAllowed(ctx, account, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		return s.loadWebAuthnUser(ctx, userID)
+	}
+
+	found, credential, err := s.webAuthn.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		log.Printf("Passkey login failed: %v", err)
+		return nil, s.failLogin(ctx, account, client.IPAddress, owner, errors.New("invalid passkey"))
+	}
+
+	// Счетчик подписей не вырос — возможно, аутентификатор клонирован
+	if credential.Authenticator.CloneWarning {
+		log.Printf("Passkey clone warning for credential %x", credential.ID)
+		return nil, s.failLogin(ctx, account, client.IPAddress, owner, errors.New("invalid passkey"))
+	}
+
+	if err := s.repo.UpdateWebAuthnCredentialUsage(ctx, credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState); err != nil {
+		return nil, err
+	}
+
+	if account != "" {
+		s.clearLoginFailures(ctx, account)
+	}
+
+	return s.finishLogin(ctx, found.(*webAuthnUser).user, client)
+}
+
+func (s *Service) ListPasskeys(ctx context.Context, userID uuid.UUID) ([]*PasskeyResponse, error) {
+	creds, err := s.repo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	passkeys := make([]*PasskeyResponse, 0, len(creds))
+	for _, cred := range creds {
+		passkeys = append(passkeys, toPasskeyResponse(cred))
+	}
+	return passkeys, nil
+}
+
+func (s *Service) DeletePasskey(ctx context.Context, userID, passkeyID uuid.UUID) error {
+	deleted, err := s.repo.DeleteWebAuthnCredential(ctx, userID, passkeyID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("passkey not found")
+	}
+	return nil
+}
+
+func toWebAuthnCredential(cred *WebAuthnCredential) webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(cred.Transports))
+	for _, transport := range cred.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+
+	return webauthn.Credential{
+		ID:              cred.CredentialID,
+		PublicKey:       cred.PublicKey,
+		AttestationType: cred.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    true,
+			BackupEligible: cred.BackupEligible,
+			BackupState:    cred.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    cred.AAGUID,
+			SignCount: cred.SignCount,
+		},
+	}
+}
+
+func toPasskeyResponse(cred *WebAuthnCredential) *PasskeyResponse {
+	return &PasskeyResponse{
+		ID:         cred.ID,
+		Name:       cred.Name,
+		CreatedAt:  cred.CreatedAt,
+		LastUsedAt: cred.LastUsedAt,
+	}
+}
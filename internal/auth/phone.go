@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/common/utils"
+	"q7o/internal/sms"
+)
+
+const (
+	phoneCodeTTL           = 10 * time.Minute
+	phoneCodeWindow        = time.Hour
+	phoneCodeMaxRequests   = 5  // SMS на один номер (пользователя) в час
+	phoneCodeMaxIPRequests = 20 // запросов кода входа с одного IP в час
+	phoneCodeMaxAttempts   = 5
+)
+
+// SetSMSSender включает подтверждение телефона и вход по SMS
+func (s *Service) SetSMSSender(sender sms.Sender) {
+	s.smsSender = sender
+}
+
+func (s *Service) sendSMS(to, message string) {
+	if err := s.smsSender.Send(context.Background(), to, message); err != nil {
+		log.Printf("Failed to send SMS to %s: %v", to, err)
+	}
+}
+
+// SendPhoneVerification отправляет код подтверждения на текущий номер пользователя.
+// Вызывается user.Service после смены номера и эндпоинтом повторной отправки.
+func (s *Service) SendPhoneVerification(ctx context.Context, userID uuid.UUID) error {
+	if s.smsSender == nil {
+		return errors.New("sms not configured")
+	}
+
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.Phone == nil || *u.Phone == "" {
+		return errors.New("phone number not set")
+	}
+	if u.PhoneVerified {
+		return errors.New("phone already verified")
+	}
+
+	count, err := s.repo.IncrementCounter(ctx, fmt.Sprintf("phone_verify:rate:%s", userID), phoneCodeWindow)
+	if err != nil {
+		return err
+	}
+	if count > phoneCodeMaxRequests {
+		return errors.New("too many requests")
+	}
+
+	code := utils.GenerateCode(6)
+	if err := s.storeOneTimeCode(ctx, fmt.Sprintf("phone_verify:%s", userID), *u.Phone, code, phoneCodeTTL); err != nil {
+		return err
+	}
+
+	go s.sendSMS(*u.Phone, fmt.Sprintf("Q7O: your phone verification code is %s", code))
+
+	return nil
+}
+
+// VerifyPhone подтверждает номер кодом из SMS
+func (s *Service) VerifyPhone(ctx context.Context, userID uuid.UUID, code string) error {
+	phone, err := s.redeemOneTimeCode(ctx, fmt.Sprintf("phone_verify:%s", userID), code, phoneCodeTTL, phoneCodeMaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	// Номер могли сменить после отправки кода — тогда код относится к старому номеру
+	verified, err := s.userRepo.MarkPhoneVerified(ctx, userID, phone)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return errors.New("invalid or expired code")
+	}
+	return nil
+}
+
+// RequestPhoneLogin отправляет код входа на подтвержденный номер.
+// Для неизвестного номера ошибка не возвращается, чтобы не раскрывать наличие аккаунта.
+func (s *Service) RequestPhoneLogin(ctx context.Context, phone string, client ClientInfo) error {
+	if s.smsSender == nil {
+		return errors.New("sms not configured")
+	}
+
+	count, err := s.repo.IncrementCounter(ctx, "login_phone:rate:"+phone, phoneCodeWindow)
+	if err != nil {
+		return err
+	}
+	if count > phoneCodeMaxRequests {
+		return errors.New("too many requests")
+	}
+
+	if client.IPAddress != "" {
+		count, err := s.repo.IncrementCounter(ctx, "login_phone:rate:ip:"+client.IPAddress, phoneCodeWindow)
+		if err != nil {
+			return err
+		}
+		if count > phoneCodeMaxIPRequests {
+			return errors.New("too many requests")
+		}
+	}
+
+	u, err := s.userRepo.FindByVerifiedPhone(ctx, phone)
+	if err != nil {
+		return nil
+	}
+
+	code := utils.GenerateCode(6)
+	if err := s.storeOneTimeCode(ctx, "login_phone:"+phone, u.ID.String(), code, phoneCodeTTL); err != nil {
+		return err
+	}
+
+	go s.sendSMS(phone, fmt.Sprintf("Q7O: your sign-in code is %s. Don't share it with anyone.", code))
+
+	return nil
+}
+
+// VerifyPhoneLogin входит по коду из SMS; второй фактор (TOTP), если включен, по-прежнему запрашивается
+func (s *Service) VerifyPhoneLogin(ctx context.Context, phone, code string, client ClientInfo) (*LoginResult, error) {
+	// Неудачи учитываются по email владельца номера, чтобы блокировка была общей со входом по паролю
+	account := "phone:" + phone
+	owner, err := s.userRepo.FindByVerifiedPhone(ctx, phone)
+	if err == nil {
+		account = normalizeEmail(owner.Email)
+	} else {
+		owner = nil
+	}
+	if err := s.checkLoginAllowed(ctx, account, client.IPAddress); err != nil {
+		return nil, err
+	}
+
+	payload, err := s.redeemOneTimeCode(ctx, "login_phone:"+phone, code, phoneCodeTTL, phoneCodeMaxAttempts)
+	if err != nil {
+		return nil, s.failLogin(ctx, account, client.IPAddress, owner, err)
+	}
+
+	userID, err := uuid.Parse(payload)
+	if err != nil {
+		return nil, errors.New("invalid or expired code")
+	}
+
+	u, err := s.userRepo.FindByID(ctx, userID)
+	if err != nil || u.Phone == nil || *u.Phone != phone || !u.PhoneVerified {
+		return nil, errors.New("invalid or expired code")
+	}
+	s.clearLoginFailures(ctx, account)
+
+	return s.completeLogin(ctx, u, client)
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"q7o/internal/user"
+)
+
+// Права проверяются в обработчиках через RequirePermission: право должно быть и у роли
+// из access токена, и у текущей роли в базе, чтобы понижение роли действовало сразу
+const (
+	PermissionManageUsers      = "users:manage"
+	PermissionModerateMeetings = "meetings:moderate"
+	PermissionTestPush         = "push:test"
+)
+
+var rolePermissions = map[string][]string{
+	user.RoleAdmin: {
+		PermissionManageUsers,
+		PermissionModerateMeetings,
+		PermissionTestPush,
+	},
+	user.RoleModerator: {
+		PermissionModerateMeetings,
+	},
+}
+
+// HasPermission сообщает, есть ли у роли указанное право
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidRole проверяет, что роль существует
+func ValidRole(role string) bool {
+	switch role {
+	case user.RoleUser, user.RoleModerator, user.RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// RequirePermission пропускает запрос, только если у роли пользователя есть право.
+// Ставится после RequireAuth.
+func (m *Middleware) RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		role, _ := c.Locals("role").(string)
+		if !HasPermission(role, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient permissions",
+			})
+		}
+
+		userID, _ := uuid.Parse(c.Locals("userID").(string))
+		currentRole, err := m.repo.GetUserRole(c.Context(), userID)
+		if err != nil || !HasPermission(currentRole, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient permissions",
+			})
+		}
+		return c.Next()
+	}
+}
@@ -4,11 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
+	"strings"
 	"time"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"q7o/internal/common/utils"
 )
 
 type Repository struct {
@@ -23,77 +28,830 @@ func NewRepository(db *sql.DB, redis *redis.Client) *Repository {
 	}
 }
 
-func (r *Repository) SaveRefreshToken(ctx context.Context, userID uuid.UUID, token, deviceInfo string) error {
-	query := `
-        INSERT INTO sessions (user_id, refresh_token, device_info, expires_at)
+// SaveRefreshToken открывает новую сессию — корень семейства refresh токенов
+func (r *Repository) SaveRefreshToken(ctx context.Context, sessionID, userID uuid.UUID, token string, client ClientInfo, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO sessions (id, user_id, refresh_token, device_info, ip_address, expires_at, last_refreshed_at)
+        VALUES ($1, $2, $3, $4, $5, $6, NOW())
+    `, sessionID, userID, token, client.DeviceInfo, client.IPAddress, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at)
         VALUES ($1, $2, $3, $4)
-    `
-	expiresAt := time.Now().Add(90 * 24 * time.Hour)
-	_, err := r.db.ExecContext(ctx, query, userID, token, deviceInfo, expiresAt)
+    `, sessionID, userID, utils.HashToken(token), expiresAt)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 
 	// Also save in Redis for fast lookup
+	r.cacheRefreshToken(ctx, sessionID, userID, token, expiresAt)
+
+	return nil
+}
+
+// FindRefreshToken ищет выданный refresh token по хешу, в том числе уже замененный
+func (r *Repository) FindRefreshToken(ctx context.Context, token string) (*RefreshToken, error) {
+	query := `
+        SELECT id, session_id, user_id, parent_id, rotated_at, expires_at
+        FROM refresh_tokens
+        WHERE token_hash = $1
+    `
+
+	rt := &RefreshToken{}
+	err := r.db.QueryRowContext(ctx, query, utils.HashToken(token)).Scan(
+		&rt.ID, &rt.SessionID, &rt.UserID, &rt.ParentID, &rt.RotatedAt, &rt.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return rt, nil
+}
+
+// RotateRefreshToken заменяет токен потомком в том же семействе.
+// Возвращает false, если токен уже был заменен (повторное предъявление).
+func (r *Repository) RotateRefreshToken(ctx context.Context, current *RefreshToken, oldToken, newToken string, client ClientInfo, expiresAt time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE refresh_tokens SET rotated_at = NOW() WHERE id = $1 AND rotated_at IS NULL`,
+		current.ID,
+	)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO refresh_tokens (session_id, user_id, token_hash, parent_id, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `, current.SessionID, current.UserID, utils.HashToken(newToken), current.ID, expiresAt)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE sessions 
+        SET refresh_token = $1, expires_at = $2, device_info = $3, ip_address = $4, last_refreshed_at = NOW()
+        WHERE id = $5
+    `, newToken, expiresAt, client.DeviceInfo, client.IPAddress, current.SessionID)
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	r.redis.Del(ctx, fmt.Sprintf("refresh:%s", oldToken))
+	r.cacheRefreshToken(ctx, current.SessionID, current.UserID, newToken, expiresAt)
+
+	return true, nil
+}
+
+// cacheRefreshToken кладет текущий токен сессии в Redis с тем же сроком жизни, что и в БД
+func (r *Repository) cacheRefreshToken(ctx context.Context, sessionID, userID uuid.UUID, token string, expiresAt time.Time) {
 	key := fmt.Sprintf("refresh:%s", token)
 	data := map[string]string{
-		"user_id": userID.String(),
-		"token":   token,
+		"user_id":    userID.String(),
+		"session_id": sessionID.String(),
+		"token":      token,
 	}
 	jsonData, _ := json.Marshal(data)
-	r.redis.Set(ctx, key, jsonData, 90*24*time.Hour)
+	r.redis.Set(ctx, key, jsonData, time.Until(expiresAt))
+}
 
+func (r *Repository) DeleteRefreshToken(ctx context.Context, userID uuid.UUID, token string) error {
+	// Delete from Redis
+	key := fmt.Sprintf("refresh:%s", token)
+	r.redis.Del(ctx, key)
+
+	// Delete from database
+	query := `DELETE FROM sessions WHERE user_id = $1 AND refresh_token = $2`
+	_, err := r.db.ExecContext(ctx, query, userID, token)
 	return err
 }
 
-func (r *Repository) RefreshTokenExists(ctx context.Context, userID uuid.UUID, token string) (bool, error) {
-	// Check Redis first
-	key := fmt.Sprintf("refresh:%s", token)
-	exists := r.redis.Exists(ctx, key).Val()
-	if exists > 0 {
-		return true, nil
+// GetSessions возвращает активные сессии пользователя, последние обновленные — первыми
+func (r *Repository) GetSessions(ctx context.Context, userID uuid.UUID) ([]*Session, error) {
+	query := `
+        SELECT id, device_info, ip_address, created_at, last_refreshed_at, expires_at
+        FROM sessions
+        WHERE user_id = $1 AND expires_at > NOW()
+        ORDER BY COALESCE(last_refreshed_at, created_at) DESC
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		session := &Session{}
+		var deviceInfo, ipAddress sql.NullString
+		err := rows.Scan(
+			&session.ID, &deviceInfo, &ipAddress,
+			&session.CreatedAt, &session.LastRefreshedAt, &session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		session.DeviceInfo = deviceInfo.String
+		session.IPAddress = ipAddress.String
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// DeleteSession удаляет одну сессию пользователя; false, если сессия не найдена
+func (r *Repository) DeleteSession(ctx context.Context, userID, sessionID uuid.UUID) (bool, error) {
+	count, err := r.deleteSessions(ctx,
+		`DELETE FROM sessions WHERE user_id = $1 AND id = $2 RETURNING refresh_token`,
+		userID, sessionID,
+	)
+	return count > 0, err
+}
+
+// DeleteOtherSessions удаляет все сессии пользователя, кроме текущей
+func (r *Repository) DeleteOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int, error) {
+	return r.deleteSessions(ctx,
+		`DELETE FROM sessions WHERE user_id = $1 AND id <> $2 RETURNING refresh_token`,
+		userID, currentSessionID,
+	)
+}
+
+// RevokeAllSessions удаляет все сессии пользователя из БД вместе с ключами refresh:* в Redis
+func (r *Repository) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	_, err := r.deleteSessions(ctx,
+		`DELETE FROM sessions WHERE user_id = $1 RETURNING refresh_token`,
+		userID,
+	)
+	return err
+}
+
+// deleteSessions выполняет DELETE ... RETURNING refresh_token и чистит соответствующие ключи в Redis
+func (r *Repository) deleteSessions(ctx context.Context, query string, args ...interface{}) (int, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return 0, err
+		}
+		keys = append(keys, fmt.Sprintf("refresh:%s", token))
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(keys) > 0 {
+		r.redis.Del(ctx, keys...)
+	}
+
+	return len(keys), nil
+}
+
+// IncrementCounter увеличивает счетчик в Redis и выставляет TTL при первом обращении
+func (r *Repository) IncrementCounter(ctx context.Context, key string, window time.Duration) (int64, error) {
+	count, err := r.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		r.redis.Expire(ctx, key, window)
+	}
+	return count, nil
+}
+
+// GetCounter возвращает значение счетчика и оставшееся время его окна
+func (r *Repository) GetCounter(ctx context.Context, key string) (int64, time.Duration, error) {
+	count, err := r.redis.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	ttl, err := r.KeyTTL(ctx, key)
+	return count, ttl, err
+}
+
+// KeyTTL возвращает оставшееся время жизни ключа; 0, если ключа нет
+func (r *Repository) KeyTTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.redis.TTL(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (r *Repository) SetKey(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	return r.redis.Set(ctx, key, value, ttl).Err()
+}
+
+// SetKeyNX выставляет ключ, только если его еще нет
+func (r *Repository) SetKeyNX(ctx context.Context, key string, value interface{}, ttl time.Duration) (bool, error) {
+	return r.redis.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (r *Repository) GetKey(ctx context.Context, key string) (string, error) {
+	return r.redis.Get(ctx, key).Result()
+}
+
+// TakeKey возвращает значение ключа и удаляет его
+func (r *Repository) TakeKey(ctx context.Context, key string) (string, error) {
+	return r.redis.GetDel(ctx, key).Result()
+}
+
+func (r *Repository) DeleteKeys(ctx context.Context, keys ...string) error {
+	return r.redis.Del(ctx, keys...).Err()
+}
+
+func (r *Repository) CreatePasswordReset(ctx context.Context, reset *PasswordReset) error {
+	query := `
+        INSERT INTO password_resets (id, user_id, code_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `
+	_, err := r.db.ExecContext(ctx, query, reset.ID, reset.UserID, reset.CodeHash, reset.ExpiresAt, reset.CreatedAt)
+	return err
+}
+
+// FindActivePasswordReset возвращает последний неиспользованный и не истекший код сброса
+func (r *Repository) FindActivePasswordReset(ctx context.Context, userID uuid.UUID) (*PasswordReset, error) {
+	query := `
+        SELECT id, user_id, code_hash, attempts, expires_at, used_at, created_at
+        FROM password_resets
+        WHERE user_id = $1 AND used_at IS NULL AND expires_at > NOW()
+        ORDER BY created_at DESC
+        LIMIT 1
+    `
+
+	reset := &PasswordReset{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&reset.ID, &reset.UserID, &reset.CodeHash, &reset.Attempts,
+		&reset.ExpiresAt, &reset.UsedAt, &reset.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+// IncrementPasswordResetAttempts засчитывает попытку и возвращает их число с учетом этой.
+// Счетчик увеличивается одним UPDATE, поэтому параллельные запросы не обходят лимит.
+func (r *Repository) IncrementPasswordResetAttempts(ctx context.Context, id uuid.UUID) (int, error) {
+	query := `
+        UPDATE password_resets SET attempts = attempts + 1
+        WHERE id = $1 AND used_at IS NULL
+        RETURNING attempts
+    `
+	var attempts int
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&attempts)
+	return attempts, err
+}
+
+// UsePasswordReset помечает код использованным; возвращает false, если код уже был использован
+func (r *Repository) UsePasswordReset(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `UPDATE password_resets SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// InvalidatePasswordResets помечает все активные коды пользователя использованными
+func (r *Repository) InvalidatePasswordResets(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// SaveMFASecret сохраняет (или заменяет) неподтвержденный TOTP секрет
+func (r *Repository) SaveMFASecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	query := `
+        INSERT INTO user_mfa (user_id, secret, enabled)
+        VALUES ($1, $2, false)
+        ON CONFLICT (user_id)
+        DO UPDATE SET secret = EXCLUDED.secret, enabled = false, confirmed_at = NULL
+    `
+	_, err := r.db.ExecContext(ctx, query, userID, secret)
+	return err
+}
+
+func (r *Repository) GetUserMFA(ctx context.Context, userID uuid.UUID) (*UserMFA, error) {
+	query := `
+        SELECT user_id, secret, enabled, confirmed_at, created_at
+        FROM user_mfa WHERE user_id = $1
+    `
+
+	mfa := &UserMFA{}
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.ConfirmedAt, &mfa.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return mfa, nil
+}
+
+// IsMFAEnabled возвращает true, если у пользователя подтвержден TOTP
+func (r *Repository) IsMFAEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled = true)`
+	var enabled bool
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&enabled)
+	return enabled, err
+}
+
+func (r *Repository) EnableMFA(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE user_mfa SET enabled = true, confirmed_at = NOW() WHERE user_id = $1`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// DeleteMFA отключает TOTP и удаляет коды восстановления
+func (r *Repository) DeleteMFA(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes удаляет старые коды восстановления и сохраняет новые хеши
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	for _, hash := range codeHashes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, hash,
+		)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Fallback to database
+	return tx.Commit()
+}
+
+// UseRecoveryCode помечает код восстановления использованным; false, если код не найден
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
 	query := `
-        SELECT COUNT(*) FROM sessions 
-        WHERE user_id = $1 AND refresh_token = $2 AND expires_at > NOW()
+        UPDATE mfa_recovery_codes SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
     `
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (r *Repository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	query := `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
 	var count int
-	err := r.db.QueryRowContext(ctx, query, userID, token).Scan(&count)
-	return count > 0, err
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// SaveMFAChallenge сохраняет челлендж "mfa_pending", выданный после проверки пароля
+func (r *Repository) SaveMFAChallenge(ctx context.Context, token string, userID uuid.UUID, ttl time.Duration) error {
+	key := fmt.Sprintf("mfa_pending:%s", token)
+	return r.redis.Set(ctx, key, userID.String(), ttl).Err()
 }
 
-func (r *Repository) UpdateRefreshToken(ctx context.Context, userID uuid.UUID, oldToken, newToken string) error {
-	// Delete old token from Redis
-	oldKey := fmt.Sprintf("refresh:%s", oldToken)
-	r.redis.Del(ctx, oldKey)
+func (r *Repository) GetMFAChallenge(ctx context.Context, token string) (uuid.UUID, error) {
+	key := fmt.Sprintf("mfa_pending:%s", token)
+	value, err := r.redis.Get(ctx, key).Result()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(value)
+}
 
-	// Update in database
+func (r *Repository) DeleteMFAChallenge(ctx context.Context, token string) {
+	r.redis.Del(ctx, fmt.Sprintf("mfa_pending:%s", token), fmt.Sprintf("mfa_pending:attempts:%s", token))
+}
+
+// MarkTOTPStepUsed защищает от повторного использования кода в пределах его окна
+func (r *Repository) MarkTOTPStepUsed(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	key := fmt.Sprintf("mfa_used:%s:%d", userID, step)
+	return r.redis.SetNX(ctx, key, 1, time.Duration(totpPeriod*(2*totpSkew+2))*time.Second).Result()
+}
+
+func (r *Repository) CreateWebAuthnCredential(ctx context.Context, cred *WebAuthnCredential) error {
 	query := `
-        UPDATE sessions 
-        SET refresh_token = $1, expires_at = $2
-        WHERE user_id = $3 AND refresh_token = $4
+        INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, attestation_type,
+                                          aaguid, sign_count, transports, backup_eligible, backup_state, name)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
     `
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
-	_, err := r.db.ExecContext(ctx, query, newToken, expiresAt, userID, oldToken)
+	_, err := r.db.ExecContext(ctx, query,
+		cred.ID, cred.UserID, cred.CredentialID, cred.PublicKey, cred.AttestationType,
+		cred.AAGUID, int64(cred.SignCount), strings.Join(cred.Transports, ","),
+		cred.BackupEligible, cred.BackupState, cred.Name,
+	)
+	return err
+}
 
-	// Save new token in Redis
-	newKey := fmt.Sprintf("refresh:%s", newToken)
-	data := map[string]string{
-		"user_id": userID.String(),
-		"token":   newToken,
+func (r *Repository) GetWebAuthnCredentials(ctx context.Context, userID uuid.UUID) ([]*WebAuthnCredential, error) {
+	query := `
+        SELECT id, user_id, credential_id, public_key, attestation_type, aaguid, sign_count,
+               transports, backup_eligible, backup_state, name, created_at, last_used_at
+        FROM webauthn_credentials
+        WHERE user_id = $1
+        ORDER BY created_at
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []*WebAuthnCredential
+	for rows.Next() {
+		cred := &WebAuthnCredential{}
+		var signCount int64
+		var transports string
+		err := rows.Scan(
+			&cred.ID, &cred.UserID, &cred.CredentialID, &cred.PublicKey, &cred.AttestationType,
+			&cred.AAGUID, &signCount, &transports, &cred.BackupEligible, &cred.BackupState,
+			&cred.Name, &cred.CreatedAt, &cred.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		cred.SignCount = uint32(signCount)
+		if transports != "" {
+			cred.Transports = strings.Split(transports, ",")
+		}
+		creds = append(creds, cred)
 	}
-	jsonData, _ := json.Marshal(data)
-	r.redis.Set(ctx, newKey, jsonData, 90*24*time.Hour)
 
+	return creds, rows.Err()
+}
+
+// UpdateWebAuthnCredentialUsage сохраняет счетчик подписей после успешного входа
+func (r *Repository) UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, backupState bool) error {
+	query := `
+        UPDATE webauthn_credentials
+        SET sign_count = $1, backup_state = $2, last_used_at = NOW()
+        WHERE credential_id = $3
+    `
+	_, err := r.db.ExecContext(ctx, query, int64(signCount), backupState, credentialID)
 	return err
 }
 
-func (r *Repository) DeleteRefreshToken(ctx context.Context, userID uuid.UUID, token string) error {
-	// Delete from Redis
-	key := fmt.Sprintf("refresh:%s", token)
-	r.redis.Del(ctx, key)
+func (r *Repository) DeleteWebAuthnCredential(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
 
-	// Delete from database
-	query := `DELETE FROM sessions WHERE user_id = $1 AND refresh_token = $2`
-	_, err := r.db.ExecContext(ctx, query, userID, token)
+func (r *Repository) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	query := `
+        INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at
+    `
+	return r.db.QueryRowContext(ctx, query,
+		key.ID, key.UserID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.ExpiresAt,
+	).Scan(&key.CreatedAt)
+}
+
+func (r *Repository) GetAPIKeys(ctx context.Context, userID uuid.UUID) ([]*APIKey, error) {
+	query := `
+        SELECT id, user_id, name, prefix, key_hash, scopes, expires_at,
+               last_used_at, COALESCE(last_used_ip, ''), created_at
+        FROM api_keys
+        WHERE user_id = $1
+        ORDER BY created_at
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*APIKey
+	for rows.Next() {
+		key := &APIKey{}
+		var scopes string
+		err := rows.Scan(
+			&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes,
+			&key.ExpiresAt, &key.LastUsedAt, &key.LastUsedIP, &key.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		key.Scopes = strings.Split(scopes, ",")
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// FindAPIKeyByPrefix возвращает ключ вместе с username и состоянием аккаунта владельца
+func (r *Repository) FindAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	query := `
+        SELECT k.id, k.user_id, k.name, k.prefix, k.key_hash, k.scopes, k.expires_at,
+               k.last_used_at, COALESCE(k.last_used_ip, ''), k.created_at,
+               u.username, u.account_state
+        FROM api_keys k
+        JOIN users u ON u.id = k.user_id
+        WHERE k.prefix = $1
+    `
+
+	key := &APIKey{}
+	var scopes string
+	err := r.db.QueryRowContext(ctx, query, prefix).Scan(
+		&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes,
+		&key.ExpiresAt, &key.LastUsedAt, &key.LastUsedIP, &key.CreatedAt,
+		&key.Username, &key.AccountState,
+	)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+
+	return key, nil
+}
+
+// TouchAPIKey отмечает использование ключа; чтобы не писать в БД на каждый запрос,
+// время обновляется не чаще раза в минуту
+func (r *Repository) TouchAPIKey(ctx context.Context, id uuid.UUID, ip string) error {
+	query := `
+        UPDATE api_keys
+        SET last_used_at = NOW(), last_used_ip = $2
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+    `
+	_, err := r.db.ExecContext(ctx, query, id, ip)
+	return err
+}
+
+// DeleteAPIKeys удаляет все ключи пользователя и возвращает их число
+func (r *Repository) DeleteAPIKeys(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *Repository) DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) (*APIKey, error) {
+	key := &APIKey{}
+	var scopes string
+	err := r.db.QueryRowContext(ctx,
+		`DELETE FROM api_keys WHERE id = $1 AND user_id = $2 RETURNING id, name, prefix, scopes`, id, userID,
+	).Scan(&key.ID, &key.Name, &key.Prefix, &scopes)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+
+	return key, nil
+}
+
+// SaveWebAuthnSession сохраняет данные церемонии WebAuthn (челлендж) до ее завершения
+func (r *Repository) SaveWebAuthnSession(ctx context.Context, key string, session *webauthn.SessionData, ttl time.Duration) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return r.redis.Set(ctx, fmt.Sprintf("webauthn:%s", key), data, ttl).Err()
+}
+
+// TakeWebAuthnSession возвращает и удаляет данные церемонии, челлендж одноразовый
+func (r *Repository) TakeWebAuthnSession(ctx context.Context, key string) (*webauthn.SessionData, error) {
+	data, err := r.redis.GetDel(ctx, fmt.Sprintf("webauthn:%s", key)).Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &webauthn.SessionData{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// TrackAccessToken запоминает jti выданного access токена, чтобы его можно было отозвать
+// вместе с сессией. Множество access_jtis:<user> хранит "sid:jti" со сроком истечения в score.
+func (r *Repository) TrackAccessToken(ctx context.Context, userID, sessionID uuid.UUID, jti string, expiresAt time.Time) error {
+	key := fmt.Sprintf("access_jtis:%s", userID)
+
+	pipe := r.redis.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: sessionID.String() + ":" + jti})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("%d", time.Now().Unix()))
+	pipe.Expire(ctx, key, time.Until(expiresAt))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// RevokeAccessToken добавляет jti в список отозванных до истечения токена
+func (r *Repository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return r.redis.Set(ctx, fmt.Sprintf("revoked_jti:%s", jti), 1, ttl).Err()
+}
+
+// RevokeAccessTokens отзывает еще живые access токены пользователя, чьи сессии подходят под match
+func (r *Repository) RevokeAccessTokens(ctx context.Context, userID uuid.UUID, match func(sessionID string) bool) error {
+	key := fmt.Sprintf("access_jtis:%s", userID)
+
+	tokens, err := r.redis.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", time.Now().Unix()),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	pipe := r.redis.TxPipeline()
+	var revoked []interface{}
+	for _, token := range tokens {
+		member, _ := token.Member.(string)
+		sessionID, jti, found := strings.Cut(member, ":")
+		if !found || !match(sessionID) {
+			continue
+		}
+
+		ttl := time.Until(time.Unix(int64(token.Score), 0))
+		if ttl > 0 {
+			pipe.Set(ctx, fmt.Sprintf("revoked_jti:%s", jti), 1, ttl)
+		}
+		revoked = append(revoked, member)
+	}
+
+	if len(revoked) == 0 {
+		return nil
+	}
+
+	pipe.ZRem(ctx, key, revoked...)
+	_, err = pipe.Exec(ctx)
 	return err
 }
+
+func (r *Repository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := r.redis.Exists(ctx, fmt.Sprintf("revoked_jti:%s", jti)).Result()
+	return count > 0, err
+}
+
+// SetUserSuspended ставит или снимает отметку о блокировке, которую проверяет Middleware.Authenticate.
+// Источник истины — users.account_state; отметка восстанавливается при старте (RestoreSuspensions).
+func (r *Repository) SetUserSuspended(ctx context.Context, userID uuid.UUID, suspended bool) error {
+	key := fmt.Sprintf("user_suspended:%s", userID)
+	if suspended {
+		return r.redis.Set(ctx, key, 1, 0).Err()
+	}
+	return r.redis.Del(ctx, key).Err()
+}
+
+// GetUserRole возвращает текущую роль пользователя
+func (r *Repository) GetUserRole(ctx context.Context, userID uuid.UUID) (string, error) {
+	var role string
+	err := r.db.QueryRowContext(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
+	return role, err
+}
+
+func (r *Repository) IsUserSuspended(ctx context.Context, userID uuid.UUID) (bool, error) {
+	count, err := r.redis.Exists(ctx, fmt.Sprintf("user_suspended:%s", userID)).Result()
+	return count > 0, err
+}
+
+func (r *Repository) FindIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	identity := &UserIdentity{}
+	err := r.db.QueryRowContext(ctx, `
+        SELECT id, user_id, provider, subject, email, created_at, last_login_at
+        FROM user_identities
+        WHERE provider = $1 AND subject = $2
+    `, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&identity.Email, &identity.CreatedAt, &identity.LastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *Repository) CreateIdentity(ctx context.Context, identity *UserIdentity) error {
+	query := `
+        INSERT INTO user_identities (id, user_id, provider, subject, email, last_login_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `
+	_, err := r.db.ExecContext(ctx, query,
+		identity.ID, identity.UserID, identity.Provider, identity.Subject,
+		identity.Email, identity.LastLoginAt,
+	)
+	// UNIQUE (user_id, provider): к аккаунту уже привязан другой аккаунт этого провайдера
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // unique_violation
+		return errors.New("identity already linked")
+	}
+	return err
+}
+
+func (r *Repository) TouchIdentity(ctx context.Context, id uuid.UUID, email string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP, email = $2 WHERE id = $1`, id, email,
+	)
+	return err
+}
+
+func (r *Repository) GetIdentities(ctx context.Context, userID uuid.UUID) ([]*UserIdentity, error) {
+	rows, err := r.db.QueryContext(ctx, `
+        SELECT id, user_id, provider, subject, email, created_at, last_login_at
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*UserIdentity
+	for rows.Next() {
+		identity := &UserIdentity{}
+		if err := rows.Scan(
+			&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+			&identity.Email, &identity.CreatedAt, &identity.LastLoginAt,
+		); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+func (r *Repository) DeleteIdentity(ctx context.Context, userID uuid.UUID, provider string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, userID, provider,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -2,35 +2,72 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"log"
+	"net/http"
 	"strings"
 	"time"
 
 	"q7o/config"
+	"q7o/internal/audit"
 	"q7o/internal/common/utils"
 	"q7o/internal/email"
+	"q7o/internal/sms"
 	"q7o/internal/user"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/google/uuid"
 )
 
 type Service struct {
-	repo         *Repository
-	userRepo     *user.Repository
-	emailService *email.Service
-	jwtConfig    config.JWTConfig
+	repo              *Repository
+	userRepo          *user.Repository
+	emailService      *email.Service
+	keys              *KeyManager
+	jwtConfig         config.JWTConfig
+	security          config.SecurityConfig
+	emailVerification config.EmailVerificationConfig
+	appURL            string
+	emailLoginAppURL  string
+	webAuthn          *webauthn.WebAuthn
+	oidcConfig        []config.OIDCProviderConfig
+	oidcProviders     map[string]*oidcProvider
+	oidcHTTPClient    *http.Client
+	smsSender         sms.Sender
+	auditLog          *audit.Service
+	signup            config.SignupProtectionConfig
+	disposableDomains map[string]bool
 }
 
-func NewService(repo *Repository, userRepo *user.Repository, emailService *email.Service, jwtConfig config.JWTConfig) *Service {
+func NewService(repo *Repository, userRepo *user.Repository, emailService *email.Service, keys *KeyManager, cfg *config.Config) *Service {
 	return &Service{
-		repo:         repo,
-		userRepo:     userRepo,
-		emailService: emailService,
-		jwtConfig:    jwtConfig,
+		repo:              repo,
+		userRepo:          userRepo,
+		emailService:      emailService,
+		keys:              keys,
+		jwtConfig:         cfg.JWT,
+		security:          cfg.Security,
+		emailVerification: cfg.EmailVerification,
+		appURL:            cfg.AppURL,
+		emailLoginAppURL:  cfg.EmailLoginAppURL,
+		oidcConfig:        cfg.OIDC,
+		oidcProviders:     newOIDCProviders(cfg.OIDC),
+		signup:            cfg.SignupProtection,
 	}
 }
 
-func (s *Service) Register(ctx context.Context, req RegisterRequest) (*user.UserResponse, *TokenPair, error) {
+// SetAuditLog включает запись входов, смен пароля и email в журнал безопасности
+func (s *Service) SetAuditLog(auditLog *audit.Service) {
+	s.auditLog = auditLog
+}
+
+func (s *Service) Register(ctx context.Context, req RegisterRequest, client ClientInfo) (*user.UserResponse, *TokenPair, error) {
+	if s.isDisposableEmail(req.Email) {
+		return nil, nil, errors.New("disposable email not allowed")
+	}
+
 	// Check if email exists
 	if exists, _ := s.userRepo.EmailExists(ctx, req.Email); exists {
 		return nil, nil, errors.New("email already exists")
@@ -48,34 +85,7 @@ func (s *Service) Register(ctx context.Context, req RegisterRequest) (*user.User
 		finalUsername = req.Username
 	} else {
 		// Генерируем username.go автоматически
-		suggestions := utils.GenerateUsername(req.FirstName, req.LastName)
-
-		// Находим первый свободный вариант
-		for _, suggestion := range suggestions {
-			if exists, _ := s.userRepo.UsernameExists(ctx, suggestion); !exists {
-				finalUsername = suggestion
-				break
-			}
-		}
-
-		// Если все варианты заняты, генерируем с суффиксом
-		if finalUsername == "" {
-			if len(suggestions) > 0 {
-				// Получаем все похожие usernames для проверки
-				baseUsername := suggestions[0]
-				similarUsernames, _ := s.userRepo.FindSimilarUsernames(ctx, baseUsername, 100)
-				finalUsername = utils.GenerateUsernameWithSuffix(baseUsername, similarUsernames)
-			} else {
-				// Крайний случай - используем email prefix
-				emailPrefix := strings.Split(req.Email, "@")[0]
-				emailPrefix = utils.CleanString(emailPrefix)
-				if len(emailPrefix) > 20 {
-					emailPrefix = emailPrefix[:20]
-				}
-				similarUsernames, _ := s.userRepo.FindSimilarUsernames(ctx, emailPrefix, 100)
-				finalUsername = utils.GenerateUsernameWithSuffix(emailPrefix, similarUsernames)
-			}
-		}
+		finalUsername = s.pickUsername(ctx, req.FirstName, req.LastName, req.Email)
 	}
 
 	// Hash password
@@ -113,114 +123,326 @@ func (s *Service) Register(ctx context.Context, req RegisterRequest) (*user.User
 	go s.emailService.SendVerificationEmail(req.Email, fullName, verificationCode)
 
 	// Generate tokens
-	tokens, err := GenerateTokenPair(newUser.ID, newUser.Username, s.jwtConfig)
+	tokens, err := s.issueTokens(ctx, newUser, client)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Save refresh token
-	if err := s.repo.SaveRefreshToken(ctx, newUser.ID, tokens.RefreshToken, ""); err != nil {
-		return nil, nil, err
+	return toUserResponse(newUser), tokens, nil
+}
+
+// pickUsername подбирает свободный username по имени и фамилии
+func (s *Service) pickUsername(ctx context.Context, firstName, lastName, email string) string {
+	var username string
+
+	suggestions := utils.GenerateUsername(firstName, lastName)
+
+	// Находим первый свободный вариант
+	for _, suggestion := range suggestions {
+		if exists, _ := s.userRepo.UsernameExists(ctx, suggestion); !exists {
+			username = suggestion
+			break
+		}
 	}
 
-	userResponse := &user.UserResponse{
-		ID:        newUser.ID,
-		Username:  newUser.Username,
-		FirstName: newUser.FirstName,
-		LastName:  newUser.LastName,
-		Email:     newUser.Email,
-		Status:    newUser.Status,
-		CreatedAt: newUser.CreatedAt,
+	// Если все варианты заняты, генерируем с суффиксом
+	if username == "" {
+		if len(suggestions) > 0 {
+			// Получаем все похожие usernames для проверки
+			baseUsername := suggestions[0]
+			similarUsernames, _ := s.userRepo.FindSimilarUsernames(ctx, baseUsername, 100)
+			username = utils.GenerateUsernameWithSuffix(baseUsername, similarUsernames)
+		} else {
+			// Крайний случай - используем email prefix
+			emailPrefix := strings.Split(email, "@")[0]
+			emailPrefix = utils.CleanString(emailPrefix)
+			if len(emailPrefix) > 20 {
+				emailPrefix = emailPrefix[:20]
+			}
+			similarUsernames, _ := s.userRepo.FindSimilarUsernames(ctx, emailPrefix, 100)
+			username = utils.GenerateUsernameWithSuffix(emailPrefix, similarUsernames)
+		}
 	}
 
-	return userResponse, tokens, nil
+	return username
 }
 
-func (s *Service) Login(ctx context.Context, req LoginRequest) (*user.UserResponse, *TokenPair, error) {
+func (s *Service) Login(ctx context.Context, req LoginRequest, client ClientInfo) (*LoginResult, error) {
+	email := normalizeEmail(req.Email)
+
+	// Brute-force protection
+	if err := s.checkLoginAllowed(ctx, email, client.IPAddress); err != nil {
+		return nil, err
+	}
+
 	// Find user by email
 	u, err := s.userRepo.FindByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, nil, errors.New("invalid credentials")
+		return nil, s.recordLoginFailure(ctx, email, client.IPAddress, nil)
 	}
 
 	// Verify password
 	if !utils.CheckPassword(req.Password, u.PasswordHash) {
-		return nil, nil, errors.New("invalid credentials")
+		return nil, s.recordLoginFailure(ctx, email, client.IPAddress, u)
 	}
 
-	// Generate tokens
-	tokens, err := GenerateTokenPair(u.ID, u.Username, s.jwtConfig)
+	s.clearLoginFailures(ctx, email)
+
+	return s.completeLogin(ctx, u, client)
+}
+
+// completeLogin завершает вход после проверки первого фактора:
+// если включена MFA, выдает челлендж, иначе — пару токенов
+func (s *Service) completeLogin(ctx context.Context, u *user.User, client ClientInfo) (*LoginResult, error) {
+	if u.AccountState == user.AccountStateSuspended {
+		return nil, errors.New("account suspended")
+	}
+
+	mfaEnabled, err := s.repo.IsMFAEnabled(ctx, u.ID)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// Save refresh token
-	if err := s.repo.SaveRefreshToken(ctx, u.ID, tokens.RefreshToken, ""); err != nil {
-		return nil, nil, err
+	if mfaEnabled {
+		challenge := utils.GenerateToken(32)
+		if err := s.repo.SaveMFAChallenge(ctx, challenge, u.ID, mfaChallengeTTL); err != nil {
+			return nil, err
+		}
+
+		return &LoginResult{
+			MFARequired: true,
+			MFAToken:    challenge,
+			ExpiresIn:   int(mfaChallengeTTL.Seconds()),
+		}, nil
+	}
+
+	return s.finishLogin(ctx, u, client)
+}
+
+// finishLogin выдает токены пользователю, прошедшему все факторы
+func (s *Service) finishLogin(ctx context.Context, u *user.User, client ClientInfo) (*LoginResult, error) {
+	if u.AccountState == user.AccountStateSuspended {
+		return nil, errors.New("account suspended")
+	}
+
+	// Вход в течение льготного периода отменяет удаление аккаунта
+	deletionCancelled := false
+	if u.AccountState == user.AccountStatePendingDeletion {
+		cancelled, err := s.userRepo.CancelDeletion(ctx, u.ID)
+		if err != nil {
+			return nil, err
+		}
+		if cancelled {
+			log.Printf("Account deletion cancelled by login for user %s", u.ID)
+			u.AccountState = user.AccountStateActive
+			deletionCancelled = true
+		}
+	}
+
+	tokens, err := s.issueTokens(ctx, u, client)
+	if err != nil {
+		return nil, err
 	}
 
 	// Update last seen
 	s.userRepo.UpdateLastSeen(ctx, u.ID)
 
-	userResponse := &user.UserResponse{
-		ID:        u.ID,
-		Username:  u.Username,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Email:     u.Email,
-		Status:    u.Status,
-		CreatedAt: u.CreatedAt,
+	s.auditLog.RecordClient(ctx, u.ID, audit.EventLoginSuccess, client.IPAddress, client.DeviceInfo, nil)
+
+	return &LoginResult{
+		User:              toUserResponse(u),
+		AccessToken:       tokens.AccessToken,
+		RefreshToken:      tokens.RefreshToken,
+		DeletionCancelled: deletionCancelled,
+	}, nil
+}
+
+// issueTokens открывает новую сессию и выдает для нее пару токенов
+func (s *Service) issueTokens(ctx context.Context, u *user.User, client ClientInfo) (*TokenPair, error) {
+	sessionID := uuid.New()
+	tokens, err := s.keys.GenerateTokenPair(u, sessionID, s.emailVerificationDeadline(u))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SaveRefreshToken(ctx, sessionID, u.ID, tokens.RefreshToken, client, s.refreshExpiresAt()); err != nil {
+		return nil, err
 	}
 
-	return userResponse, tokens, nil
+	if err := s.repo.TrackAccessToken(ctx, u.ID, sessionID, tokens.accessID, tokens.accessExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func toUserResponse(u *user.User) *user.UserResponse {
+	return &user.UserResponse{
+		ID:            u.ID,
+		Username:      u.Username,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Email:         u.Email,
+		AvatarURL:     u.AvatarURL,
+		Status:        u.Status,
+		CreatedAt:     u.CreatedAt,
+		Phone:         u.Phone,
+		PhoneVerified: u.PhoneVerified,
+		Role:          u.Role,
+	}
+}
+
+// emailVerificationDeadline — до какого момента неподтвержденный аккаунт работает без ограничений
+func (s *Service) emailVerificationDeadline(u *user.User) time.Time {
+	if !s.emailVerification.Required {
+		return time.Time{}
+	}
+	return u.CreatedAt.Add(time.Duration(s.emailVerification.GracePeriodHours) * time.Hour)
 }
 
-func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
+// refreshExpiresAt — срок жизни refresh токена, одинаковый для JWT, Postgres и Redis
+func (s *Service) refreshExpiresAt() time.Time {
+	return time.Now().Add(time.Duration(s.jwtConfig.RefreshDays) * 24 * time.Hour)
+}
+
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string, client ClientInfo) (*TokenPair, error) {
 	// Validate refresh token
-	claims, err := ValidateToken(refreshToken, s.jwtConfig.RefreshSecret)
+	claims, err := s.keys.ParseToken(refreshToken, TokenTypeRefresh)
 	if err != nil {
 		return nil, err
 	}
 
-	// Check if refresh token exists in database
-	exists, err := s.repo.RefreshTokenExists(ctx, claims.UserID, refreshToken)
-	if err != nil || !exists {
+	// Find the token in its family
+	current, err := s.repo.FindRefreshToken(ctx, refreshToken)
+	if err != nil || current.UserID != claims.UserID {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	// Token was already exchanged: someone else holds a copy of it
+	if current.RotatedAt != nil {
+		s.revokeTokenFamily(ctx, current, client)
+		return nil, errors.New("refresh token reused")
+	}
+
+	if time.Now().After(current.ExpiresAt) {
 		return nil, errors.New("invalid refresh token")
 	}
 
+	// Reload the user so the new pair reflects the current email verification state
+	u, err := s.userRepo.FindByID(ctx, current.UserID)
+	if err != nil {
+		return nil, errors.New("invalid refresh token")
+	}
+	if u.AccountState == user.AccountStateSuspended {
+		return nil, errors.New("account suspended")
+	}
+
 	// Generate new token pair
-	tokens, err := GenerateTokenPair(claims.UserID, claims.Username, s.jwtConfig)
+	tokens, err := s.keys.GenerateTokenPair(u, current.SessionID, s.emailVerificationDeadline(u))
+	if err != nil {
+		return nil, err
+	}
+
+	// Rotate refresh token
+	rotated, err := s.repo.RotateRefreshToken(ctx, current, refreshToken, tokens.RefreshToken, client, s.refreshExpiresAt())
 	if err != nil {
 		return nil, err
 	}
+	if !rotated {
+		// Concurrent exchange of the same token
+		s.revokeTokenFamily(ctx, current, client)
+		return nil, errors.New("refresh token reused")
+	}
 
-	// Update refresh token
-	if err := s.repo.UpdateRefreshToken(ctx, claims.UserID, refreshToken, tokens.RefreshToken); err != nil {
+	if err := s.repo.TrackAccessToken(ctx, current.UserID, current.SessionID, tokens.accessID, tokens.accessExpiresAt); err != nil {
 		return nil, err
 	}
 
+	s.auditLog.RecordClient(ctx, u.ID, audit.EventTokenRefresh, client.IPAddress, client.DeviceInfo, map[string]interface{}{
+		"session_id": current.SessionID,
+	})
+
 	return tokens, nil
 }
 
-func (s *Service) VerifyEmail(ctx context.Context, email, code string) error {
+// revokeTokenFamily завершает сессию, чей refresh token предъявлен повторно, и предупреждает владельца
+func (s *Service) revokeTokenFamily(ctx context.Context, reused *RefreshToken, client ClientInfo) {
+	log.Printf("SECURITY: refresh token reuse detected, revoking session %s of user %s (ip=%s, device=%q)",
+		reused.SessionID, reused.UserID, client.IPAddress, client.DeviceInfo)
+
+	if err := s.RevokeSession(ctx, reused.UserID, reused.SessionID); err != nil && err.Error() != "session not found" {
+		log.Printf("Failed to revoke session %s: %v", reused.SessionID, err)
+	}
+
+	u, err := s.userRepo.FindByID(ctx, reused.UserID)
+	if err != nil {
+		return
+	}
+
+	fullName := u.FirstName + " " + u.LastName
+	go s.emailService.SendSessionRevokedEmail(u.Email, fullName, client.DeviceInfo, client.IPAddress)
+}
+
+const (
+	verificationCodeTTL    = 15 * time.Minute
+	verificationMaxResends = 5
+)
+
+// VerifyEmail подтверждает email по коду. Если передан refresh токен этого пользователя,
+// сессия сразу получает новую пару токенов, в которой email уже подтвержден.
+func (s *Service) VerifyEmail(ctx context.Context, email, code, refreshToken string, client ClientInfo) (*TokenPair, error) {
 	u, err := s.userRepo.FindByEmail(ctx, email)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if u.EmailVerified {
-		return errors.New("email already verified")
+		return nil, errors.New("email already verified")
 	}
 
-	if u.EmailVerificationCode != code {
-		return errors.New("invalid verification code")
+	// Код живет 15 минут — на него дается ограниченное число попыток
+	attemptsKey := fmt.Sprintf("verify_email:attempts:%s", u.ID)
+	attempts, err := s.repo.IncrementCounter(ctx, attemptsKey, verificationCodeTTL)
+	if err != nil {
+		return nil, err
+	}
+	if attempts > int64(s.security.VerifyEmailMaxAttempts) {
+		return nil, errors.New("too many attempts, request a new code")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(u.EmailVerificationCode), []byte(code)) != 1 {
+		return nil, errors.New("invalid verification code")
 	}
 
 	if u.EmailVerificationExpires != nil && time.Now().After(*u.EmailVerificationExpires) {
-		return errors.New("verification code expired")
+		return nil, errors.New("verification code expired")
 	}
 
-	return s.userRepo.VerifyEmail(ctx, u.ID)
+	if err := s.userRepo.VerifyEmail(ctx, u.ID); err != nil {
+		return nil, err
+	}
+
+	s.repo.DeleteKeys(ctx, attemptsKey)
+
+	s.auditLog.RecordClient(ctx, u.ID, audit.EventEmailVerify, client.IPAddress, client.DeviceInfo, nil)
+
+	if refreshToken == "" {
+		return nil, nil
+	}
+
+	claims, err := s.keys.ParseToken(refreshToken, TokenTypeRefresh)
+	if err != nil || claims.UserID != u.ID {
+		return nil, nil
+	}
+
+	tokens, err := s.RefreshToken(ctx, refreshToken, client)
+	if err != nil {
+		// Email уже подтвержден — клиент получит новые claims при следующем обновлении токена
+		log.Printf("Failed to reissue tokens after email verification for user %s: %v", u.ID, err)
+		return nil, nil
+	}
+
+	return tokens, nil
 }
 
 func (s *Service) ResendVerification(ctx context.Context, email string) error {
@@ -233,15 +455,27 @@ func (s *Service) ResendVerification(ctx context.Context, email string) error {
 		return errors.New("email already verified")
 	}
 
+	rateKey := fmt.Sprintf("verify_email:resend:%s", u.ID)
+	count, err := s.repo.IncrementCounter(ctx, rateKey, time.Hour)
+	if err != nil {
+		return err
+	}
+	if count > verificationMaxResends {
+		return errors.New("too many requests")
+	}
+
 	// Generate new code
 	verificationCode := utils.GenerateCode(6)
-	expiresAt := time.Now().Add(15 * time.Minute)
+	expiresAt := time.Now().Add(verificationCodeTTL)
 
 	// Update verification code
 	if err := s.userRepo.UpdateVerificationCode(ctx, u.ID, verificationCode, expiresAt); err != nil {
 		return err
 	}
 
+	// New code — new attempts budget
+	s.repo.DeleteKeys(ctx, fmt.Sprintf("verify_email:attempts:%s", u.ID))
+
 	// Send email with full name
 	fullName := u.FirstName + " " + u.LastName
 	go s.emailService.SendVerificationEmail(email, fullName, verificationCode)
@@ -249,13 +483,38 @@ func (s *Service) ResendVerification(ctx context.Context, email string) error {
 	return nil
 }
 
-func (s *Service) Logout(ctx context.Context, userID string, refreshToken string) error {
+// Logout завершает текущую сессию: удаляет refresh token и отзывает access токены сессии
+func (s *Service) Logout(ctx context.Context, userID string, refreshToken string, access AccessTokenInfo) error {
 	uid, err := uuid.Parse(userID)
 	if err != nil {
 		return err
 	}
 
-	return s.repo.DeleteRefreshToken(ctx, uid, refreshToken)
+	// Сам предъявленный токен отзываем даже без sid (выдан до появления сессий)
+	if err := s.repo.RevokeAccessToken(ctx, access.ID, access.ExpiresAt); err != nil {
+		return err
+	}
+
+	if access.SessionID != uuid.Nil {
+		sid := access.SessionID.String()
+		if err := s.repo.RevokeAccessTokens(ctx, uid, func(sessionID string) bool { return sessionID == sid }); err != nil {
+			return err
+		}
+	}
+
+	if err := s.repo.DeleteRefreshToken(ctx, uid, refreshToken); err != nil {
+		return err
+	}
+
+	s.auditLog.Record(ctx, uid, audit.EventLogout, map[string]interface{}{
+		"session_id": access.SessionID,
+	})
+	return nil
+}
+
+// JWKS — открытые ключи для проверки наших токенов другими сервисами
+func (s *Service) JWKS() JWKSet {
+	return s.keys.JWKS()
 }
 
 func (s *Service) ValidateAndGetUser(ctx context.Context, userID string) (*user.UserResponse, error) {
@@ -355,3 +614,104 @@ func (s *Service) GenerateUsernameSuggestions(ctx context.Context, firstName str
 
 	return availableSuggestions, nil
 }
+
+const (
+	passwordResetCodeTTL     = 15 * time.Minute
+	passwordResetMaxAttempts = 5
+	passwordResetMaxRequests = 3
+	passwordResetWindow      = time.Hour
+)
+
+// ForgotPassword отправляет одноразовый код для сброса пароля.
+// Не сообщает, существует ли аккаунт с таким email.
+func (s *Service) ForgotPassword(ctx context.Context, email string) error {
+	rateKey := fmt.Sprintf("password_reset:rate:%s", strings.ToLower(email))
+	count, err := s.repo.IncrementCounter(ctx, rateKey, passwordResetWindow)
+	if err != nil {
+		return err
+	}
+	if count > passwordResetMaxRequests {
+		return errors.New("too many reset requests")
+	}
+
+	u, err := s.userRepo.FindByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	return s.sendPasswordReset(ctx, u)
+}
+
+// sendPasswordReset отправляет новый код сброса пароля
+func (s *Service) sendPasswordReset(ctx context.Context, u *user.User) error {
+	// Старые коды больше не действуют
+	if err := s.repo.InvalidatePasswordResets(ctx, u.ID); err != nil {
+		return err
+	}
+
+	code := utils.GenerateCode(6)
+	reset := &PasswordReset{
+		ID:        uuid.New(),
+		UserID:    u.ID,
+		CodeHash:  utils.HashToken(code),
+		ExpiresAt: time.Now().Add(passwordResetCodeTTL),
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.repo.CreatePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+
+	fullName := u.FirstName + " " + u.LastName
+	go s.emailService.SendPasswordResetEmail(u.Email, fullName, code)
+
+	return nil
+}
+
+// ResetPassword устанавливает новый пароль по коду и завершает все сессии пользователя
+func (s *Service) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	u, err := s.userRepo.FindByEmail(ctx, req.Email)
+	if err != nil {
+		return errors.New("invalid or expired reset code")
+	}
+
+	reset, err := s.repo.FindActivePasswordReset(ctx, u.ID)
+	if err != nil {
+		return errors.New("invalid or expired reset code")
+	}
+
+	// Попытка засчитывается до сравнения кода
+	attempts, err := s.repo.IncrementPasswordResetAttempts(ctx, reset.ID)
+	if err != nil {
+		return errors.New("invalid or expired reset code")
+	}
+	if attempts > passwordResetMaxAttempts {
+		s.repo.InvalidatePasswordResets(ctx, u.ID)
+		return errors.New("too many failed attempts")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashToken(req.Code)), []byte(reset.CodeHash)) != 1 {
+		return errors.New("invalid or expired reset code")
+	}
+
+	used, err := s.repo.UsePasswordReset(ctx, reset.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errors.New("invalid or expired reset code")
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, u.ID, hashedPassword); err != nil {
+		return err
+	}
+
+	s.auditLog.Record(ctx, u.ID, audit.EventPasswordReset, nil)
+
+	return s.RevokeAllSessions(ctx, u.ID)
+}
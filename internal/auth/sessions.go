@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// GetSessions возвращает устройства, на которых выполнен вход, помечая текущее
+func (s *Service) GetSessions(ctx context.Context, userID, currentSessionID uuid.UUID) ([]*Session, error) {
+	sessions, err := s.repo.GetSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if sessions == nil {
+		sessions = []*Session{}
+	}
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession завершает сессию на другом устройстве: ее refresh token перестает действовать
+func (s *Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	deleted, err := s.repo.DeleteSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	sid := sessionID.String()
+	if err := s.repo.RevokeAccessTokens(ctx, userID, func(id string) bool { return id == sid }); err != nil {
+		return err
+	}
+
+	if !deleted {
+		return errors.New("session not found")
+	}
+	return nil
+}
+
+// RevokeOtherSessions завершает все сессии, кроме текущей
+func (s *Service) RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int, error) {
+	// Токены, выданные до появления sid, не позволяют определить текущую сессию
+	if currentSessionID == uuid.Nil {
+		return 0, errors.New("current session unknown")
+	}
+
+	count, err := s.repo.DeleteOtherSessions(ctx, userID, currentSessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	current := currentSessionID.String()
+	if err := s.repo.RevokeAccessTokens(ctx, userID, func(id string) bool { return id != current }); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// RevokeAllSessions завершает все сессии пользователя, отзывает все его access токены и API ключи
+func (s *Service) RevokeAllSessions(ctx context.Context, userID uuid.UUID) error {
+	if err := s.repo.RevokeAllSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.repo.RevokeAccessTokens(ctx, userID, func(string) bool { return true }); err != nil {
+		return err
+	}
+
+	return s.RevokeAPIKeys(ctx, userID)
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"q7o/internal/common/utils"
+)
+
+// Назначение челленджа: решение для регистрации одноразовое,
+// решение для проверки username действует на серию запросов (UsernameChecksPerPoW)
+const (
+	PoWPurposeRegister = "register"
+	PoWPurposeUsername = "username"
+)
+
+const maxPoWNonceLength = 64
+
+// IssuePoWChallenge выдает челлендж; сложность растет с числом челленджей, запрошенных с IP за окно
+func (s *Service) IssuePoWChallenge(ctx context.Context, purpose, ip string) (*PoWChallenge, error) {
+	window := time.Duration(s.signup.PoWIPWindowMinutes) * time.Minute
+	count, err := s.repo.IncrementCounter(ctx, "pow:ip:"+ip, window)
+	if err != nil {
+		return nil, err
+	}
+
+	difficulty := s.signup.PoWBaseDifficulty
+	if over := count - int64(s.signup.PoWIPFreeChallenges); over > 0 {
+		// +1 бит (вдвое больше работы) при каждом удвоении лишних запросов
+		difficulty += bits.Len64(uint64(over))
+	}
+	if difficulty > s.signup.PoWMaxDifficulty {
+		difficulty = s.signup.PoWMaxDifficulty
+	}
+
+	ttl := time.Duration(s.signup.PoWChallengeTTLSeconds) * time.Second
+	challenge := utils.GenerateToken(16)
+	if err := s.repo.SetKey(ctx, "pow:challenge:"+challenge, fmt.Sprintf("%s:%d", purpose, difficulty), ttl); err != nil {
+		return nil, err
+	}
+
+	return &PoWChallenge{
+		Challenge:  challenge,
+		Difficulty: difficulty,
+		Algorithm:  "sha256",
+		ExpiresAt:  time.Now().Add(ttl),
+	}, nil
+}
+
+// VerifyProofOfWork проверяет решение "<challenge>:<nonce>" для указанного назначения
+func (s *Service) VerifyProofOfWork(ctx context.Context, purpose, solution string) error {
+	if !s.signup.PoWEnabled {
+		return nil
+	}
+	if solution == "" {
+		return errors.New("proof of work required")
+	}
+
+	challenge, nonce, ok := strings.Cut(solution, ":")
+	if !ok || challenge == "" || nonce == "" || len(nonce) > maxPoWNonceLength {
+		return errors.New("invalid proof of work")
+	}
+
+	value, err := s.repo.GetKey(ctx, "pow:challenge:"+challenge)
+	if err != nil {
+		return errors.New("invalid proof of work")
+	}
+	issuedFor, difficultyStr, _ := strings.Cut(value, ":")
+	difficulty, err := strconv.Atoi(difficultyStr)
+	if err != nil || issuedFor != purpose {
+		return errors.New("invalid proof of work")
+	}
+
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return errors.New("invalid proof of work")
+	}
+
+	maxUses := 1
+	if purpose == PoWPurposeUsername {
+		maxUses = s.signup.UsernameChecksPerPoW
+	}
+	ttl := time.Duration(s.signup.PoWChallengeTTLSeconds) * time.Second
+	uses, err := s.repo.IncrementCounter(ctx, "pow:uses:"+challenge, ttl)
+	if err != nil {
+		return err
+	}
+	if uses > int64(maxUses) {
+		return errors.New("proof of work already used")
+	}
+
+	return nil
+}
+
+func leadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// LoadDomainList читает список доменов: по одному в строке, строки с # — комментарии
+func LoadDomainList(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains[line] = true
+	}
+
+	return domains, scanner.Err()
+}
+
+// SetDisposableDomains включает запрет одноразовых почтовых доменов при регистрации и смене email
+func (s *Service) SetDisposableDomains(domains map[string]bool) {
+	s.disposableDomains = domains
+}
+
+// isDisposableEmail проверяет домен адреса и все его родительские домены
+func (s *Service) isDisposableEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 || len(s.disposableDomains) == 0 {
+		return false
+	}
+
+	domain := strings.ToLower(strings.TrimSuffix(email[at+1:], "."))
+	for domain != "" {
+		if s.disposableDomains[domain] {
+			return true
+		}
+		_, parent, ok := strings.Cut(domain, ".")
+		if !ok {
+			break
+		}
+		domain = parent
+	}
+	return false
+}
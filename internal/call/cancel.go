@@ -0,0 +1,50 @@
+package call
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// Причины отмены входящего звонка на устройствах пользователя (сигнал и push call_cancelled)
+const (
+	CancelAnsweredElsewhere = "answered_elsewhere"
+	CancelRejectedElsewhere = "rejected_elsewhere"
+	CancelTimeout           = "timeout"
+	CancelCallEnded         = "call_ended"
+	CancelForwarded         = "forwarded"
+)
+
+// cancelRinging останавливает входящий звонок на остальных устройствах userID.
+// WebSocket сигнал и push получают все устройства, кроме сессии exceptSessionID
+// (устройство, которое ответило или отклонило звонок).
+func (s *Service) cancelRinging(call *Call, userID, exceptSessionID uuid.UUID, reason string) {
+	if s.wsHub != nil {
+		data, _ := json.Marshal(map[string]string{"reason": reason})
+		s.wsHub.broadcast <- &CallSignal{
+			Type:            "call_cancelled",
+			FromID:          call.CallerID,
+			ToID:            userID,
+			CallID:          call.ID.String(),
+			Data:            data,
+			ExceptSessionID: exceptSessionID,
+		}
+	}
+
+	s.sendCancelPush(call, userID, exceptSessionID, reason)
+}
+
+// sendCancelPush убирает экран входящего звонка на устройствах, которые звонили по push
+func (s *Service) sendCancelPush(call *Call, userID, exceptSessionID uuid.UUID, reason string) {
+	if s.pushService == nil {
+		return
+	}
+
+	go func() {
+		if err := s.pushService.SendCallCancellation(context.Background(), userID, exceptSessionID, call.ID.String(), reason); err != nil {
+			log.Printf("Failed to send call cancellation push for call %s: %v", call.ID, err)
+		}
+	}()
+}
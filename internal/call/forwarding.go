@@ -0,0 +1,342 @@
+package call
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/common/utils"
+	"q7o/internal/user"
+)
+
+// Условия переадресации
+const (
+	ForwardAlways   = "always"    // всегда
+	ForwardBusy     = "busy"      // получатель уже в звонке
+	ForwardNoAnswer = "no_answer" // не ответил за TimeoutSeconds
+	ForwardOffline  = "offline"   // нет подключенных устройств и push токенов
+)
+
+const defaultForwardTimeoutSeconds = 20
+
+// ForwardingRule — куда переадресовать входящий звонок; у пользователя не больше одного правила на условие
+type ForwardingRule struct {
+	ID             uuid.UUID `json:"id"`
+	Condition      string    `json:"condition"`
+	TargetUserID   uuid.UUID `json:"target_user_id"`
+	TargetName     string    `json:"target_name"`
+	TimeoutSeconds int       `json:"timeout_seconds"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (r *Repository) GetForwardingRules(ctx context.Context, userID uuid.UUID) ([]*ForwardingRule, error) {
+	query := `
+        SELECT r.id, r.condition, r.target_user_id, u.first_name || ' ' || u.last_name,
+               r.timeout_seconds, r.enabled, r.created_at, r.updated_at
+        FROM call_forwarding_rules r
+        JOIN users u ON u.id = r.target_user_id
+        WHERE r.user_id = $1
+        ORDER BY r.created_at
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*ForwardingRule{}
+	for rows.Next() {
+		rule := &ForwardingRule{}
+		if err := rows.Scan(
+			&rule.ID, &rule.Condition, &rule.TargetUserID, &rule.TargetName,
+			&rule.TimeoutSeconds, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// UpsertForwardingRule создает правило или заменяет существующее с тем же условием
+func (r *Repository) UpsertForwardingRule(ctx context.Context, userID uuid.UUID, rule *ForwardingRule) error {
+	query := `
+        INSERT INTO call_forwarding_rules (user_id, condition, target_user_id, timeout_seconds, enabled)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT (user_id, condition) DO UPDATE SET
+            target_user_id = EXCLUDED.target_user_id,
+            timeout_seconds = EXCLUDED.timeout_seconds,
+            enabled = EXCLUDED.enabled,
+            updated_at = CURRENT_TIMESTAMP
+        RETURNING id, created_at, updated_at
+    `
+
+	return r.db.QueryRowContext(ctx, query,
+		userID, rule.Condition, rule.TargetUserID, rule.TimeoutSeconds, rule.Enabled,
+	).Scan(&rule.ID, &rule.CreatedAt, &rule.UpdatedAt)
+}
+
+func (r *Repository) DeleteForwardingRule(ctx context.Context, userID uuid.UUID, condition string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM call_forwarding_rules WHERE user_id = $1 AND condition = $2`, userID, condition)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+func (s *Service) GetForwardingRules(ctx context.Context, userID uuid.UUID) ([]*ForwardingRule, error) {
+	return s.repo.GetForwardingRules(ctx, userID)
+}
+
+// SetForwardingRule сохраняет правило; переадресовывать можно только на свой контакт
+func (s *Service) SetForwardingRule(ctx context.Context, userID uuid.UUID, req *SetForwardingRuleRequest) (*ForwardingRule, error) {
+	targetID, _ := uuid.Parse(req.TargetUserID)
+	if targetID == userID {
+		return nil, errors.New("cannot forward to yourself")
+	}
+
+	target, err := s.userRepo.FindByID(ctx, targetID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+
+	if s.contactService != nil {
+		isContact, err := s.contactService.IsContact(ctx, userID, targetID)
+		if err != nil {
+			return nil, errors.New("failed to check contact status")
+		}
+		if !isContact {
+			return nil, errors.New("user is not in your contacts")
+		}
+	}
+
+	rule := &ForwardingRule{
+		Condition:      req.Condition,
+		TargetUserID:   targetID,
+		TargetName:     target.FirstName + " " + target.LastName,
+		TimeoutSeconds: req.TimeoutSeconds,
+		Enabled:        true,
+	}
+	if rule.TimeoutSeconds == 0 {
+		rule.TimeoutSeconds = defaultForwardTimeoutSeconds
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+
+	if err := s.repo.UpsertForwardingRule(ctx, userID, rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (s *Service) DeleteForwardingRule(ctx context.Context, userID uuid.UUID, condition string) error {
+	deleted, err := s.repo.DeleteForwardingRule(ctx, userID, condition)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errors.New("forwarding rule not found")
+	}
+	return nil
+}
+
+// findForwardingRule возвращает включенное правило с условием condition
+func findForwardingRule(rules []*ForwardingRule, condition string) *ForwardingRule {
+	for _, rule := range rules {
+		if rule.Condition == condition && rule.Enabled {
+			return rule
+		}
+	}
+	return nil
+}
+
+// matchForwardingRule выбирает правило, срабатывающее сразу при звонке (always, busy, offline),
+// и того, кому звонок уйдет. nil — звоним самому получателю.
+func (s *Service) matchForwardingRule(ctx context.Context, callerID uuid.UUID, callee *user.User, rules []*ForwardingRule) (*ForwardingRule, *user.User) {
+	for _, condition := range []string{ForwardAlways, ForwardBusy, ForwardOffline} {
+		rule := findForwardingRule(rules, condition)
+		if rule == nil {
+			continue
+		}
+
+		switch condition {
+		case ForwardBusy:
+			if callee.Status != "busy" {
+				continue
+			}
+		case ForwardOffline:
+			if !s.isUnreachable(ctx, callee.ID) {
+				continue
+			}
+		}
+
+		if target := s.forwardingTarget(ctx, callerID, callee.ID, rule); target != nil {
+			return rule, target
+		}
+	}
+	return nil, nil
+}
+
+// forwardingTarget проверяет, что звонок можно отдать адресату правила:
+// это не сам звонящий, адресат свободен и все еще в контактах получателя
+func (s *Service) forwardingTarget(ctx context.Context, callerID, calleeID uuid.UUID, rule *ForwardingRule) *user.User {
+	if rule.TargetUserID == callerID {
+		return nil
+	}
+
+	target, err := s.userRepo.FindByID(ctx, rule.TargetUserID)
+	if err != nil || target.Status == "busy" {
+		return nil
+	}
+
+	if s.contactService != nil {
+		isContact, err := s.contactService.IsContact(ctx, calleeID, target.ID)
+		if err != nil || !isContact {
+			return nil
+		}
+	}
+
+	return target
+}
+
+// isUnreachable — у пользователя нет ни WebSocket соединений, ни устройств, которые можно разбудить push
+func (s *Service) isUnreachable(ctx context.Context, userID uuid.UUID) bool {
+	if s.wsHub != nil && s.wsHub.IsConnected(userID) {
+		return false
+	}
+	if s.pushService != nil {
+		if hasTokens, err := s.pushService.HasActiveTokens(ctx, userID); err != nil || hasTokens {
+			return false
+		}
+	}
+	return true
+}
+
+// forwardOnInitiate сохраняет звонок получателю сразу в конечном статусе forwarded и звонит адресату правила
+func (s *Service) forwardOnInitiate(ctx context.Context, caller, callee, target *user.User, callType string, rule *ForwardingRule) (*Call, string, string, error) {
+	now := time.Now()
+	original := &Call{
+		ID:         uuid.New(),
+		RoomName:   utils.GenerateRoomName(),
+		CallerID:   caller.ID,
+		CalleeID:   callee.ID,
+		CallerName: caller.FirstName + " " + caller.LastName,
+		CalleeName: callee.FirstName + " " + callee.LastName,
+		CallType:   callType,
+		Status:     StatusForwarded,
+		StartedAt:  now,
+		EndedAt:    &now,
+	}
+	if err := s.repo.Create(ctx, original); err != nil {
+		return nil, "", "", err
+	}
+
+	call, callerToken, calleeToken, err := s.startCall(ctx, caller, target, callType, utils.GenerateRoomName(), &original.ID, ringTimeout)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	s.notifyForwarded(original, call, rule.Condition)
+	log.Printf("Call %s from %s forwarded from %s to %s (%s)", call.ID, caller.ID, callee.ID, target.ID, rule.Condition)
+
+	return call, callerToken, calleeToken, nil
+}
+
+// forwardUnanswered срабатывает по таймауту звонка: если у получателя есть правило no_answer,
+// звонок переадресуется в новую комнату: токен исходного получателя остается от старой,
+// поэтому звонящий получает в сигнале forwarded новую комнату и токен к ней.
+// false — правила нет или адресат недоступен, звонок считается пропущенным.
+func (s *Service) forwardUnanswered(ctx context.Context, call *Call) bool {
+	rules, err := s.repo.GetForwardingRules(ctx, call.CalleeID)
+	if err != nil {
+		return false
+	}
+	rule := findForwardingRule(rules, ForwardNoAnswer)
+	if rule == nil {
+		return false
+	}
+	target := s.forwardingTarget(ctx, call.CallerID, call.CalleeID, rule)
+	if target == nil {
+		return false
+	}
+	caller, err := s.userRepo.FindByID(ctx, call.CallerID)
+	if err != nil {
+		return false
+	}
+
+	// На звонок успели ответить или его отклонили
+	if err := s.transition(ctx, call, StatusForwarded); err != nil {
+		return true
+	}
+	s.repo.CloseParticipants(ctx, call.ID)
+	s.cancelRinging(call, call.CalleeID, uuid.Nil, CancelForwarded)
+	s.clearCallFromCache(ctx, call.ID)
+	s.redis.Del(ctx, "call:token:"+call.ID.String())
+
+	forwarded, callerToken, calleeToken, err := s.startCall(ctx, caller, target, call.CallType, utils.GenerateRoomName(), &call.ID, ringTimeout)
+	if err != nil {
+		log.Printf("Failed to forward call %s to %s: %v", call.ID, target.ID, err)
+		s.userRepo.UpdateStatus(ctx, call.CallerID, "online")
+		s.notifyMissed(call)
+		return true
+	}
+
+	s.ringCallee(forwarded, calleeToken)
+
+	if s.wsHub != nil {
+		data, _ := json.Marshal(map[string]string{
+			"forwarded_from": call.ID.String(),
+			"callee_id":      target.ID.String(),
+			"room_name":      forwarded.RoomName,
+			"token":          callerToken,
+		})
+		s.wsHub.broadcast <- &CallSignal{
+			Type:       "forwarded",
+			FromID:     call.CalleeID,
+			ToID:       call.CallerID,
+			RoomName:   forwarded.RoomName,
+			CallType:   forwarded.CallType,
+			CallID:     forwarded.ID.String(),
+			CalleeName: forwarded.CalleeName,
+			Data:       data,
+		}
+	}
+	s.notifyForwarded(call, forwarded, rule.Condition)
+	log.Printf("Unanswered call %s forwarded to %s as %s", call.ID, target.ID, forwarded.ID)
+
+	return true
+}
+
+// notifyForwarded сообщает исходному получателю, кому и почему ушел его звонок
+func (s *Service) notifyForwarded(original, forwarded *Call, condition string) {
+	if s.wsHub == nil {
+		return
+	}
+
+	data, _ := json.Marshal(map[string]string{
+		"forwarded_call_id": forwarded.ID.String(),
+		"forwarded_to_id":   forwarded.CalleeID.String(),
+		"forwarded_to_name": forwarded.CalleeName,
+		"condition":         condition,
+	})
+	s.wsHub.broadcast <- &CallSignal{
+		Type:       "call_forwarded",
+		FromID:     original.CallerID,
+		ToID:       original.CalleeID,
+		CallType:   original.CallType,
+		CallID:     original.ID.String(),
+		CallerName: original.CallerName,
+		Data:       data,
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/google/uuid"
 	"log"
 	"q7o/internal/common/response"
+	"q7o/internal/common/validator"
 	"q7o/internal/push"
 )
 
@@ -69,55 +70,8 @@ func (h *Handler) InitiateCall(c *fiber.Ctx) error {
 		return response.InternalError(c, err)
 	}
 
-	// Отправляем WebSocket сигнал получателю о входящем звонке
-	signalData := map[string]interface{}{
-		"call_id":     call.ID.String(),
-		"room_name":   call.RoomName,
-		"caller_name": call.CallerName,
-		"callee_name": call.CalleeName,
-	}
-	signalJSON, _ := json.Marshal(signalData)
-
-	signal := &CallSignal{
-		Type:       "ring",
-		FromID:     callerID,
-		ToID:       calleeID,
-		RoomName:   call.RoomName,
-		CallType:   req.CallType,
-		CallID:     call.ID.String(),
-		CallerName: call.CallerName,
-		CalleeName: call.CalleeName,
-		Data:       signalJSON,
-	}
-
-	// Отправляем сигнал через WebSocket Hub
-	h.wsHub.broadcast <- signal
-
-	log.Printf("Sent ring signal from %s to %s for call %s", callerID, calleeID, call.ID)
-
-	// 🚀 КРИТИЧЕСКИ ВАЖНО: Отправляем push уведомление для фонового режима
-	// Это позволит получать звонки даже когда приложение закрыто
-	if h.service.pushService != nil {
-		go func() {
-			// ВАЖНО: Создаем новый context для горутины
-			ctx := context.Background()
-
-			pushData := &push.CallPushData{
-				CallID:     call.ID.String(),
-				CallerID:   call.CallerID.String(),
-				CallerName: call.CallerName,
-				CallType:   call.CallType,
-				RoomName:   call.RoomName,
-				Token:      calleeToken, // Передаем токен для прямого подключения
-			}
-
-			if err := h.service.pushService.SendCallNotification(ctx, call.CalleeID, pushData); err != nil {
-				log.Printf("Failed to send push notification for call %s: %v", call.ID, err)
-			} else {
-				log.Printf("Push notification sent successfully for call %s", call.ID)
-			}
-		}()
-	}
+	// Звоним получателю (или тому, на кого звонок переадресован) по WebSocket и push
+	h.service.ringCallee(call, calleeToken)
 
 	// Возвращаем токен звонящему сразу
 	return response.Success(c, fiber.Map{
@@ -140,12 +94,32 @@ func (h *Handler) AnswerCall(c *fiber.Ctx) error {
 	uid, _ := uuid.Parse(userID)
 	callID, _ := uuid.Parse(req.CallID)
 
+	before, err := h.service.GetCall(c.Context(), callID)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
 	// Обновляем статус звонка и получаем токен для callee
-	call, calleeToken, err := h.service.AnswerCall(c.Context(), callID, uid)
+	sessionID, _ := uuid.Parse(c.Locals("sessionID").(string))
+
+	call, calleeToken, err := h.service.AnswerCall(c.Context(), callID, uid, sessionID)
 	if err != nil {
 		return response.InternalError(c, err)
 	}
 
+	// Приглашенный подключился к идущему звонку — сообщаем остальным участникам
+	if before.Status == StatusAnswered {
+		h.notifyJoined(c.Context(), call, uid, "participant_joined")
+		log.Printf("User %s joined call %s", uid, call.ID)
+
+		return response.Success(c, fiber.Map{
+			"call":      call,
+			"token":     calleeToken,
+			"room_name": call.RoomName,
+			"ws_url":    h.service.GetLiveKitURL(),
+		})
+	}
+
 	// Отправляем сигнал звонящему что на звонок ответили
 	signal := &CallSignal{
 		Type:     "answered",
@@ -186,10 +160,21 @@ func (h *Handler) RejectCall(c *fiber.Ctx) error {
 		return response.InternalError(c, err)
 	}
 
-	if err := h.service.RejectCall(c.Context(), callID, uid); err != nil {
+	sessionID, _ := uuid.Parse(c.Locals("sessionID").(string))
+	if err := h.service.RejectCall(c.Context(), callID, uid, sessionID); err != nil {
 		return response.InternalError(c, err)
 	}
 
+	// Приглашенный отказался — звонок продолжается без него
+	if call.Status == StatusAnswered {
+		h.notifyJoined(c.Context(), call, uid, "participant_rejected")
+		log.Printf("User %s declined invitation to call %s", uid, call.ID)
+
+		return response.Success(c, fiber.Map{
+			"message": "Call rejected",
+		})
+	}
+
 	// Отправляем сигнал звонящему что звонок отклонен
 	signal := &CallSignal{
 		Type:   "rejected",
@@ -218,31 +203,215 @@ func (h *Handler) EndCall(c *fiber.Ctx) error {
 	uid, _ := uuid.Parse(userID)
 	callID, _ := uuid.Parse(req.CallID)
 
-	call, err := h.service.EndCall(c.Context(), callID, uid)
+	call, notify, ended, err := h.service.EndCall(c.Context(), callID, uid)
 	if err != nil {
 		return response.InternalError(c, err)
 	}
 
-	// Определяем кому отправить уведомление
-	var toID uuid.UUID
-	if call.CallerID == uid {
-		toID = call.CalleeID
+	// Звонок завершен целиком — "ended", иначе остальные участники узнают, что один вышел
+	h.service.notifyLeft(call, uid, notify, ended)
+
+	if ended {
+		log.Printf("Call %s ended by %s", call.ID, uid)
 	} else {
-		toID = call.CallerID
+		log.Printf("User %s left call %s", uid, call.ID)
 	}
 
-	// Отправляем сигнал другому участнику что звонок завершен
-	signal := &CallSignal{
-		Type:   "ended",
-		FromID: uid,
-		ToID:   toID,
-		CallID: call.ID.String(),
+	return response.Success(c, call)
+}
+
+// InviteParticipants приглашает контакты в идущий звонок: каждому уходит ring сигнал и push
+func (h *Handler) InviteParticipants(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req InviteParticipantsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
 	}
-	h.wsHub.broadcast <- signal
 
-	log.Printf("Call %s ended by %s", call.ID, uid)
+	if err := validator.ValidateStruct(req); err != nil {
+		return response.ValidationError(c, err)
+	}
 
-	return response.Success(c, call)
+	callID, _ := uuid.Parse(req.CallID)
+	userIDs := make([]uuid.UUID, 0, len(req.UserIDs))
+	for _, id := range req.UserIDs {
+		userID, _ := uuid.Parse(id)
+		userIDs = append(userIDs, userID)
+	}
+
+	call, invitations, err := h.service.InviteParticipants(c.Context(), callID, uid, userIDs)
+	if err != nil {
+		return callError(c, err)
+	}
+
+	inviterName := call.CallerName
+	if inviter, err := h.service.userRepo.FindByID(c.Context(), uid); err == nil {
+		inviterName = inviter.FirstName + " " + inviter.LastName
+	}
+
+	for _, inv := range invitations {
+		invitee := inv.Participant
+
+		signalJSON, _ := json.Marshal(map[string]interface{}{
+			"call_id":     call.ID.String(),
+			"room_name":   call.RoomName,
+			"caller_name": inviterName,
+			"callee_name": invitee.DisplayName,
+			"group":       true,
+		})
+		h.wsHub.broadcast <- &CallSignal{
+			Type:       "ring",
+			FromID:     uid,
+			ToID:       invitee.UserID,
+			RoomName:   call.RoomName,
+			CallType:   call.CallType,
+			CallID:     call.ID.String(),
+			CallerName: inviterName,
+			CalleeName: invitee.DisplayName,
+			Data:       signalJSON,
+		}
+
+		if h.service.pushService != nil {
+			pushData := &push.CallPushData{
+				CallID:     call.ID.String(),
+				CallerID:   uid.String(),
+				CallerName: inviterName,
+				CallType:   call.CallType,
+				RoomName:   call.RoomName,
+				Token:      inv.Token,
+			}
+			go func(userID uuid.UUID) {
+				if err := h.service.pushService.SendCallNotification(context.Background(), userID, pushData); err != nil {
+					log.Printf("Failed to send push notification for call %s: %v", call.ID, err)
+				}
+			}(invitee.UserID)
+		}
+
+		h.notifyInvited(c.Context(), call, uid, invitee)
+		log.Printf("User %s invited %s to call %s", uid, invitee.UserID, call.ID)
+	}
+
+	participants, err := h.service.GetParticipants(c.Context(), call.ID, uid)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"call_id":      call.ID,
+		"participants": participants,
+	})
+}
+
+// GetParticipants - участники звонка и их состояние
+func (h *Handler) GetParticipants(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	callID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return response.BadRequest(c, "Invalid call ID")
+	}
+
+	participants, err := h.service.GetParticipants(c.Context(), callID, uid)
+	if err != nil {
+		return callError(c, err)
+	}
+
+	return response.Success(c, participants)
+}
+
+// GetForwardingRules — правила переадресации текущего пользователя
+func (h *Handler) GetForwardingRules(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	rules, err := h.service.GetForwardingRules(c.Context(), uid)
+	if err != nil {
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, rules)
+}
+
+// SetForwardingRule создает или заменяет правило переадресации для условия из запроса
+func (h *Handler) SetForwardingRule(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	var req SetForwardingRuleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := validator.ValidateStruct(req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	rule, err := h.service.SetForwardingRule(c.Context(), uid, &req)
+	if err != nil {
+		return callError(c, err)
+	}
+
+	return response.Success(c, rule)
+}
+
+// DeleteForwardingRule удаляет правило переадресации с условием :condition
+func (h *Handler) DeleteForwardingRule(c *fiber.Ctx) error {
+	uid, _ := uuid.Parse(c.Locals("userID").(string))
+
+	if err := h.service.DeleteForwardingRule(c.Context(), uid, c.Params("condition")); err != nil {
+		return callError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Forwarding rule deleted",
+	})
+}
+
+// notifyJoined отправляет сигнал всем подключенным участникам звонка, кроме fromID
+func (h *Handler) notifyJoined(ctx context.Context, call *Call, fromID uuid.UUID, signalType string) {
+	for _, toID := range h.service.JoinedParticipants(ctx, call.ID, fromID) {
+		h.wsHub.broadcast <- &CallSignal{
+			Type:     signalType,
+			FromID:   fromID,
+			ToID:     toID,
+			RoomName: call.RoomName,
+			CallID:   call.ID.String(),
+		}
+	}
+}
+
+// notifyInvited сообщает подключенным участникам, кого пригласили: по сигналу на каждого приглашенного
+func (h *Handler) notifyInvited(ctx context.Context, call *Call, inviterID uuid.UUID, invitee *Participant) {
+	data, _ := json.Marshal(map[string]string{
+		"user_id":      invitee.UserID.String(),
+		"display_name": invitee.DisplayName,
+	})
+	for _, toID := range h.service.JoinedParticipants(ctx, call.ID, inviterID) {
+		h.wsHub.broadcast <- &CallSignal{
+			Type:     "participant_invited",
+			FromID:   inviterID,
+			ToID:     toID,
+			RoomName: call.RoomName,
+			CallID:   call.ID.String(),
+			Data:     data,
+		}
+	}
+}
+
+func callError(c *fiber.Ctx, err error) error {
+	switch err.Error() {
+	case "call not found":
+		return response.Error(c, fiber.StatusNotFound, "Call not found")
+	case "forwarding rule not found":
+		return response.Error(c, fiber.StatusNotFound, "Forwarding rule not found")
+	case "unauthorized":
+		return response.Error(c, fiber.StatusForbidden, "Not a participant of this call")
+	case "user is busy", "user already in call", "call is not active":
+		return response.Conflict(c, err.Error())
+	case "too many participants", "no users to invite", "user is not in your contacts", "user not found",
+		"cannot forward to yourself":
+		return response.BadRequest(c, err.Error())
+	}
+	return response.InternalError(c, err)
 }
 
 // HandleWebSocket обрабатывает WebSocket соединения для сигналинга звонков
@@ -273,15 +442,25 @@ func (h *Handler) HandleWebSocket(c *websocket.Conn, hub *WSHub) {
 	}
 
 	// Проверяем токен через сервис auth
-	valid, tokenUID, err := h.service.ValidateToken(token)
-	if err != nil || !valid {
+	claims, err := h.service.ValidateToken(context.Background(), token)
+	if err != nil && err.Error() == "account suspended" {
+		c.WriteMessage(websocket.TextMessage, []byte(`{"error":"account suspended"}`))
+		c.Close()
+		return
+	}
+	if err != nil && err.Error() == "email verification required" {
+		c.WriteMessage(websocket.TextMessage, []byte(`{"error":"email verification required"}`))
+		c.Close()
+		return
+	}
+	if err != nil {
 		c.WriteMessage(websocket.TextMessage, []byte(`{"error":"invalid token"}`))
 		c.Close()
 		return
 	}
 
 	// Проверяем что userID соответствует токену
-	if tokenUID.String() != userID {
+	if claims.UserID.String() != userID {
 		c.WriteMessage(websocket.TextMessage, []byte(`{"error":"user_id mismatch"}`))
 		c.Close()
 		return
@@ -289,13 +468,14 @@ func (h *Handler) HandleWebSocket(c *websocket.Conn, hub *WSHub) {
 
 	// Регистрируем клиента в хабе
 	client := &Client{
-		ID:   uid,
-		Conn: c,
+		ID:        uid,
+		SessionID: claims.SessionID,
+		Conn:      c,
 	}
 	hub.register <- client
 
 	// Проверяем и отправляем офлайн сигналы если есть
-	if offlineSignals, err := hub.GetOfflineSignals(uid); err == nil && len(offlineSignals) > 0 {
+	if offlineSignals, err := hub.GetOfflineSignals(uid, claims.SessionID); err == nil && len(offlineSignals) > 0 {
 		for _, signal := range offlineSignals {
 			if err := c.WriteJSON(signal); err != nil {
 				log.Printf("Error sending offline signal: %v", err)
@@ -384,3 +564,15 @@ type RejectCallRequest struct {
 type EndCallRequest struct {
 	CallID string `json:"call_id" validate:"required,uuid"`
 }
+
+type SetForwardingRuleRequest struct {
+	Condition      string `json:"condition" validate:"required,oneof=always busy no_answer offline"`
+	TargetUserID   string `json:"target_user_id" validate:"required,uuid"`
+	TimeoutSeconds int    `json:"timeout_seconds" validate:"omitempty,min=5,max=60"` // только для no_answer
+	Enabled        *bool  `json:"enabled,omitempty"`
+}
+
+type InviteParticipantsRequest struct {
+	CallID  string   `json:"call_id" validate:"required,uuid"`
+	UserIDs []string `json:"user_ids" validate:"required,min=1,max=7,dive,uuid"`
+}
@@ -0,0 +1,110 @@
+package call
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// Сверка состояния звонков с LiveKit: вебхуки сообщают, что участник на самом деле
+// покинул комнату (например, приложение упало) или комната закрылась.
+
+// LeaveRoom обрабатывает выход участника из комнаты звонка так же, как POST /calls/end.
+// Если участник уже вышел через API, ничего не происходит.
+func (s *Service) LeaveRoom(ctx context.Context, roomName string, userID uuid.UUID) error {
+	call, err := s.repo.FindByRoomName(ctx, roomName)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if isFinal(call.Status) {
+		return nil
+	}
+
+	participants, err := s.repo.GetParticipants(ctx, call.ID)
+	if err != nil {
+		return err
+	}
+	if p := findParticipant(participants, userID); p != nil {
+		if p.Status != ParticipantJoined {
+			return nil
+		}
+	} else if len(participants) > 0 || (call.CallerID != userID && call.CalleeID != userID) {
+		return nil
+	}
+
+	call, notify, ended, err := s.EndCall(ctx, call.ID, userID)
+	if err != nil {
+		return err
+	}
+	s.notifyLeft(call, userID, notify, ended)
+
+	log.Printf("User %s dropped from call %s", userID, call.ID)
+	return nil
+}
+
+// FinishRoom завершает звонок, комната которого закрылась в LiveKit
+func (s *Service) FinishRoom(ctx context.Context, roomName string) error {
+	call, err := s.repo.FindByRoomName(ctx, roomName)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if isFinal(call.Status) {
+		return nil
+	}
+
+	participants, err := s.repo.GetParticipants(ctx, call.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.finishCall(ctx, call, participants); err != nil {
+		if err.Error() == "call already processed" {
+			return nil
+		}
+		return err
+	}
+
+	notify := []uuid.UUID{call.CallerID, call.CalleeID}
+	for _, p := range participants {
+		if p.UserID != call.CallerID && p.UserID != call.CalleeID &&
+			(p.Status == ParticipantJoined || p.Status == ParticipantRinging) {
+			notify = append(notify, p.UserID)
+		}
+	}
+	s.notifyLeft(call, uuid.Nil, notify, true)
+
+	log.Printf("Call %s ended: LiveKit room finished", call.ID)
+	return nil
+}
+
+// notifyLeft сообщает участникам, что fromID вышел из звонка ("participant_left")
+// или что звонок завершен целиком ("ended")
+func (s *Service) notifyLeft(call *Call, fromID uuid.UUID, notify []uuid.UUID, ended bool) {
+	if s.wsHub == nil {
+		return
+	}
+
+	signalType := "participant_left"
+	if ended {
+		signalType = "ended"
+	}
+	for _, toID := range notify {
+		if toID == uuid.Nil {
+			continue
+		}
+		s.wsHub.broadcast <- &CallSignal{
+			Type:   signalType,
+			FromID: fromID,
+			ToID:   toID,
+			CallID: call.ID.String(),
+		}
+	}
+}
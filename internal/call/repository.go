@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+// Call — запись истории звонков. CallerID/CalleeID равны uuid.Nil, если аккаунт участника удален.
 type Call struct {
 	ID           uuid.UUID  `json:"id"`
 	RoomName     string     `json:"room_name"`
@@ -23,6 +25,32 @@ type Call struct {
 	Duration     int        `json:"duration"`
 	RecordingURL *string    `json:"recording_url,omitempty"`
 	CreatedAt    time.Time  `json:"created_at"`
+
+	// Исходный звонок, если этот создан переадресацией (см. ForwardingRule)
+	ForwardedFrom *uuid.UUID `json:"forwarded_from,omitempty"`
+
+	// Все, кто участвовал или был приглашен, включая звонящего (в истории звонков)
+	Participants []*Participant `json:"participants,omitempty"`
+}
+
+// Статусы участника звонка
+const (
+	ParticipantRinging  = "ringing"
+	ParticipantJoined   = "joined"
+	ParticipantRejected = "rejected"
+	ParticipantMissed   = "missed"
+	ParticipantLeft     = "left"
+)
+
+// Participant — участник звонка. UserID равен uuid.Nil, если аккаунт удален.
+type Participant struct {
+	UserID      uuid.UUID  `json:"user_id"`
+	DisplayName string     `json:"display_name"`
+	InvitedBy   *uuid.UUID `json:"invited_by,omitempty"`
+	Status      string     `json:"status"`
+	InvitedAt   time.Time  `json:"invited_at"`
+	JoinedAt    *time.Time `json:"joined_at,omitempty"`
+	LeftAt      *time.Time `json:"left_at,omitempty"`
 }
 
 type Repository struct {
@@ -37,14 +65,14 @@ func (r *Repository) Create(ctx context.Context, call *Call) error {
 	query := `
         INSERT INTO calls (
             id, room_name, caller_id, callee_id, caller_name, callee_name,
-            call_type, status, started_at, created_at
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            call_type, status, started_at, ended_at, created_at, forwarded_from_call_id
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
     `
 
 	_, err := r.db.ExecContext(ctx, query,
 		call.ID, call.RoomName, call.CallerID, call.CalleeID,
 		call.CallerName, call.CalleeName, call.CallType, call.Status,
-		call.StartedAt, time.Now(),
+		call.StartedAt, call.EndedAt, time.Now(), call.ForwardedFrom,
 	)
 
 	return err
@@ -52,9 +80,10 @@ func (r *Repository) Create(ctx context.Context, call *Call) error {
 
 func (r *Repository) FindByID(ctx context.Context, id uuid.UUID) (*Call, error) {
 	query := `
-        SELECT id, room_name, caller_id, callee_id, caller_name, callee_name,
+        SELECT id, room_name, COALESCE(caller_id, '00000000-0000-0000-0000-000000000000'),
+               COALESCE(callee_id, '00000000-0000-0000-0000-000000000000'), caller_name, callee_name,
                call_type, status, started_at, answered_at, ended_at, duration,
-               recording_url, created_at
+               recording_url, created_at, forwarded_from_call_id
         FROM calls 
         WHERE id = $1
     `
@@ -64,21 +93,36 @@ func (r *Repository) FindByID(ctx context.Context, id uuid.UUID) (*Call, error)
 		&call.ID, &call.RoomName, &call.CallerID, &call.CalleeID,
 		&call.CallerName, &call.CalleeName, &call.CallType, &call.Status,
 		&call.StartedAt, &call.AnsweredAt, &call.EndedAt, &call.Duration,
-		&call.RecordingURL, &call.CreatedAt,
+		&call.RecordingURL, &call.CreatedAt, &call.ForwardedFrom,
 	)
 
 	return call, err
 }
 
-func (r *Repository) UpdateStatus(ctx context.Context, id uuid.UUID, status string, answeredAt, endedAt *time.Time) error {
+// FindByRoomName находит звонок по имени комнаты LiveKit
+func (r *Repository) FindByRoomName(ctx context.Context, roomName string) (*Call, error) {
+	var id uuid.UUID
+	query := `SELECT id FROM calls WHERE room_name = $1 ORDER BY created_at DESC LIMIT 1`
+	if err := r.db.QueryRowContext(ctx, query, roomName).Scan(&id); err != nil {
+		return nil, err
+	}
+	return r.FindByID(ctx, id)
+}
+
+// TransitionStatus меняет статус, только если звонок все еще в статусе from; false — статус уже изменился
+func (r *Repository) TransitionStatus(ctx context.Context, id uuid.UUID, from, to string, answeredAt, endedAt *time.Time) (bool, error) {
 	query := `
         UPDATE calls 
-        SET status = $2, answered_at = $3, ended_at = $4
-        WHERE id = $1
+        SET status = $3, answered_at = $4, ended_at = $5
+        WHERE id = $1 AND status = $2
     `
 
-	_, err := r.db.ExecContext(ctx, query, id, status, answeredAt, endedAt)
-	return err
+	result, err := r.db.ExecContext(ctx, query, id, from, to, answeredAt, endedAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
 }
 
 func (r *Repository) UpdateDuration(ctx context.Context, id uuid.UUID, duration int) error {
@@ -89,11 +133,13 @@ func (r *Repository) UpdateDuration(ctx context.Context, id uuid.UUID, duration
 
 func (r *Repository) GetUserCalls(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*Call, error) {
 	query := `
-        SELECT id, room_name, caller_id, callee_id, caller_name, callee_name,
+        SELECT id, room_name, COALESCE(caller_id, '00000000-0000-0000-0000-000000000000'),
+               COALESCE(callee_id, '00000000-0000-0000-0000-000000000000'), caller_name, callee_name,
                call_type, status, started_at, answered_at, ended_at, duration,
-               recording_url, created_at
+               recording_url, created_at, forwarded_from_call_id
         FROM calls 
         WHERE caller_id = $1 OR callee_id = $1
+           OR id IN (SELECT call_id FROM call_participants WHERE user_id = $1)
         ORDER BY created_at DESC
         LIMIT $2 OFFSET $3
     `
@@ -111,13 +157,138 @@ func (r *Repository) GetUserCalls(ctx context.Context, userID uuid.UUID, limit,
 			&call.ID, &call.RoomName, &call.CallerID, &call.CalleeID,
 			&call.CallerName, &call.CalleeName, &call.CallType, &call.Status,
 			&call.StartedAt, &call.AnsweredAt, &call.EndedAt, &call.Duration,
-			&call.RecordingURL, &call.CreatedAt,
+			&call.RecordingURL, &call.CreatedAt, &call.ForwardedFrom,
 		)
 		if err != nil {
 			return nil, err
 		}
 		calls = append(calls, call)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.attachParticipants(ctx, calls); err != nil {
+		return nil, err
+	}
 
 	return calls, nil
 }
+
+// AddParticipant добавляет участника со статусом ringing. Повторное приглашение
+// того, кто отклонил звонок или вышел, снова переводит его в ringing.
+func (r *Repository) AddParticipant(ctx context.Context, callID uuid.UUID, p *Participant) error {
+	query := `
+        INSERT INTO call_participants (call_id, user_id, display_name, invited_by, status, invited_at, joined_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (call_id, user_id) DO UPDATE
+        SET invited_by = EXCLUDED.invited_by, status = EXCLUDED.status, invited_at = EXCLUDED.invited_at,
+            joined_at = EXCLUDED.joined_at, left_at = NULL
+    `
+	_, err := r.db.ExecContext(ctx, query,
+		callID, p.UserID, p.DisplayName, p.InvitedBy, p.Status, p.InvitedAt, p.JoinedAt,
+	)
+	return err
+}
+
+func (r *Repository) GetParticipants(ctx context.Context, callID uuid.UUID) ([]*Participant, error) {
+	query := `
+        SELECT call_id, COALESCE(user_id, '00000000-0000-0000-0000-000000000000'), display_name,
+               invited_by, status, invited_at, joined_at, left_at
+        FROM call_participants
+        WHERE call_id = $1
+        ORDER BY invited_at
+    `
+
+	byCall, err := r.queryParticipants(ctx, query, callID)
+	if err != nil {
+		return nil, err
+	}
+	return byCall[callID], nil
+}
+
+// SetParticipantStatus переводит участника из статуса from в to; false, если участник уже в другом статусе
+func (r *Repository) SetParticipantStatus(ctx context.Context, callID, userID uuid.UUID, from, to string) (bool, error) {
+	query := `
+        UPDATE call_participants
+        SET status = $4,
+            joined_at = CASE WHEN $4 = 'joined' THEN NOW() ELSE joined_at END,
+            left_at = CASE WHEN $4 = 'left' THEN NOW() ELSE left_at END
+        WHERE call_id = $1 AND user_id = $2 AND status = $3
+    `
+	result, err := r.db.ExecContext(ctx, query, callID, userID, from, to)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// CloseParticipants завершает участие всех при окончании звонка: подключенные выходят, ожидающие пропускают звонок
+func (r *Repository) CloseParticipants(ctx context.Context, callID uuid.UUID) error {
+	query := `
+        UPDATE call_participants
+        SET status = CASE WHEN status = 'joined' THEN 'left' ELSE 'missed' END,
+            left_at = CASE WHEN status = 'joined' THEN NOW() ELSE left_at END
+        WHERE call_id = $1 AND status IN ('joined', 'ringing')
+    `
+	_, err := r.db.ExecContext(ctx, query, callID)
+	return err
+}
+
+// attachParticipants загружает участников для списка звонков одним запросом
+func (r *Repository) attachParticipants(ctx context.Context, calls []*Call) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(calls))
+	for i, call := range calls {
+		ids[i] = call.ID.String()
+	}
+
+	query := `
+        SELECT call_id, COALESCE(user_id, '00000000-0000-0000-0000-000000000000'), display_name,
+               invited_by, status, invited_at, joined_at, left_at
+        FROM call_participants
+        WHERE call_id = ANY($1::uuid[])
+        ORDER BY invited_at
+    `
+
+	byCall, err := r.queryParticipants(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	for _, call := range calls {
+		call.Participants = byCall[call.ID]
+	}
+	return nil
+}
+
+func (r *Repository) queryParticipants(ctx context.Context, query string, args ...interface{}) (map[uuid.UUID][]*Participant, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byCall := make(map[uuid.UUID][]*Participant)
+	for rows.Next() {
+		var callID uuid.UUID
+		var invitedBy uuid.NullUUID
+		p := &Participant{}
+		err := rows.Scan(
+			&callID, &p.UserID, &p.DisplayName, &invitedBy,
+			&p.Status, &p.InvitedAt, &p.JoinedAt, &p.LeftAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if invitedBy.Valid {
+			p.InvitedBy = &invitedBy.UUID
+		}
+		byCall[callID] = append(byCall[callID], p)
+	}
+
+	return byCall, rows.Err()
+}
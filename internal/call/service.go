@@ -2,7 +2,9 @@ package call
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +16,8 @@ import (
 	"q7o/internal/user"
 )
 
+const maxCallParticipants = 8
+
 // ContactService interface to avoid circular dependency
 type ContactService interface {
 	IsContact(ctx context.Context, userID, contactID uuid.UUID) (bool, error)
@@ -26,21 +30,21 @@ type Service struct {
 	livekit        *LiveKitService
 	redis          *redis.Client
 	cfg            config.LiveKitConfig
-	jwtConfig      config.JWTConfig
+	authenticator  *auth.Middleware
 	wsHub          *WSHub
 	contactService ContactService
 	pushService    *push.Service // Добавляем push service
 }
 
-func NewService(repo *Repository, userRepo *user.Repository, cfg config.LiveKitConfig, jwtConfig config.JWTConfig, redis *redis.Client, wsHub *WSHub) *Service {
+func NewService(repo *Repository, userRepo *user.Repository, cfg config.LiveKitConfig, authenticator *auth.Middleware, redis *redis.Client, wsHub *WSHub) *Service {
 	return &Service{
-		repo:      repo,
-		userRepo:  userRepo,
-		livekit:   NewLiveKitService(cfg),
-		redis:     redis,
-		cfg:       cfg,
-		jwtConfig: jwtConfig,
-		wsHub:     wsHub,
+		repo:          repo,
+		userRepo:      userRepo,
+		livekit:       NewLiveKitService(cfg),
+		redis:         redis,
+		cfg:           cfg,
+		authenticator: authenticator,
+		wsHub:         wsHub,
 	}
 }
 
@@ -69,13 +73,8 @@ func (s *Service) GenerateCallToken(roomName string, userID uuid.UUID, username
 }
 
 // ValidateToken проверяет JWT токен
-func (s *Service) ValidateToken(tokenString string) (bool, uuid.UUID, error) {
-	claims, err := auth.ValidateToken(tokenString, s.jwtConfig.Secret)
-	if err != nil {
-		return false, uuid.Nil, err
-	}
-
-	return true, claims.UserID, nil
+func (s *Service) ValidateToken(ctx context.Context, tokenString string) (*auth.TokenClaims, error) {
+	return s.authenticator.AuthenticateWebSocket(ctx, tokenString)
 }
 
 func (s *Service) InitiateCall(ctx context.Context, callerID, calleeID uuid.UUID, callType string) (*Call, string, string, error) {
@@ -106,27 +105,74 @@ func (s *Service) InitiateCall(ctx context.Context, callerID, calleeID uuid.UUID
 		return nil, "", "", errors.New("caller is already in a call")
 	}
 
+	// Правила переадресации получателя: always, busy и offline срабатывают сразу,
+	// no_answer — по истечении своего таймаута (см. expireRing)
+	rules, err := s.repo.GetForwardingRules(ctx, calleeID)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if rule, target := s.matchForwardingRule(ctx, callerID, callee, rules); rule != nil {
+		return s.forwardOnInitiate(ctx, caller, callee, target, callType, rule)
+	}
+
 	if callee.Status == "busy" {
 		return nil, "", "", errors.New("user is busy")
 	}
 
-	// Генерируем уникальное имя комнаты
-	roomName := utils.GenerateRoomName()
+	timeout := ringTimeout
+	if rule := findForwardingRule(rules, ForwardNoAnswer); rule != nil {
+		timeout = time.Duration(rule.TimeoutSeconds) * time.Second
+	}
+
+	return s.startCall(ctx, caller, callee, callType, utils.GenerateRoomName(), nil, timeout)
+}
+
+// startCall создает звонок caller → callee в комнате roomName и начинает звонить.
+// forwardedFrom — исходный звонок, если этот создан переадресацией.
+func (s *Service) startCall(ctx context.Context, caller, callee *user.User, callType, roomName string, forwardedFrom *uuid.UUID, timeout time.Duration) (*Call, string, string, error) {
+	callerID, calleeID := caller.ID, callee.ID
 
 	// Создаем запись о звонке
 	call := &Call{
-		ID:         uuid.New(),
-		RoomName:   roomName,
-		CallerID:   callerID,
-		CalleeID:   calleeID,
-		CallerName: caller.FirstName + " " + caller.LastName,
-		CalleeName: callee.FirstName + " " + callee.LastName,
-		CallType:   callType,
-		Status:     "initiated",
-		StartedAt:  time.Now(),
+		ID:            uuid.New(),
+		RoomName:      roomName,
+		CallerID:      callerID,
+		CalleeID:      calleeID,
+		CallerName:    caller.FirstName + " " + caller.LastName,
+		CalleeName:    callee.FirstName + " " + callee.LastName,
+		CallType:      callType,
+		Status:        StatusInitiated,
+		StartedAt:     time.Now(),
+		ForwardedFrom: forwardedFrom,
+	}
+
+	// Таймаут на ответ ставится до создания записи: если сервер упадет раньше перехода в ringing,
+	// звонок не останется в initiated навсегда. Таймаут хранится в Redis и переживает перезапуск.
+	if err := s.scheduleTimeout(ctx, ringTimeoutMember(call.ID), timeout); err != nil {
+		return nil, "", "", err
 	}
-
 	if err := s.repo.Create(ctx, call); err != nil {
+		s.cancelTimeout(ctx, ringTimeoutMember(call.ID))
+		return nil, "", "", err
+	}
+
+	// Звонящий сразу в комнате, получатель — ожидает ответа
+	if err := s.repo.AddParticipant(ctx, call.ID, &Participant{
+		UserID:      callerID,
+		DisplayName: call.CallerName,
+		Status:      ParticipantJoined,
+		InvitedAt:   call.StartedAt,
+		JoinedAt:    &call.StartedAt,
+	}); err != nil {
+		return nil, "", "", err
+	}
+	if err := s.repo.AddParticipant(ctx, call.ID, &Participant{
+		UserID:      calleeID,
+		DisplayName: call.CalleeName,
+		InvitedBy:   &callerID,
+		Status:      ParticipantRinging,
+		InvitedAt:   call.StartedAt,
+	}); err != nil {
 		return nil, "", "", err
 	}
 
@@ -149,32 +195,79 @@ func (s *Service) InitiateCall(ctx context.Context, callerID, calleeID uuid.UUID
 	// Сохраняем информацию о звонке в Redis для быстрого доступа
 	s.storeCallInCache(ctx, call)
 
-	// Устанавливаем таймаут на ответ (60 секунд)
-	go s.handleCallTimeout(call.ID, 60*time.Second)
-
 	// Обновляем статус caller
 	s.userRepo.UpdateStatus(ctx, callerID, "calling")
 
-	// Обновляем статус звонка на "ringing" после отправки уведомления
-	call.Status = "ringing"
-	s.repo.UpdateStatus(ctx, call.ID, "ringing", nil, nil)
+	// Если собеседник успел ответить или отклонить звонок, переход не выполнится — это не ошибка
+	s.transition(ctx, call, StatusRinging)
 
 	return call, callerToken, calleeToken, nil
 }
 
-// Остальные методы остаются без изменений...
-func (s *Service) AnswerCall(ctx context.Context, callID, userID uuid.UUID) (*Call, string, error) {
+// ringCallee отправляет получателю сигнал ring на все устройства и push для фонового режима
+func (s *Service) ringCallee(call *Call, calleeToken string) {
+	signalData := map[string]interface{}{
+		"call_id":     call.ID.String(),
+		"room_name":   call.RoomName,
+		"caller_name": call.CallerName,
+		"callee_name": call.CalleeName,
+	}
+	signalJSON, _ := json.Marshal(signalData)
+
+	if s.wsHub != nil {
+		s.wsHub.broadcast <- &CallSignal{
+			Type:       "ring",
+			FromID:     call.CallerID,
+			ToID:       call.CalleeID,
+			RoomName:   call.RoomName,
+			CallType:   call.CallType,
+			CallID:     call.ID.String(),
+			CallerName: call.CallerName,
+			CalleeName: call.CalleeName,
+			Data:       signalJSON,
+		}
+		log.Printf("Sent ring signal from %s to %s for call %s", call.CallerID, call.CalleeID, call.ID)
+	}
+
+	// 🚀 КРИТИЧЕСКИ ВАЖНО: Отправляем push уведомление для фонового режима
+	// Это позволит получать звонки даже когда приложение закрыто
+	if s.pushService != nil {
+		go func() {
+			// ВАЖНО: Создаем новый context для горутины
+			ctx := context.Background()
+
+			pushData := &push.CallPushData{
+				CallID:     call.ID.String(),
+				CallerID:   call.CallerID.String(),
+				CallerName: call.CallerName,
+				CallType:   call.CallType,
+				RoomName:   call.RoomName,
+				Token:      calleeToken, // Передаем токен для прямого подключения
+			}
+
+			if err := s.pushService.SendCallNotification(ctx, call.CalleeID, pushData); err != nil {
+				log.Printf("Failed to send push notification for call %s: %v", call.ID, err)
+			} else {
+				log.Printf("Push notification sent successfully for call %s", call.ID)
+			}
+		}()
+	}
+}
+
+// AnswerCall — ответ на звонок с устройства сессии sessionID; остальные устройства пользователя перестают звонить
+func (s *Service) AnswerCall(ctx context.Context, callID, userID, sessionID uuid.UUID) (*Call, string, error) {
 	call, err := s.repo.FindByID(ctx, callID)
 	if err != nil {
 		return nil, "", err
 	}
 
-	if call.CalleeID != userID {
-		return nil, "", errors.New("unauthorized")
+	// Звонок уже идет — отвечает приглашенный участник
+	if call.Status == StatusAnswered {
+		return s.joinCall(ctx, call, userID, sessionID)
 	}
 
-	if call.Status != "initiated" && call.Status != "ringing" {
-		return nil, "", errors.New("call already processed")
+	if call.CalleeID != userID {
+		return nil, "", errors.New("unauthorized")
 	}
 
 	tokenKey := "call:token:" + callID.String()
@@ -187,16 +280,15 @@ func (s *Service) AnswerCall(ctx context.Context, callID, userID uuid.UUID) (*Ca
 		}
 	}
 
-	now := time.Now()
-	call.Status = "answered"
-	call.AnsweredAt = &now
-
-	if err := s.repo.UpdateStatus(ctx, callID, "answered", &now, nil); err != nil {
+	if err := s.transition(ctx, call, StatusAnswered); err != nil {
 		return nil, "", err
 	}
+	s.cancelTimeout(ctx, ringTimeoutMember(callID))
+	s.cancelRinging(call, userID, sessionID, CancelAnsweredElsewhere)
 
 	s.userRepo.UpdateStatus(ctx, call.CallerID, "busy")
 	s.userRepo.UpdateStatus(ctx, call.CalleeID, "busy")
+	s.repo.SetParticipantStatus(ctx, callID, userID, ParticipantRinging, ParticipantJoined)
 
 	s.storeCallInCache(ctx, call)
 	s.redis.Del(ctx, tokenKey)
@@ -204,27 +296,73 @@ func (s *Service) AnswerCall(ctx context.Context, callID, userID uuid.UUID) (*Ca
 	return call, token, nil
 }
 
-func (s *Service) RejectCall(ctx context.Context, callID, userID uuid.UUID) error {
+// joinCall подключает приглашенного участника к идущему звонку
+func (s *Service) joinCall(ctx context.Context, call *Call, userID, sessionID uuid.UUID) (*Call, string, error) {
+	joined, err := s.repo.SetParticipantStatus(ctx, call.ID, userID, ParticipantRinging, ParticipantJoined)
+	if err != nil {
+		return nil, "", err
+	}
+	if !joined {
+		return nil, "", errors.New("no pending invitation")
+	}
+	s.cancelTimeout(ctx, inviteTimeoutMember(call.ID, userID))
+	s.cancelRinging(call, userID, sessionID, CancelAnsweredElsewhere)
+
+	tokenKey := inviteTokenKey(call.ID, userID)
+	token, err := s.redis.Get(ctx, tokenKey).Result()
+	if err != nil {
+		u, err := s.userRepo.FindByID(ctx, userID)
+		if err != nil {
+			return nil, "", err
+		}
+		token, err = s.livekit.GenerateToken(call.RoomName, userID, u.Username, "participant")
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	s.redis.Del(ctx, tokenKey)
+
+	s.userRepo.UpdateStatus(ctx, userID, "busy")
+
+	return call, token, nil
+}
+
+// RejectCall — отказ с устройства сессии sessionID; остальные устройства пользователя перестают звонить
+func (s *Service) RejectCall(ctx context.Context, callID, userID, sessionID uuid.UUID) error {
 	call, err := s.repo.FindByID(ctx, callID)
 	if err != nil {
 		return err
 	}
 
-	if call.CalleeID != userID {
-		return errors.New("unauthorized")
+	// Приглашенный отклоняет участие в идущем звонке — звонок продолжается
+	if call.Status == StatusAnswered {
+		rejected, err := s.repo.SetParticipantStatus(ctx, callID, userID, ParticipantRinging, ParticipantRejected)
+		if err != nil {
+			return err
+		}
+		if !rejected {
+			return errors.New("no pending invitation")
+		}
+		s.cancelTimeout(ctx, inviteTimeoutMember(callID, userID))
+		s.cancelRinging(call, userID, sessionID, CancelRejectedElsewhere)
+		s.redis.Del(ctx, inviteTokenKey(callID, userID))
+		return nil
 	}
 
-	if call.Status != "initiated" && call.Status != "ringing" {
-		return errors.New("call already processed")
+	if call.CalleeID != userID {
+		return errors.New("unauthorized")
 	}
 
-	now := time.Now()
-	if err := s.repo.UpdateStatus(ctx, callID, "rejected", nil, &now); err != nil {
+	if err := s.transition(ctx, call, StatusRejected); err != nil {
 		return err
 	}
+	s.cancelTimeout(ctx, ringTimeoutMember(callID))
+	s.cancelRinging(call, userID, sessionID, CancelRejectedElsewhere)
 
 	s.userRepo.UpdateStatus(ctx, call.CallerID, "online")
 	s.userRepo.UpdateStatus(ctx, call.CalleeID, "online")
+	s.repo.SetParticipantStatus(ctx, callID, userID, ParticipantRinging, ParticipantRejected)
+	s.repo.CloseParticipants(ctx, callID)
 
 	tokenKey := "call:token:" + callID.String()
 	s.redis.Del(ctx, tokenKey)
@@ -233,47 +371,112 @@ func (s *Service) RejectCall(ctx context.Context, callID, userID uuid.UUID) erro
 	return nil
 }
 
-func (s *Service) EndCall(ctx context.Context, callID, userID uuid.UUID) (*Call, error) {
+// EndCall — участник кладет трубку. Звонок завершается целиком, если в нем не остается
+// двух подключенных (или одного, которому еще может ответить приглашенный).
+// Возвращает участников, которых нужно уведомить, и завершился ли звонок.
+func (s *Service) EndCall(ctx context.Context, callID, userID uuid.UUID) (*Call, []uuid.UUID, bool, error) {
 	call, err := s.repo.FindByID(ctx, callID)
 	if err != nil {
-		return nil, err
+		return nil, nil, false, err
 	}
 
-	if call.CallerID != userID && call.CalleeID != userID {
-		return nil, errors.New("unauthorized")
+	participants, err := s.repo.GetParticipants(ctx, callID)
+	if err != nil {
+		return nil, nil, false, err
 	}
 
-	if call.Status == "ended" {
-		return call, nil
+	if call.CallerID != userID && call.CalleeID != userID && findParticipant(participants, userID) == nil {
+		return nil, nil, false, errors.New("unauthorized")
 	}
 
-	now := time.Now()
+	if isFinal(call.Status) {
+		return call, nil, true, nil
+	}
+
+	var joined, ringing []uuid.UUID
+	for _, p := range participants {
+		if p.UserID == userID {
+			continue
+		}
+		switch p.Status {
+		case ParticipantJoined:
+			joined = append(joined, p.UserID)
+		case ParticipantRinging:
+			ringing = append(ringing, p.UserID)
+		}
+	}
+
+	if call.Status == StatusAnswered && (len(joined) >= 2 || (len(joined) == 1 && len(ringing) > 0)) {
+		if _, err := s.repo.SetParticipantStatus(ctx, callID, userID, ParticipantJoined, ParticipantLeft); err != nil {
+			return nil, nil, false, err
+		}
+		s.userRepo.UpdateStatus(ctx, userID, "online")
+		return call, joined, false, nil
+	}
+
+	// Звонки без записей об участниках: уведомляем вторую сторону, как раньше
+	if len(joined) == 0 && len(ringing) == 0 {
+		other := call.CallerID
+		if other == userID {
+			other = call.CalleeID
+		}
+		if other != uuid.Nil {
+			joined = append(joined, other)
+		}
+	}
+
+	if err := s.finishCall(ctx, call, participants); err != nil {
+		// Звонок одновременно завершил другой участник или таймаут
+		if err.Error() == "call already processed" {
+			return call, nil, true, nil
+		}
+		return nil, nil, false, err
+	}
+
+	// Звонок завершен: уведомляем и подключенных, и тех, у кого он еще звонит
+	return call, append(joined, ringing...), true, nil
+}
+
+// finishCall завершает звонок для всех участников
+func (s *Service) finishCall(ctx context.Context, call *Call, participants []*Participant) error {
+	if err := s.transition(ctx, call, StatusEnded); err != nil {
+		return err
+	}
+	s.cancelTimeout(ctx, ringTimeoutMember(call.ID))
 
 	if call.AnsweredAt != nil {
-		duration := int(now.Sub(*call.AnsweredAt).Seconds())
+		duration := int(call.EndedAt.Sub(*call.AnsweredAt).Seconds())
 		call.Duration = duration
-		s.repo.UpdateDuration(ctx, callID, duration)
+		s.repo.UpdateDuration(ctx, call.ID, duration)
 	}
 
-	call.Status = "ended"
-	call.EndedAt = &now
-
-	if err := s.repo.UpdateStatus(ctx, callID, "ended", nil, &now); err != nil {
-		return nil, err
+	if err := s.repo.CloseParticipants(ctx, call.ID); err != nil {
+		return err
 	}
 
 	s.userRepo.UpdateStatus(ctx, call.CallerID, "online")
 	s.userRepo.UpdateStatus(ctx, call.CalleeID, "online")
+	for _, p := range participants {
+		if p.Status == ParticipantJoined && p.UserID != uuid.Nil {
+			s.userRepo.UpdateStatus(ctx, p.UserID, "online")
+		}
+		if p.Status == ParticipantRinging {
+			// WebSocket сигнал "ended" участники получают от вызывающего кода, push — здесь
+			s.sendCancelPush(call, p.UserID, uuid.Nil, CancelCallEnded)
+			s.cancelTimeout(ctx, inviteTimeoutMember(call.ID, p.UserID))
+			s.redis.Del(ctx, inviteTokenKey(call.ID, p.UserID))
+		}
+	}
 
 	if s.contactService != nil && call.Duration > 0 {
 		s.contactService.UpdateLastCallTime(ctx, call.CallerID, call.CalleeID)
 	}
 
 	s.clearCallFromCache(ctx, call.ID)
-	tokenKey := "call:token:" + callID.String()
+	tokenKey := "call:token:" + call.ID.String()
 	s.redis.Del(ctx, tokenKey)
 
-	return call, nil
+	return nil
 }
 
 func (s *Service) GetCall(ctx context.Context, callID uuid.UUID) (*Call, error) {
@@ -290,36 +493,143 @@ func (s *Service) GetCallHistory(ctx context.Context, userID uuid.UUID, limit, o
 	return s.repo.GetUserCalls(ctx, userID, limit, offset)
 }
 
-func (s *Service) handleCallTimeout(callID uuid.UUID, timeout time.Duration) {
-	time.Sleep(timeout)
+// Invitation — приглашение в идущий звонок с токеном LiveKit для приглашенного
+type Invitation struct {
+	Participant *Participant
+	Token       string
+}
 
-	ctx := context.Background()
+// InviteParticipants приглашает контакты в идущий звонок; приглашать может любой подключенный участник
+func (s *Service) InviteParticipants(ctx context.Context, callID, inviterID uuid.UUID, userIDs []uuid.UUID) (*Call, []*Invitation, error) {
 	call, err := s.repo.FindByID(ctx, callID)
 	if err != nil {
-		return
+		return nil, nil, errors.New("call not found")
+	}
+	if call.Status != StatusAnswered {
+		return nil, nil, errors.New("call is not active")
 	}
 
-	if call.Status == "initiated" || call.Status == "ringing" {
-		now := time.Now()
-		s.repo.UpdateStatus(ctx, callID, "missed", nil, &now)
+	participants, err := s.repo.GetParticipants(ctx, callID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p := findParticipant(participants, inviterID); p == nil || p.Status != ParticipantJoined {
+		return nil, nil, errors.New("unauthorized")
+	}
+
+	active := 0
+	for _, p := range participants {
+		if p.Status == ParticipantJoined || p.Status == ParticipantRinging {
+			active++
+		}
+	}
 
-		s.userRepo.UpdateStatus(ctx, call.CallerID, "online")
-		s.userRepo.UpdateStatus(ctx, call.CalleeID, "online")
+	var invitees []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range userIDs {
+		if id == inviterID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		if p := findParticipant(participants, id); p != nil && (p.Status == ParticipantJoined || p.Status == ParticipantRinging) {
+			return nil, nil, errors.New("user already in call")
+		}
+		invitees = append(invitees, id)
+	}
+	if len(invitees) == 0 {
+		return nil, nil, errors.New("no users to invite")
+	}
+	if active+len(invitees) > maxCallParticipants {
+		return nil, nil, errors.New("too many participants")
+	}
 
-		if s.wsHub != nil {
-			signal := &CallSignal{
-				Type:   "missed",
-				FromID: call.CalleeID,
-				ToID:   call.CallerID,
-				CallID: call.ID.String(),
+	var invitations []*Invitation
+	for _, id := range invitees {
+		if s.contactService != nil {
+			isContact, err := s.contactService.IsContact(ctx, inviterID, id)
+			if err != nil {
+				return nil, nil, errors.New("failed to check contact status")
 			}
-			s.wsHub.broadcast <- signal
+			if !isContact {
+				return nil, nil, errors.New("user is not in your contacts")
+			}
+		}
+
+		invitee, err := s.userRepo.FindByID(ctx, id)
+		if err != nil {
+			return nil, nil, errors.New("user not found")
+		}
+		if invitee.Status == "busy" {
+			return nil, nil, errors.New("user is busy")
+		}
+
+		token, err := s.livekit.GenerateToken(call.RoomName, id, invitee.Username, "participant")
+		if err != nil {
+			return nil, nil, err
 		}
 
-		s.clearCallFromCache(ctx, callID)
-		tokenKey := "call:token:" + callID.String()
-		s.redis.Del(ctx, tokenKey)
+		invitations = append(invitations, &Invitation{
+			Participant: &Participant{
+				UserID:      id,
+				DisplayName: invitee.FirstName + " " + invitee.LastName,
+				InvitedBy:   &inviterID,
+				Status:      ParticipantRinging,
+				InvitedAt:   time.Now(),
+			},
+			Token: token,
+		})
+	}
+
+	for _, inv := range invitations {
+		if err := s.repo.AddParticipant(ctx, callID, inv.Participant); err != nil {
+			return nil, nil, err
+		}
+		s.redis.Set(ctx, inviteTokenKey(callID, inv.Participant.UserID), inv.Token, inviteTimeout)
+		s.scheduleTimeout(ctx, inviteTimeoutMember(callID, inv.Participant.UserID), inviteTimeout)
+	}
+
+	return call, invitations, nil
+}
+
+// GetParticipants возвращает участников звонка; видеть их может только участник
+func (s *Service) GetParticipants(ctx context.Context, callID, userID uuid.UUID) ([]*Participant, error) {
+	participants, err := s.repo.GetParticipants(ctx, callID)
+	if err != nil {
+		return nil, err
 	}
+	if findParticipant(participants, userID) == nil {
+		return nil, errors.New("unauthorized")
+	}
+	return participants, nil
+}
+
+// JoinedParticipants возвращает подключенных к звонку, кроме exceptID
+func (s *Service) JoinedParticipants(ctx context.Context, callID, exceptID uuid.UUID) []uuid.UUID {
+	participants, err := s.repo.GetParticipants(ctx, callID)
+	if err != nil {
+		return nil
+	}
+
+	var ids []uuid.UUID
+	for _, p := range participants {
+		if p.Status == ParticipantJoined && p.UserID != exceptID {
+			ids = append(ids, p.UserID)
+		}
+	}
+	return ids
+}
+
+func findParticipant(participants []*Participant, userID uuid.UUID) *Participant {
+	for _, p := range participants {
+		if p.UserID == userID {
+			return p
+		}
+	}
+	return nil
+}
+
+func inviteTokenKey(callID, userID uuid.UUID) string {
+	return "call:token:" + callID.String() + ":" + userID.String()
 }
 
 func (s *Service) storeCallInCache(ctx context.Context, call *Call) {
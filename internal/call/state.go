@@ -0,0 +1,70 @@
+package call
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Статусы звонка
+const (
+	StatusInitiated = "initiated"
+	StatusRinging   = "ringing"
+	StatusAnswered  = "answered"
+	StatusEnded     = "ended"
+	StatusMissed    = "missed"
+	StatusRejected  = "rejected"
+	StatusForwarded = "forwarded" // звонок переадресован, разговор идет в новой записи
+)
+
+// callTransitions — допустимые переходы статуса звонка; ended, missed, rejected и forwarded — конечные
+var callTransitions = map[string][]string{
+	StatusInitiated: {StatusRinging, StatusAnswered, StatusRejected, StatusMissed, StatusEnded, StatusForwarded},
+	StatusRinging:   {StatusAnswered, StatusRejected, StatusMissed, StatusEnded, StatusForwarded},
+	StatusAnswered:  {StatusEnded},
+}
+
+func canTransition(from, to string) bool {
+	for _, status := range callTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isFinal сообщает, что звонок уже завершен и его статус больше не меняется
+func isFinal(status string) bool {
+	return status == StatusEnded || status == StatusMissed || status == StatusRejected || status == StatusForwarded
+}
+
+// transition — единственное место, где меняется статус звонка. Обновление условное
+// (WHERE status = прежний): если статус успел изменить другой запрос или другой инстанс,
+// возвращается "call already processed" и звонок остается как есть.
+func (s *Service) transition(ctx context.Context, call *Call, to string) error {
+	if !canTransition(call.Status, to) {
+		return errors.New("call already processed")
+	}
+
+	now := time.Now()
+	answeredAt, endedAt := call.AnsweredAt, call.EndedAt
+	switch to {
+	case StatusAnswered:
+		answeredAt = &now
+	case StatusEnded, StatusMissed, StatusRejected, StatusForwarded:
+		endedAt = &now
+	}
+
+	updated, err := s.repo.TransitionStatus(ctx, call.ID, call.Status, to, answeredAt, endedAt)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return errors.New("call already processed")
+	}
+
+	call.Status = to
+	call.AnsweredAt = answeredAt
+	call.EndedAt = endedAt
+	return nil
+}
@@ -0,0 +1,217 @@
+package call
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Таймауты звонков хранятся в Redis ZSET с временем срабатывания в качестве score,
+// поэтому переживают перезапуск и обрабатываются любым инстансом
+const (
+	callTimeoutsKey     = "call:timeouts"
+	ringTimeout         = 60 * time.Second
+	inviteTimeout       = 60 * time.Second
+	timeoutPollInterval = time.Second
+	timeoutClaimLease   = 30 * time.Second
+	timeoutBatchSize    = 100
+)
+
+// claimTimeoutScript забирает истекший таймаут, сдвигая его на время аренды: другие инстансы
+// его не возьмут, а если обработчик упадет, таймаут снова станет доступен после аренды
+var claimTimeoutScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+    redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+    return 1
+end
+return 0
+`)
+
+// releaseTimeoutScript удаляет обработанный таймаут, только если его score все еще равен
+// взятой аренде: если таймаут за это время перепланировали, он останется в очереди
+var releaseTimeoutScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) == tonumber(ARGV[2]) then
+    return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+func ringTimeoutMember(callID uuid.UUID) string {
+	return "ring:" + callID.String()
+}
+
+func inviteTimeoutMember(callID, userID uuid.UUID) string {
+	return "invite:" + callID.String() + ":" + userID.String()
+}
+
+func (s *Service) scheduleTimeout(ctx context.Context, member string, after time.Duration) error {
+	deadline := time.Now().Add(after).UnixMilli()
+	err := s.redis.ZAdd(ctx, callTimeoutsKey, redis.Z{Score: float64(deadline), Member: member}).Err()
+	if err != nil {
+		log.Printf("Failed to schedule call timeout %s: %v", member, err)
+	}
+	return err
+}
+
+func (s *Service) cancelTimeout(ctx context.Context, member string) {
+	s.redis.ZRem(ctx, callTimeoutsKey, member)
+}
+
+// RunTimeouts обрабатывает истекшие таймауты звонков, пока не отменен ctx
+func (s *Service) RunTimeouts(ctx context.Context) {
+	ticker := time.NewTicker(timeoutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.processDueTimeouts(ctx)
+		}
+	}
+}
+
+func (s *Service) processDueTimeouts(ctx context.Context) {
+	now := time.Now().UnixMilli()
+	members, err := s.redis.ZRangeByScore(ctx, callTimeoutsKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now, 10),
+		Count: timeoutBatchSize,
+	}).Result()
+	if err != nil {
+		log.Printf("Failed to load call timeouts: %v", err)
+		return
+	}
+
+	lease := time.Now().Add(timeoutClaimLease).UnixMilli()
+	for _, member := range members {
+		claimed, err := claimTimeoutScript.Run(ctx, s.redis, []string{callTimeoutsKey}, member, now, lease).Int()
+		if err != nil || claimed == 0 {
+			continue
+		}
+
+		s.handleTimeout(ctx, member)
+		releaseTimeoutScript.Run(ctx, s.redis, []string{callTimeoutsKey}, member, lease)
+	}
+}
+
+func (s *Service) handleTimeout(ctx context.Context, member string) {
+	kind, rest, _ := strings.Cut(member, ":")
+	switch kind {
+	case "ring":
+		if callID, err := uuid.Parse(rest); err == nil {
+			s.expireRing(ctx, callID)
+		}
+	case "invite":
+		callStr, userStr, _ := strings.Cut(rest, ":")
+		callID, err := uuid.Parse(callStr)
+		if err != nil {
+			return
+		}
+		if userID, err := uuid.Parse(userStr); err == nil {
+			s.expireInvite(ctx, callID, userID)
+		}
+	}
+}
+
+// expireRing — на звонок не ответили вовремя
+func (s *Service) expireRing(ctx context.Context, callID uuid.UUID) {
+	call, err := s.repo.FindByID(ctx, callID)
+	if err != nil {
+		return
+	}
+
+	// Переадресованный звонок дальше не переадресуется
+	if call.ForwardedFrom == nil && s.forwardUnanswered(ctx, call) {
+		return
+	}
+
+	// Уже отвечен, отклонен или завершен — переход не разрешен или проигран гонку
+	if err := s.transition(ctx, call, StatusMissed); err != nil {
+		return
+	}
+	s.repo.CloseParticipants(ctx, callID)
+	s.cancelRinging(call, call.CalleeID, uuid.Nil, CancelTimeout)
+
+	s.userRepo.UpdateStatus(ctx, call.CallerID, "online")
+	s.userRepo.UpdateStatus(ctx, call.CalleeID, "online")
+	s.notifyMissed(call)
+
+	s.clearCallFromCache(ctx, callID)
+	tokenKey := "call:token:" + callID.String()
+	s.redis.Del(ctx, tokenKey)
+}
+
+// notifyMissed сообщает звонящему, что на звонок не ответили
+func (s *Service) notifyMissed(call *Call) {
+	if s.wsHub != nil {
+		signal := &CallSignal{
+			Type:   "missed",
+			FromID: call.CalleeID,
+			ToID:   call.CallerID,
+			CallID: call.ID.String(),
+		}
+		s.wsHub.broadcast <- signal
+	}
+}
+
+// expireInvite отмечает приглашение пропущенным. Если в звонке остался один участник
+// и больше никто не может подключиться, звонок завершается.
+func (s *Service) expireInvite(ctx context.Context, callID, userID uuid.UUID) {
+	missed, err := s.repo.SetParticipantStatus(ctx, callID, userID, ParticipantRinging, ParticipantMissed)
+	if err != nil || !missed {
+		return
+	}
+	s.redis.Del(ctx, inviteTokenKey(callID, userID))
+
+	call, err := s.repo.FindByID(ctx, callID)
+	if err != nil {
+		return
+	}
+	s.cancelRinging(call, userID, uuid.Nil, CancelTimeout)
+	if call.Status != StatusAnswered {
+		return
+	}
+	participants, err := s.repo.GetParticipants(ctx, callID)
+	if err != nil {
+		return
+	}
+
+	var joined []uuid.UUID
+	ringing := 0
+	for _, p := range participants {
+		switch p.Status {
+		case ParticipantJoined:
+			joined = append(joined, p.UserID)
+		case ParticipantRinging:
+			ringing++
+		}
+	}
+
+	signalType := "participant_missed"
+	if len(joined) < 2 && ringing == 0 {
+		if err := s.finishCall(ctx, call, participants); err != nil {
+			return
+		}
+		signalType = "ended"
+	}
+
+	if s.wsHub != nil {
+		for _, id := range joined {
+			s.wsHub.broadcast <- &CallSignal{
+				Type:   signalType,
+				FromID: userID,
+				ToID:   id,
+				CallID: callID.String(),
+			}
+		}
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 type CallSignal struct {
-	Type       string          `json:"type"` // offer, answer, ice-candidate, ring, hangup, answered, rejected, ended, missed, contact_request_received, contact_request_accepted, contact_request_rejected, contact_removed
+	Type       string          `json:"type"` // offer, answer, ice-candidate, ring, hangup, answered, rejected, ended, missed, call_cancelled, forwarded, call_forwarded, participant_invited, participant_joined, participant_rejected, participant_missed, participant_left, contact_request_received, contact_request_accepted, contact_request_rejected, contact_removed
 	FromID     uuid.UUID       `json:"from_id"`
 	ToID       uuid.UUID       `json:"to_id"`
 	RoomName   string          `json:"room_name,omitempty"`
@@ -21,31 +21,58 @@ type CallSignal struct {
 	CallerName string          `json:"caller_name,omitempty"`
 	CalleeName string          `json:"callee_name,omitempty"`
 	Data       json.RawMessage `json:"data,omitempty"`
+
+	// Устройство этой сессии сигнал не получает (например, то, которое ответило на звонок)
+	ExceptSessionID uuid.UUID `json:"-"`
 }
 
+// WSHub держит все соединения пользователя: он может быть подключен с нескольких устройств,
+// и сигнал получает каждое из них
 type WSHub struct {
-	clients    map[uuid.UUID]*websocket.Conn
+	clients    map[uuid.UUID]map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
+	disconnect chan uuid.UUID
 	broadcast  chan *CallSignal
+	presence   chan presenceQuery
 	redis      *redis.Client
 }
 
+type presenceQuery struct {
+	userID uuid.UUID
+	reply  chan bool
+}
+
 type Client struct {
-	ID   uuid.UUID
-	Conn *websocket.Conn
+	ID        uuid.UUID
+	SessionID uuid.UUID // сессия, токеном которой подключилось устройство
+	Conn      *websocket.Conn
 }
 
 func NewWSHub(redis *redis.Client) *WSHub {
 	return &WSHub{
-		clients:    make(map[uuid.UUID]*websocket.Conn),
+		clients:    make(map[uuid.UUID]map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		disconnect: make(chan uuid.UUID),
 		broadcast:  make(chan *CallSignal),
+		presence:   make(chan presenceQuery),
 		redis:      redis,
 	}
 }
 
+// Disconnect закрывает WebSocket соединение пользователя (например, после блокировки аккаунта)
+func (h *WSHub) Disconnect(userID uuid.UUID) {
+	h.disconnect <- userID
+}
+
+// IsConnected сообщает, подключено ли сейчас хотя бы одно устройство пользователя
+func (h *WSHub) IsConnected(userID uuid.UUID) bool {
+	reply := make(chan bool, 1)
+	h.presence <- presenceQuery{userID: userID, reply: reply}
+	return <-reply
+}
+
 // Broadcast returns the broadcast channel for sending signals
 func (h *WSHub) Broadcast() chan<- *CallSignal {
 	return h.broadcast
@@ -55,15 +82,31 @@ func (h *WSHub) Run() {
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client.ID] = client.Conn
-			log.Printf("Client %s connected", client.ID)
+			if h.clients[client.ID] == nil {
+				h.clients[client.ID] = make(map[*Client]bool)
+			}
+			h.clients[client.ID][client] = true
+			log.Printf("Client %s connected (%d devices)", client.ID, len(h.clients[client.ID]))
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client.ID]; ok {
-				delete(h.clients, client.ID)
+			if h.clients[client.ID][client] {
+				h.removeClient(client)
 				log.Printf("Client %s disconnected", client.ID)
 			}
 
+		case userID := <-h.disconnect:
+			for client := range h.clients[userID] {
+				client.Conn.WriteJSON(map[string]interface{}{"type": "disconnected", "reason": "account suspended"})
+				client.Conn.Close()
+			}
+			if _, ok := h.clients[userID]; ok {
+				delete(h.clients, userID)
+				log.Printf("Client %s disconnected by server", userID)
+			}
+
+		case q := <-h.presence:
+			q.reply <- len(h.clients[q.userID]) > 0
+
 		case signal := <-h.broadcast:
 			// Validate signal before sending
 			if signal.Type == "" || signal.ToID == uuid.Nil {
@@ -71,30 +114,57 @@ func (h *WSHub) Run() {
 				continue
 			}
 
-			// Send to specific client
-			if conn, ok := h.clients[signal.ToID]; ok {
-				// Log what we're sending
+			clients := h.clients[signal.ToID]
+			if len(clients) == 0 {
+				// Store in Redis for offline delivery
+				h.storeOfflineSignal(signal)
+				log.Printf("Stored offline signal for %s", signal.ToID)
+				continue
+			}
+
+			// Send to every connected device of the user
+			for client := range clients {
+				if signal.ExceptSessionID != uuid.Nil && client.SessionID == signal.ExceptSessionID {
+					continue
+				}
+
 				log.Printf("Sending %s signal to %s: %+v", signal.Type, signal.ToID, signal)
-				
-				if err := conn.WriteJSON(signal); err != nil {
+
+				if err := client.Conn.WriteJSON(signal); err != nil {
 					log.Printf("Error sending signal: %v", err)
-					conn.Close()
-					delete(h.clients, signal.ToID)
+					client.Conn.Close()
+					h.removeClient(client)
 				} else {
 					log.Printf("Successfully sent %s signal to %s", signal.Type, signal.ToID)
 				}
-			} else {
-				// Store in Redis for offline delivery
-				h.storeOfflineSignal(signal)
-				log.Printf("Stored offline signal for %s", signal.ToID)
 			}
 		}
 	}
 }
 
+func (h *WSHub) removeClient(client *Client) {
+	delete(h.clients[client.ID], client)
+	if len(h.clients[client.ID]) == 0 {
+		delete(h.clients, client.ID)
+	}
+}
+
+// Офлайн сигналы хранятся в Redis списке и не удаляются при чтении: каждое устройство
+// пользователя получает их при подключении, а доставленные отмечаются для его сессии
+const (
+	offlineSignalLimit        = 100
+	offlineSignalDeliveredTTL = 24 * time.Hour
+)
+
+// offlineSignal — сигнал в списке offline_signal:<userID>
+type offlineSignal struct {
+	ID        string      `json:"id"`
+	ExpiresAt int64       `json:"expires_at"`
+	Signal    *CallSignal `json:"signal"`
+}
+
 func (h *WSHub) storeOfflineSignal(signal *CallSignal) {
 	ctx := context.Background()
-	data, _ := json.Marshal(signal)
 	key := "offline_signal:" + signal.ToID.String()
 
 	// Store longer for contact notifications than call signals
@@ -106,31 +176,70 @@ func (h *WSHub) storeOfflineSignal(signal *CallSignal) {
 		expiration = 24 * time.Hour // Keep contact notifications for 24 hours
 	}
 
-	h.redis.LPush(ctx, key, data)
-	h.redis.Expire(ctx, key, expiration)
+	data, _ := json.Marshal(&offlineSignal{
+		ID:        uuid.New().String(),
+		ExpiresAt: time.Now().Add(expiration).Unix(),
+		Signal:    signal,
+	})
+
+	pipe := h.redis.TxPipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -offlineSignalLimit, -1)
+	// Список живет, пока не истечет самый долгий сигнал в нем
+	pipe.ExpireNX(ctx, key, expiration)
+	pipe.ExpireGT(ctx, key, expiration)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to store offline signal for %s: %v", signal.ToID, err)
+	}
 }
 
-func (h *WSHub) GetOfflineSignals(userID uuid.UUID) ([]*CallSignal, error) {
+// GetOfflineSignals возвращает сигналы, которые устройство сессии sessionID еще не получало
+func (h *WSHub) GetOfflineSignals(userID, sessionID uuid.UUID) ([]*CallSignal, error) {
 	ctx := context.Background()
 	key := "offline_signal:" + userID.String()
+	deliveredKey := "offline_signal:delivered:" + userID.String() + ":" + sessionID.String()
 
 	data, err := h.redis.LRange(ctx, key, 0, -1).Result()
 	if err != nil {
 		return nil, err
 	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	delivered, err := h.redis.SMembers(ctx, deliveredKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(delivered))
+	for _, id := range delivered {
+		seen[id] = true
+	}
 
+	now := time.Now().Unix()
 	var signals []*CallSignal
+	var ids []interface{}
 	for _, d := range data {
-		var signal CallSignal
-		if err := json.Unmarshal([]byte(d), &signal); err == nil {
-			signals = append(signals, &signal)
-		} else {
+		var stored offlineSignal
+		if err := json.Unmarshal([]byte(d), &stored); err != nil || stored.Signal == nil {
 			log.Printf("Failed to unmarshal offline signal: %v, data: %s", err, d)
+			continue
+		}
+		if seen[stored.ID] || stored.ExpiresAt < now {
+			continue
 		}
+		signals = append(signals, stored.Signal)
+		ids = append(ids, stored.ID)
 	}
 
-	// Clear after retrieval
-	h.redis.Del(ctx, key)
+	if len(ids) > 0 {
+		pipe := h.redis.TxPipeline()
+		pipe.SAdd(ctx, deliveredKey, ids...)
+		pipe.Expire(ctx, deliveredKey, offlineSignalDeliveredTTL)
+		if _, err := pipe.Exec(ctx); err != nil {
+			log.Printf("Failed to mark offline signals delivered for %s: %v", userID, err)
+		}
+	}
 
 	return signals, nil
 }
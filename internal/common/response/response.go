@@ -40,6 +40,13 @@ func Conflict(c *fiber.Ctx, message string) error {
 	})
 }
 
+func TooManyRequests(c *fiber.Ctx, message string) error {
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"success": false,
+		"error":   message,
+	})
+}
+
 func InternalError(c *fiber.Ctx, err error) error {
 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 		"success": false,
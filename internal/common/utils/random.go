@@ -23,3 +23,10 @@ func GenerateRoomName() string {
 	rand.Read(b)
 	return fmt.Sprintf("room_%x", b)
 }
+
+// GenerateToken возвращает криптографически случайную строку (hex) из n байт
+func GenerateToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
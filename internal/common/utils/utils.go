@@ -15,3 +15,13 @@ func CleanString(s string) string {
 	}
 	return strings.ToLower(result.String())
 }
+
+// TruncateString обрезает строку до max символов, не разрезая многобайтовые символы.
+// Невалидные байты UTF-8 заменяются, чтобы строку можно было записать в Postgres.
+func TruncateString(s string, max int) string {
+	s = strings.ToValidUTF8(s, "�")
+	if runes := []rune(s); len(runes) > max {
+		return string(runes[:max])
+	}
+	return s
+}
@@ -3,7 +3,9 @@ package email
 import (
 	"fmt"
 	"gopkg.in/gomail.v2"
+	"html"
 	"q7o/config"
+	"time"
 )
 
 type Service struct {
@@ -29,6 +31,120 @@ func (s *Service) SendVerificationEmail(to, username, code string) error {
 	return s.sendEmail(to, subject, body)
 }
 
+func (s *Service) SendPasswordResetEmail(to, username, code string) error {
+	subject := "Reset your Q7O password"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>We received a request to reset your password. Your reset code is:</p>
+        <h1 style="color: #4CAF50; letter-spacing: 5px;">%s</h1>
+        <p>This code will expire in 15 minutes. After the reset you will be signed out on all devices.</p>
+        <p>If you didn't request a password reset, please ignore this email.</p>
+    `, username, code)
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendSessionRevokedEmail(to, username, device, ip string) error {
+	subject := "Security alert for your Q7O account"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>An old sign-in token of your account was used again, which may mean it was copied from one of your devices.</p>
+        <p>Request came from IP <b>%s</b> (%s).</p>
+        <p>We signed that device out. If this wasn't you, change your password and review your active sessions.</p>
+    `, username, html.EscapeString(ip), html.EscapeString(device))
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendAccountLockedEmail(to, username, unlockLink string, minutes int) error {
+	subject := "Your Q7O account was temporarily locked"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>We noticed too many failed sign-in attempts, so sign-in to your account is blocked for %d minutes.</p>
+        <p>If it was you, you can unlock the account right away:</p>
+        <p><a href="%s">Unlock my account</a></p>
+        <p>If it wasn't you, consider changing your password once you sign in.</p>
+    `, username, minutes, unlockLink)
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendLoginLinkEmail(to, username, loginLink, code string, minutes int) error {
+	subject := "Sign in to Q7O"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>Use the link below to sign in to your account:</p>
+        <p><a href="%s">Sign in to Q7O</a></p>
+        <p>Or enter this code in the app:</p>
+        <h1 style="color: #4CAF50; letter-spacing: 5px;">%s</h1>
+        <p>The link and the code can be used once and expire in %d minutes.</p>
+        <p>If you didn't try to sign in, please ignore this email.</p>
+    `, username, loginLink, code, minutes)
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendEmailChangeCodeEmail(to, username, code string, minutes int) error {
+	subject := "Confirm your new Q7O email address"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>Enter this code in the app to use this address for your Q7O account:</p>
+        <h1 style="color: #4CAF50; letter-spacing: 5px;">%s</h1>
+        <p>The code expires in %d minutes.</p>
+        <p>If you didn't request this change, please ignore this email.</p>
+    `, username, code, minutes)
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendEmailChangeRequestedEmail(to, username, newEmail, cancelLink string) error {
+	subject := "Your Q7O email address is about to change"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>Someone requested to change the email address of your account to <b>%s</b>.</p>
+        <p>If it wasn't you, cancel the change and change your password:</p>
+        <p><a href="%s">Cancel email change</a></p>
+    `, username, html.EscapeString(newEmail), cancelLink)
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendEmailChangedEmail(to, username, newEmail string) error {
+	subject := "Your Q7O email address was changed"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>The email address of your account was changed to <b>%s</b>.</p>
+        <p>All other devices were signed out. If it wasn't you, contact support immediately.</p>
+    `, username, html.EscapeString(newEmail))
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendAccountDeletionScheduledEmail(to, username string, deleteAt time.Time) error {
+	subject := "Your Q7O account will be deleted"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>Your account is scheduled for deletion on <b>%s</b>.</p>
+        <p>Until then you can cancel the deletion simply by signing in.</p>
+        <p>After that date your profile, contacts and settings will be removed permanently.</p>
+    `, username, deleteAt.UTC().Format("January 2, 2006 15:04 MST"))
+
+	return s.sendEmail(to, subject, body)
+}
+
+func (s *Service) SendDataExportReadyEmail(to, username, downloadLink string, expiresAt time.Time) error {
+	subject := "Your Q7O data export is ready"
+	body := fmt.Sprintf(`
+        <h2>Hello, %s!</h2>
+        <p>The copy of your data you requested is ready:</p>
+        <p><a href="%s">Download my data</a></p>
+        <p>The link is valid until <b>%s</b>.</p>
+        <p>If you didn't request an export, change your password and sign out of other devices.</p>
+    `, username, downloadLink, expiresAt.UTC().Format("January 2, 2006 15:04 MST"))
+
+	return s.sendEmail(to, subject, body)
+}
+
 func (s *Service) SendCallMissedEmail(to, callerName string) error {
 	subject := "Missed call on Q7O"
 	body := fmt.Sprintf(`
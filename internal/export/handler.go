@@ -0,0 +1,79 @@
+package export
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"q7o/internal/common/response"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{service: service}
+}
+
+// RequestExport ставит выгрузку персональных данных в очередь
+// POST /api/v1/users/me/export
+func (h *Handler) RequestExport(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	uid, _ := uuid.Parse(userID)
+
+	job, err := h.service.RequestExport(c.Context(), uid)
+	if err != nil {
+		var cooldownErr *CooldownError
+		if errors.As(err, &cooldownErr) {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(cooldownErr.RetryAfter.Seconds()))))
+			return response.TooManyRequests(c, "Export was requested recently, try again later")
+		}
+		if err.Error() == "export queue is full" {
+			return response.Error(c, fiber.StatusServiceUnavailable, "Export queue is full, try again later")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message": "Export started, you will receive an email when it is ready",
+		"export":  job,
+	})
+}
+
+// GetExportStatus возвращает состояние последней выгрузки
+// GET /api/v1/users/me/export
+func (h *Handler) GetExportStatus(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	uid, _ := uuid.Parse(userID)
+
+	job, err := h.service.GetJob(c.Context(), uid)
+	if err != nil {
+		if err.Error() == "export not found" {
+			return response.Error(c, fiber.StatusNotFound, "No export requested")
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, job)
+}
+
+// Download отдает архив по подписанной ссылке из письма
+// GET /api/v1/exports/download?token=...
+func (h *Handler) Download(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return response.BadRequest(c, "Token is required")
+	}
+
+	path, err := h.service.ArchivePath(token)
+	if err != nil {
+		return response.Error(c, fiber.StatusNotFound, "Download link is invalid or has expired")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Download(path, "q7o-export-"+time.Now().Format("2006-01-02")+".zip")
+}
@@ -0,0 +1,41 @@
+package export
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"q7o/internal/contact"
+)
+
+const (
+	JobStatusPending    = "pending"
+	JobStatusProcessing = "processing"
+	JobStatusReady      = "ready"
+	JobStatusFailed     = "failed"
+)
+
+// Job — задание на выгрузку данных пользователя; хранится в Redis
+type Job struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"-"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// CooldownError — новую выгрузку пока нельзя запросить.
+// RetryAfter передается клиенту в заголовке Retry-After.
+type CooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CooldownError) Error() string {
+	return "export recently requested"
+}
+
+// ContactRequests — входящие и исходящие заявки в контакты
+type ContactRequests struct {
+	Incoming []*contact.ContactRequestWithUser `json:"incoming"`
+	Outgoing []*contact.ContactRequestWithUser `json:"outgoing"`
+}
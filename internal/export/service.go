@@ -0,0 +1,488 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"q7o/config"
+	"q7o/internal/auth"
+	"q7o/internal/call"
+	"q7o/internal/contact"
+	"q7o/internal/email"
+	"q7o/internal/meeting"
+	"q7o/internal/push"
+	"q7o/internal/settings"
+	"q7o/internal/user"
+)
+
+// Очередь выгрузок — Redis ZSET (member — ID пользователя, score — время, с которого задание
+// можно взять), поэтому задания переживают перезапуск и обрабатываются любым инстансом
+const (
+	exportQueueKey        = "export:queue"
+	exportQueueSize       = 16
+	exportPageSize        = 500
+	exportPollInterval    = 5 * time.Second
+	exportClaimLease      = 30 * time.Minute
+	exportCleanupInterval = time.Hour
+)
+
+// claimJobScript забирает доступное задание, сдвигая его на время аренды: если обработчик
+// упадет или сервер перезапустится, задание снова станет доступно после аренды
+var claimJobScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) <= tonumber(ARGV[2]) then
+    redis.call('ZADD', KEYS[1], ARGV[3], ARGV[1])
+    return 1
+end
+return 0
+`)
+
+// releaseJobScript удаляет задание, только если его аренда не сменилась:
+// повторный запрос выгрузки за время обработки не теряется
+var releaseJobScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if score and tonumber(score) == tonumber(ARGV[2]) then
+    return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+type Service struct {
+	userRepo     *user.Repository
+	contactRepo  *contact.Repository
+	callRepo     *call.Repository
+	meetingRepo  *meeting.Repository
+	pushRepo     *push.Repository
+	settingsRepo settings.Repository
+	authRepo     *auth.Repository
+	redis        *redis.Client
+	keys         *auth.KeyManager
+	emailService *email.Service
+	cfg          config.ExportConfig
+	appURL       string
+	uploadPath   string
+}
+
+func NewService(
+	userRepo *user.Repository,
+	contactRepo *contact.Repository,
+	callRepo *call.Repository,
+	meetingRepo *meeting.Repository,
+	pushRepo *push.Repository,
+	settingsRepo settings.Repository,
+	authRepo *auth.Repository,
+	redis *redis.Client,
+	keys *auth.KeyManager,
+	emailService *email.Service,
+	cfg *config.Config,
+	uploadPath string,
+) *Service {
+	return &Service{
+		userRepo:     userRepo,
+		contactRepo:  contactRepo,
+		callRepo:     callRepo,
+		meetingRepo:  meetingRepo,
+		pushRepo:     pushRepo,
+		settingsRepo: settingsRepo,
+		authRepo:     authRepo,
+		redis:        redis,
+		keys:         keys,
+		emailService: emailService,
+		cfg:          cfg.Export,
+		appURL:       cfg.AppURL,
+		uploadPath:   uploadPath,
+	}
+}
+
+func (s *Service) linkTTL() time.Duration {
+	if s.cfg.LinkTTLHours <= 0 {
+		return 48 * time.Hour
+	}
+	return time.Duration(s.cfg.LinkTTLHours) * time.Hour
+}
+
+func jobKey(userID uuid.UUID) string {
+	return fmt.Sprintf("export:job:%s", userID)
+}
+
+func cooldownKey(userID uuid.UUID) string {
+	return fmt.Sprintf("export:cooldown:%s", userID)
+}
+
+// RequestExport ставит выгрузку в очередь. Архив собирается в фоне,
+// по готовности пользователю приходит письмо со ссылкой для скачивания.
+func (s *Service) RequestExport(ctx context.Context, userID uuid.UUID) (*Job, error) {
+	if s.cfg.CooldownHours > 0 {
+		cooldown := time.Duration(s.cfg.CooldownHours) * time.Hour
+		ok, err := s.redis.SetNX(ctx, cooldownKey(userID), 1, cooldown).Result()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			ttl, err := s.redis.TTL(ctx, cooldownKey(userID)).Result()
+			if err != nil {
+				return nil, err
+			}
+			return nil, &CooldownError{RetryAfter: ttl}
+		}
+	}
+
+	job := &Job{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Status:    JobStatusPending,
+		CreatedAt: time.Now(),
+	}
+	queued, err := s.redis.ZCard(ctx, exportQueueKey).Result()
+	if err != nil {
+		s.redis.Del(ctx, cooldownKey(userID))
+		return nil, err
+	}
+	if queued >= exportQueueSize {
+		s.redis.Del(ctx, cooldownKey(userID))
+		return nil, errors.New("export queue is full")
+	}
+
+	if err := s.saveJob(ctx, job); err != nil {
+		s.redis.Del(ctx, cooldownKey(userID))
+		return nil, err
+	}
+
+	member := redis.Z{Score: float64(time.Now().UnixMilli()), Member: userID.String()}
+	if err := s.redis.ZAdd(ctx, exportQueueKey, member).Err(); err != nil {
+		s.redis.Del(ctx, jobKey(userID), cooldownKey(userID))
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// GetJob возвращает последнюю выгрузку пользователя
+func (s *Service) GetJob(ctx context.Context, userID uuid.UUID) (*Job, error) {
+	data, err := s.redis.Get(ctx, jobKey(userID)).Result()
+	if err == redis.Nil {
+		return nil, errors.New("export not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{}
+	if err := json.Unmarshal([]byte(data), job); err != nil {
+		return nil, err
+	}
+	job.UserID = userID
+	return job, nil
+}
+
+func (s *Service) saveJob(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, jobKey(job.UserID), data, s.linkTTL()).Err()
+}
+
+// ArchivePath проверяет ссылку на скачивание и возвращает путь к архиву
+func (s *Service) ArchivePath(token string) (string, error) {
+	claims, err := s.keys.ParseScopedToken(token, auth.TokenTypeDataExport)
+	if err != nil {
+		return "", errors.New("invalid or expired link")
+	}
+
+	// jti — ID задания; проверка uuid исключает выход за пределы каталога
+	jobID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return "", errors.New("invalid or expired link")
+	}
+
+	path := s.archivePath(jobID)
+	if _, err := os.Stat(path); err != nil {
+		return "", errors.New("invalid or expired link")
+	}
+	return path, nil
+}
+
+func (s *Service) archivePath(jobID uuid.UUID) string {
+	return filepath.Join(s.cfg.Dir, jobID.String()+".zip")
+}
+
+// Run обрабатывает очередь выгрузок и удаляет архивы с истекшей ссылкой
+func (s *Service) Run(ctx context.Context) {
+	if err := os.MkdirAll(s.cfg.Dir, 0700); err != nil {
+		log.Printf("Failed to create export directory: %v", err)
+	}
+
+	poll := time.NewTicker(exportPollInterval)
+	defer poll.Stop()
+	cleanup := time.NewTicker(exportCleanupInterval)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			s.processQueue(ctx)
+		case <-cleanup.C:
+			s.cleanupExpired()
+		}
+	}
+}
+
+// processQueue обрабатывает доступные задания по одному
+func (s *Service) processQueue(ctx context.Context) {
+	now := time.Now().UnixMilli()
+	members, err := s.redis.ZRangeByScore(ctx, exportQueueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now, 10),
+		Count: exportQueueSize,
+	}).Result()
+	if err != nil {
+		log.Printf("Failed to load export queue: %v", err)
+		return
+	}
+
+	for _, member := range members {
+		lease := time.Now().Add(exportClaimLease).UnixMilli()
+		claimed, err := claimJobScript.Run(ctx, s.redis, []string{exportQueueKey}, member, time.Now().UnixMilli(), lease).Int()
+		if err != nil || claimed == 0 {
+			continue
+		}
+
+		if userID, err := uuid.Parse(member); err == nil {
+			// Задание, взятое до перезапуска, выполняется заново
+			if job, err := s.GetJob(ctx, userID); err == nil && (job.Status == JobStatusPending || job.Status == JobStatusProcessing) {
+				s.process(ctx, job)
+			}
+		}
+		releaseJobScript.Run(ctx, s.redis, []string{exportQueueKey}, member, lease)
+	}
+}
+
+func (s *Service) process(ctx context.Context, job *Job) {
+	job.Status = JobStatusProcessing
+	s.saveJob(ctx, job)
+
+	u, err := s.userRepo.FindByID(ctx, job.UserID)
+	if err == nil {
+		err = s.buildArchive(ctx, u, s.archivePath(job.ID))
+	}
+	if err != nil {
+		log.Printf("Data export %s for user %s failed: %v", job.ID, job.UserID, err)
+		s.fail(ctx, job)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.linkTTL())
+	token, err := s.keys.GenerateScopedToken(job.UserID, auth.TokenTypeDataExport, job.ID.String(), expiresAt)
+	if err != nil {
+		log.Printf("Failed to sign download link for export %s: %v", job.ID, err)
+		s.fail(ctx, job)
+		return
+	}
+
+	job.Status = JobStatusReady
+	job.CompletedAt = &now
+	job.ExpiresAt = &expiresAt
+	s.saveJob(ctx, job)
+
+	link := fmt.Sprintf("%s/api/v1/exports/download?token=%s", s.appURL, token)
+	fullName := u.FirstName + " " + u.LastName
+	go s.emailService.SendDataExportReadyEmail(u.Email, fullName, link, expiresAt)
+}
+
+// fail помечает выгрузку неудачной; неудачная выгрузка не должна блокировать повторный запрос
+func (s *Service) fail(ctx context.Context, job *Job) {
+	job.Status = JobStatusFailed
+	s.saveJob(ctx, job)
+	s.redis.Del(ctx, cooldownKey(job.UserID))
+}
+
+// buildArchive собирает ZIP во временный файл и переименовывает его только после успешной записи
+func (s *Service) buildArchive(ctx context.Context, u *user.User, path string) error {
+	tmpPath := path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	zw := zip.NewWriter(f)
+	if err := s.writeArchive(ctx, zw, u); err != nil {
+		zw.Close()
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+func (s *Service) writeArchive(ctx context.Context, zw *zip.Writer, u *user.User) error {
+	if err := writeJSON(zw, "profile.json", u); err != nil {
+		return err
+	}
+
+	userSettings, err := s.settingsRepo.GetByUserID(u.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err := writeJSON(zw, "settings.json", userSettings); err != nil {
+		return err
+	}
+
+	contacts, err := collectPages(func(limit, offset int) ([]*contact.ContactWithUser, error) {
+		return s.contactRepo.GetContacts(ctx, u.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "contacts.json", contacts); err != nil {
+		return err
+	}
+
+	var requests ContactRequests
+	if requests.Incoming, err = collectPages(func(limit, offset int) ([]*contact.ContactRequestWithUser, error) {
+		return s.contactRepo.GetIncomingRequests(ctx, u.ID, limit, offset)
+	}); err != nil {
+		return err
+	}
+	if requests.Outgoing, err = collectPages(func(limit, offset int) ([]*contact.ContactRequestWithUser, error) {
+		return s.contactRepo.GetOutgoingRequests(ctx, u.ID, limit, offset)
+	}); err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "contact_requests.json", requests); err != nil {
+		return err
+	}
+
+	calls, err := collectPages(func(limit, offset int) ([]*call.Call, error) {
+		return s.callRepo.GetUserCalls(ctx, u.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "calls.json", calls); err != nil {
+		return err
+	}
+
+	meetings, err := collectPages(func(limit, offset int) ([]*meeting.Meeting, error) {
+		return s.meetingRepo.GetUserMeetings(ctx, u.ID, limit, offset)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "meetings.json", meetings); err != nil {
+		return err
+	}
+
+	devices, err := s.pushRepo.GetActiveTokensForUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		device.Token = push.MaskToken(device.Token)
+	}
+	if err := writeJSON(zw, "devices.json", devices); err != nil {
+		return err
+	}
+
+	sessions, err := s.authRepo.GetSessions(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(zw, "sessions.json", sessions); err != nil {
+		return err
+	}
+
+	return s.writeAvatar(zw, u)
+}
+
+func (s *Service) writeAvatar(zw *zip.Writer, u *user.User) error {
+	if u.AvatarURL == nil || *u.AvatarURL == "" {
+		return nil
+	}
+
+	filename := filepath.Base(*u.AvatarURL)
+	src, err := os.Open(filepath.Join(s.uploadPath, "avatars", filename))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	w, err := zw.Create("avatar" + strings.ToLower(filepath.Ext(filename)))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, src)
+	return err
+}
+
+// cleanupExpired удаляет архивы, ссылки на которые уже истекли
+func (s *Service) cleanupExpired() {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		log.Printf("Failed to read export directory: %v", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-s.linkTTL())
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.cfg.Dir, entry.Name())); err != nil {
+			log.Printf("Failed to remove expired export %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+func writeJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// collectPages выбирает все записи постранично
+func collectPages[T any](fetch func(limit, offset int) ([]T, error)) ([]T, error) {
+	all := []T{}
+	for offset := 0; ; offset += exportPageSize {
+		page, err := fetch(exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if len(page) < exportPageSize {
+			return all, nil
+		}
+	}
+}
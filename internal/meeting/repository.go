@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"strings"
+	"time"
 )
 
 type Repository struct {
@@ -40,10 +41,10 @@ func (r *Repository) CreateMeeting(ctx context.Context, meeting *Meeting) error
 // FindByCode finds a meeting by its code
 func (r *Repository) FindByCode(ctx context.Context, code string) (*Meeting, error) {
 	query := `
-		SELECT m.id, m.meeting_code, m.room_name, m.host_id, m.title,
+		SELECT m.id, m.meeting_code, m.room_name, COALESCE(m.host_id, '00000000-0000-0000-0000-000000000000'), m.title,
 			   m.description, m.meeting_type, m.scheduled_at, m.max_participants,
 			   m.is_active, m.requires_auth, m.allow_guests, m.created_at,
-			   m.ended_at, m.expires_at, u.username as host_name,
+			   m.ended_at, m.expires_at, COALESCE(u.username, '') as host_name,
 			   (SELECT COUNT(*) FROM meeting_participants mp 
 			    WHERE mp.meeting_id = m.id AND mp.is_active = true) as participant_count
 		FROM meetings m
@@ -71,10 +72,10 @@ func (r *Repository) FindByCode(ctx context.Context, code string) (*Meeting, err
 // FindByID finds a meeting by ID
 func (r *Repository) FindByID(ctx context.Context, id uuid.UUID) (*Meeting, error) {
 	query := `
-		SELECT m.id, m.meeting_code, m.room_name, m.host_id, m.title,
+		SELECT m.id, m.meeting_code, m.room_name, COALESCE(m.host_id, '00000000-0000-0000-0000-000000000000'), m.title,
 			   m.description, m.meeting_type, m.scheduled_at, m.max_participants,
 			   m.is_active, m.requires_auth, m.allow_guests, m.created_at,
-			   m.ended_at, m.expires_at, u.username as host_name
+			   m.ended_at, m.expires_at, COALESCE(u.username, '') as host_name
 		FROM meetings m
 		LEFT JOIN users u ON m.host_id = u.id
 		WHERE m.id = $1
@@ -92,10 +93,38 @@ func (r *Repository) FindByID(ctx context.Context, id uuid.UUID) (*Meeting, erro
 	return meeting, err
 }
 
+// FindByRoomName finds a meeting by its LiveKit room name
+func (r *Repository) FindByRoomName(ctx context.Context, roomName string) (*Meeting, error) {
+	query := `
+		SELECT m.id, m.meeting_code, m.room_name, COALESCE(m.host_id, '00000000-0000-0000-0000-000000000000'), m.title,
+			   m.description, m.meeting_type, m.scheduled_at, m.max_participants,
+			   m.is_active, m.requires_auth, m.allow_guests, m.created_at,
+			   m.ended_at, m.expires_at, COALESCE(u.username, '') as host_name
+		FROM meetings m
+		LEFT JOIN users u ON m.host_id = u.id
+		WHERE m.room_name = $1
+	`
+
+	meeting := &Meeting{}
+	err := r.db.QueryRowContext(ctx, query, roomName).Scan(
+		&meeting.ID, &meeting.MeetingCode, &meeting.RoomName, &meeting.HostID,
+		&meeting.Title, &meeting.Description, &meeting.MeetingType,
+		&meeting.ScheduledAt, &meeting.MaxParticipants, &meeting.IsActive,
+		&meeting.RequiresAuth, &meeting.AllowGuests, &meeting.CreatedAt,
+		&meeting.EndedAt, &meeting.ExpiresAt, &meeting.HostName,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return meeting, err
+}
+
 // GetUserMeetings gets all meetings for a user
 func (r *Repository) GetUserMeetings(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*Meeting, error) {
 	query := `
-		SELECT DISTINCT m.id, m.meeting_code, m.room_name, m.host_id, m.title,
+		SELECT DISTINCT m.id, m.meeting_code, m.room_name, COALESCE(m.host_id, '00000000-0000-0000-0000-000000000000'), m.title,
 			   m.description, m.meeting_type, m.scheduled_at, m.max_participants,
 			   m.is_active, m.requires_auth, m.allow_guests, m.created_at,
 			   m.ended_at, m.expires_at,
@@ -159,15 +188,31 @@ func (r *Repository) AddParticipant(ctx context.Context, participant *MeetingPar
 	return err
 }
 
-// RemoveParticipant marks a participant as inactive
-func (r *Repository) RemoveParticipant(ctx context.Context, meetingID, userID uuid.UUID) error {
+// RemoveParticipant marks a participant who left the room at leftAt as inactive.
+// leftAt uses whole seconds, like LiveKit event times, so RestoreParticipant compares them directly.
+func (r *Repository) RemoveParticipant(ctx context.Context, meetingID, userID uuid.UUID, leftAt time.Time) error {
 	query := `
 		UPDATE meeting_participants 
-		SET is_active = false, left_at = CURRENT_TIMESTAMP
+		SET is_active = false, left_at = $3
 		WHERE meeting_id = $1 AND user_id = $2
 	`
 
-	_, err := r.db.ExecContext(ctx, query, meetingID, userID)
+	_, err := r.db.ExecContext(ctx, query, meetingID, userID, leftAt.Truncate(time.Second))
+	return err
+}
+
+// RestoreParticipant marks a participant who connected to the room at joinedAt as active again.
+// A join that happened before the participant left (a webhook delivered out of order) is ignored;
+// a join in the same second as the leave counts as a rejoin.
+func (r *Repository) RestoreParticipant(ctx context.Context, meetingID, userID uuid.UUID, joinedAt time.Time) error {
+	query := `
+		UPDATE meeting_participants 
+		SET is_active = true, left_at = NULL
+		WHERE meeting_id = $1 AND user_id = $2 AND is_active = false
+		  AND (left_at IS NULL OR left_at <= $3)
+	`
+
+	_, err := r.db.ExecContext(ctx, query, meetingID, userID, joinedAt.Truncate(time.Second))
 	return err
 }
 
@@ -255,7 +255,7 @@ func (s *Service) JoinMeeting(ctx context.Context, userID *uuid.UUID, req *JoinM
 // LeaveMeeting handles participant leaving
 func (s *Service) LeaveMeeting(ctx context.Context, meetingID, userID uuid.UUID) error {
 	// Mark participant as inactive
-	if err := s.repo.RemoveParticipant(ctx, meetingID, userID); err != nil {
+	if err := s.repo.RemoveParticipant(ctx, meetingID, userID, time.Now()); err != nil {
 		return err
 	}
 
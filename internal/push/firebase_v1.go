@@ -68,3 +68,26 @@ func (s *FirebaseV1Service) SendCallNotification(ctx context.Context, token stri
 	log.Printf("Successfully sent message: %s", response)
 	return nil
 }
+
+// SendCallCancellation отправляет data сообщение без уведомления: приложение перестает звонить
+func (s *FirebaseV1Service) SendCallCancellation(ctx context.Context, token string, callID, reason string) error {
+	message := &messaging.Message{
+		Token: token,
+		Data: map[string]string{
+			"type":    "call_cancelled",
+			"call_id": callID,
+			"reason":  reason,
+		},
+		Android: &messaging.AndroidConfig{
+			Priority: "high",
+		},
+	}
+
+	response, err := s.client.Send(ctx, message)
+	if err != nil {
+		return fmt.Errorf("error sending message: %v", err)
+	}
+
+	log.Printf("Successfully sent cancellation: %s", response)
+	return nil
+}
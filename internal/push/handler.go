@@ -31,7 +31,8 @@ func (h *Handler) RegisterToken(c *fiber.Ctx) error {
 		return response.ValidationError(c, err)
 	}
 
-	if err := h.service.RegisterDeviceToken(c.Context(), uid, &req); err != nil {
+	sessionID, _ := uuid.Parse(c.Locals("sessionID").(string))
+	if err := h.service.RegisterDeviceToken(c.Context(), uid, sessionID, &req); err != nil {
 		return response.InternalError(c, err)
 	}
 
@@ -18,6 +18,9 @@ type DeviceToken struct {
 	IsActive     bool      `json:"is_active"`
 	LastUsedAt   time.Time `json:"last_used_at"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	// Сессия, из которой зарегистрирован токен; uuid.Nil — неизвестна
+	SessionID uuid.UUID `json:"-"`
 }
 
 // PushNotification представляет push уведомление
@@ -89,6 +92,14 @@ type VoIPPushMessage struct {
 	} `json:"payload"`
 }
 
+// CallCancelPushMessage — payload APNs/VoIP push об отмене входящего звонка
+type CallCancelPushMessage struct {
+	APS    map[string]interface{} `json:"aps,omitempty"`
+	Type   string                 `json:"type"`
+	CallID string                 `json:"call_id"`
+	Reason string                 `json:"reason"`
+}
+
 // RegisterTokenRequest запрос на регистрацию токена
 type RegisterTokenRequest struct {
 	Token      string `json:"token" validate:"required"`
@@ -96,4 +107,12 @@ type RegisterTokenRequest struct {
 	PushType   string `json:"push_type" validate:"required,oneof=fcm apns voip"`
 	DeviceInfo string `json:"device_info,omitempty"`
 	AppVersion string `json:"app_version,omitempty"`
-}
\ No newline at end of file
+}
+
+// MaskToken скрывает push токен, оставляя только хвост: сам токен позволяет слать уведомления на устройство
+func MaskToken(token string) string {
+	if len(token) <= 6 {
+		return "******"
+	}
+	return "******" + token[len(token)-6:]
+}
@@ -21,11 +21,12 @@ func (r *Repository) RegisterDeviceToken(ctx context.Context, token *DeviceToken
 	query := `
 		INSERT INTO device_tokens (
 			id, user_id, token, device_type, push_type, device_info, 
-			app_version, is_active, last_used_at, created_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			app_version, is_active, last_used_at, created_at, session_id
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 		ON CONFLICT (user_id, token, device_type) 
 		DO UPDATE SET 
 			push_type = EXCLUDED.push_type,
+			session_id = EXCLUDED.session_id,
 			device_info = EXCLUDED.device_info,
 			app_version = EXCLUDED.app_version,
 			is_active = EXCLUDED.is_active,
@@ -35,6 +36,7 @@ func (r *Repository) RegisterDeviceToken(ctx context.Context, token *DeviceToken
 	_, err := r.db.ExecContext(ctx, query,
 		token.ID, token.UserID, token.Token, token.DeviceType, token.PushType,
 		token.DeviceInfo, token.AppVersion, token.IsActive, token.LastUsedAt, token.CreatedAt,
+		uuid.NullUUID{UUID: token.SessionID, Valid: token.SessionID != uuid.Nil},
 	)
 
 	return err
@@ -44,7 +46,7 @@ func (r *Repository) RegisterDeviceToken(ctx context.Context, token *DeviceToken
 func (r *Repository) GetActiveTokensForUser(ctx context.Context, userID uuid.UUID) ([]*DeviceToken, error) {
 	query := `
 		SELECT id, user_id, token, device_type, push_type, device_info, 
-			   app_version, is_active, last_used_at, created_at
+			   app_version, is_active, last_used_at, created_at, session_id
 		FROM device_tokens 
 		WHERE user_id = $1 AND is_active = true
 		ORDER BY last_used_at DESC
@@ -59,13 +61,16 @@ func (r *Repository) GetActiveTokensForUser(ctx context.Context, userID uuid.UUI
 	var tokens []*DeviceToken
 	for rows.Next() {
 		token := &DeviceToken{}
+		var sessionID uuid.NullUUID
 		err := rows.Scan(
 			&token.ID, &token.UserID, &token.Token, &token.DeviceType, &token.PushType,
 			&token.DeviceInfo, &token.AppVersion, &token.IsActive, &token.LastUsedAt, &token.CreatedAt,
+			&sessionID,
 		)
 		if err != nil {
 			continue
 		}
+		token.SessionID = sessionID.UUID
 		tokens = append(tokens, token)
 	}
 
@@ -76,7 +81,7 @@ func (r *Repository) GetActiveTokensForUser(ctx context.Context, userID uuid.UUI
 func (r *Repository) GetTokensByType(ctx context.Context, userID uuid.UUID, pushType string) ([]*DeviceToken, error) {
 	query := `
 		SELECT id, user_id, token, device_type, push_type, device_info, 
-			   app_version, is_active, last_used_at, created_at
+			   app_version, is_active, last_used_at, created_at, session_id
 		FROM device_tokens 
 		WHERE user_id = $1 AND push_type = $2 AND is_active = true
 		ORDER BY last_used_at DESC
@@ -91,13 +96,16 @@ func (r *Repository) GetTokensByType(ctx context.Context, userID uuid.UUID, push
 	var tokens []*DeviceToken
 	for rows.Next() {
 		token := &DeviceToken{}
+		var sessionID uuid.NullUUID
 		err := rows.Scan(
 			&token.ID, &token.UserID, &token.Token, &token.DeviceType, &token.PushType,
 			&token.DeviceInfo, &token.AppVersion, &token.IsActive, &token.LastUsedAt, &token.CreatedAt,
+			&sessionID,
 		)
 		if err != nil {
 			continue
 		}
+		token.SessionID = sessionID.UUID
 		tokens = append(tokens, token)
 	}
 
@@ -49,7 +49,7 @@ func NewService(repo *Repository, cfg config.PushConfig) *Service {
 	}
 }
 
-func (s *Service) RegisterDeviceToken(ctx context.Context, userID uuid.UUID, req *RegisterTokenRequest) error {
+func (s *Service) RegisterDeviceToken(ctx context.Context, userID, sessionID uuid.UUID, req *RegisterTokenRequest) error {
 	token := &DeviceToken{
 		ID:         uuid.New(),
 		UserID:     userID,
@@ -61,6 +61,7 @@ func (s *Service) RegisterDeviceToken(ctx context.Context, userID uuid.UUID, req
 		IsActive:   true,
 		LastUsedAt: time.Now(),
 		CreatedAt:  time.Now(),
+		SessionID:  sessionID,
 	}
 
 	return s.repo.RegisterDeviceToken(ctx, token)
@@ -230,6 +231,103 @@ func (s *Service) sendVoIPPushNotification(ctx context.Context, token *DeviceTok
 	return nil
 }
 
+// HasActiveTokens сообщает, можно ли разбудить хотя бы одно устройство пользователя push уведомлением
+func (s *Service) HasActiveTokens(ctx context.Context, userID uuid.UUID) (bool, error) {
+	tokens, err := s.repo.GetActiveTokensForUser(ctx, userID)
+	return len(tokens) > 0, err
+}
+
+// SendCallCancellation сообщает устройствам пользователя, что звонок больше не звонит
+// (ответили или отклонили на другом устройстве, истек таймаут, звонящий положил трубку).
+// Токены сессии exceptSessionID — устройства, которое ответило или отклонило звонок, — пропускаются.
+func (s *Service) SendCallCancellation(ctx context.Context, userID, exceptSessionID uuid.UUID, callID, reason string) error {
+	tokens, err := s.repo.GetActiveTokensForUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var lastError error
+	for _, token := range tokens {
+		if exceptSessionID != uuid.Nil && token.SessionID == exceptSessionID {
+			continue
+		}
+
+		var err error
+
+		switch token.PushType {
+		case "fcm":
+			if s.firebaseV1 == nil {
+				continue
+			}
+			err = s.firebaseV1.SendCallCancellation(ctx, token.Token, callID, reason)
+		case "apns":
+			// Фоновый push без alert: приложение просыпается и убирает экран входящего звонка
+			err = s.sendAPNsRequest(ctx, token, &CallCancelPushMessage{
+				APS:    map[string]interface{}{"content-available": 1},
+				Type:   "call_cancelled",
+				CallID: callID,
+				Reason: reason,
+			}, s.config.APNsAuthToken, s.config.APNsBundleID, "background", "5")
+		case "voip":
+			err = s.sendAPNsRequest(ctx, token, &CallCancelPushMessage{
+				Type:   "call_cancelled",
+				CallID: callID,
+				Reason: reason,
+			}, s.config.APNsVoIPAuthToken, s.config.APNsVoIPBundleID, "voip", "10")
+		default:
+			continue
+		}
+
+		if err != nil {
+			log.Printf("ERROR: Failed to send call cancellation: %v, tokenID: %s, pushType: %s",
+				err, token.ID, token.PushType)
+			lastError = err
+
+			if s.isInvalidTokenError(err) {
+				s.repo.DeactivateToken(ctx, token.UserID, token.Token)
+			}
+		}
+	}
+
+	return lastError
+}
+
+func (s *Service) sendAPNsRequest(ctx context.Context, token *DeviceToken, payload interface{}, authToken, topic, pushType, priority string) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal APNs message: %w", err)
+	}
+
+	endpoint := "https://api.push.apple.com/3/device/" + token.Token
+	if s.config.APNsSandbox {
+		endpoint = "https://api.sandbox.push.apple.com/3/device/" + token.Token
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create APNs request: %w", err)
+	}
+
+	req.Header.Set("authorization", "bearer "+authToken)
+	req.Header.Set("apns-topic", topic)
+	req.Header.Set("apns-push-type", pushType)
+	req.Header.Set("apns-priority", priority)
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send APNs request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("APNs request failed: status=%d, body=%s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
 func (s *Service) isInvalidTokenError(err error) bool {
 	errorStr := err.Error()
 
@@ -0,0 +1,68 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"q7o/config"
+)
+
+// Sender отправляет SMS. Реальные провайдеры подключаются реализацией этого интерфейса.
+type Sender interface {
+	Send(ctx context.Context, to, message string) error
+}
+
+// NewSender выбирает реализацию по SMS_PROVIDER
+func NewSender(cfg config.SMSConfig) (Sender, error) {
+	switch cfg.Provider {
+	case "", "log":
+		return &LogSender{}, nil
+	case "file":
+		return NewFileSender(cfg.FilePath)
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", cfg.Provider)
+	}
+}
+
+// LogSender пишет сообщения в лог сервера (для разработки)
+type LogSender struct{}
+
+func (s *LogSender) Send(ctx context.Context, to, message string) error {
+	log.Printf("📱 SMS to %s: %s", to, message)
+	return nil
+}
+
+// FileSender дописывает сообщения в файл — удобно для локальной разработки и e2e проверок
+type FileSender struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSender(path string) (*FileSender, error) {
+	if path == "" {
+		return nil, fmt.Errorf("SMS_FILE_PATH is required for the file provider")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return &FileSender{path: path}, nil
+}
+
+func (s *FileSender) Send(ctx context.Context, to, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), to, message)
+	return err
+}
@@ -34,7 +34,7 @@ func (h *Handler) GetMe(c *fiber.Ctx) error {
 		return response.BadRequest(c, "Invalid user ID")
 	}
 
-	user, err := h.service.GetUserByID(c.Context(), uid)
+	user, err := h.service.GetMe(c.Context(), uid)
 	if err != nil {
 		return response.InternalError(c, err)
 	}
@@ -168,9 +168,6 @@ func (h *Handler) SearchUsers(c *fiber.Ctx) error {
 				userWithContact["created_at"] = users[i].CreatedAt
 				userWithContact["is_contact"] = isContact
 				userWithContact["can_call"] = isContact
-
-				// Заменяем в массиве
-				users[i] = users[i] // Это временно, нужно будет обновить тип возврата
 			}
 		}
 	}
@@ -224,6 +221,37 @@ func (h *Handler) DeleteAvatar(c *fiber.Ctx) error {
 	})
 }
 
+// DeleteAccount планирует удаление аккаунта; требует текущий пароль
+func (h *Handler) DeleteAccount(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return response.BadRequest(c, "Invalid user ID")
+	}
+
+	var req DeleteAccountDTO
+	if err := c.BodyParser(&req); err != nil {
+		return response.BadRequest(c, "Invalid request body")
+	}
+
+	if err := h.validate.Struct(&req); err != nil {
+		return response.ValidationError(c, err)
+	}
+
+	deleteAt, err := h.service.DeleteAccount(c.Context(), uid, &req)
+	if err != nil {
+		if err.Error() == "password is incorrect" {
+			return response.Unauthorized(c, err.Error())
+		}
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, fiber.Map{
+		"message":               "Account scheduled for deletion. Log in before the deletion date to cancel it",
+		"deletion_scheduled_at": deleteAt,
+	})
+}
+
 func (h *Handler) ChangePassword(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(string)
 	uid, err := uuid.Parse(userID)
@@ -240,7 +268,9 @@ func (h *Handler) ChangePassword(c *fiber.Ctx) error {
 		return response.ValidationError(c, err)
 	}
 
-	if err := h.service.ChangePassword(c.Context(), uid, &req); err != nil {
+	sessionID, _ := uuid.Parse(c.Locals("sessionID").(string))
+
+	if err := h.service.ChangePassword(c.Context(), uid, sessionID, &req); err != nil {
 		if err.Error() == "current password is incorrect" {
 			return response.BadRequest(c, err.Error())
 		}
@@ -21,13 +21,34 @@ type User struct {
 	CreatedAt                time.Time  `json:"created_at"`
 	UpdatedAt                time.Time  `json:"updated_at"`
 	// Extended profile fields
-	Phone       *string    `json:"phone"`
-	Bio         *string    `json:"bio"`
-	DateOfBirth *time.Time `json:"date_of_birth"`
-	Location    *string    `json:"location"`
-	Timezone    *string    `json:"timezone"`
+	Phone         *string    `json:"phone"`
+	PhoneVerified bool       `json:"phone_verified"`
+	Bio           *string    `json:"bio"`
+	DateOfBirth   *time.Time `json:"date_of_birth"`
+	Location      *string    `json:"location"`
+	Timezone      *string    `json:"timezone"`
+	// Access control
+	Role string `json:"role"`
+	// Account deletion
+	AccountState        string     `json:"-"`
+	DeletionScheduledAt *time.Time `json:"-"`
+	SuspendedAt         *time.Time `json:"-"`
+	SuspensionReason    *string    `json:"-"`
 }
 
+// Роли пользователей; права каждой роли описаны в auth.rolePermissions
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	AccountStateActive          = "active"
+	AccountStatePendingDeletion = "pending_deletion"
+	AccountStateSuspended       = "suspended"
+)
+
 type CreateUserDTO struct {
 	FirstName string `json:"first_name" validate:"required,min=2,max=100"`
 	LastName  string `json:"last_name" validate:"required,min=2,max=100"`
@@ -61,11 +82,13 @@ type UserResponse struct {
 	LastSeen  time.Time `json:"last_seen"`
 	CreatedAt time.Time `json:"created_at"`
 	// Extended profile fields
-	Phone       *string    `json:"phone"`
-	Bio         *string    `json:"bio"`
-	DateOfBirth *time.Time `json:"date_of_birth"`
-	Location    *string    `json:"location"`
-	Timezone    *string    `json:"timezone"`
+	Phone         *string    `json:"phone"`
+	PhoneVerified bool       `json:"phone_verified"`
+	Bio           *string    `json:"bio"`
+	DateOfBirth   *time.Time `json:"date_of_birth"`
+	Location      *string    `json:"location"`
+	Timezone      *string    `json:"timezone"`
+	Role          string     `json:"role,omitempty"`
 }
 
 type CheckUsernameResponse struct {
@@ -74,6 +97,20 @@ type CheckUsernameResponse struct {
 	Suggestions []string `json:"suggestions,omitempty"`
 }
 
+// UserFilter — фильтры поиска пользователей в админке
+type UserFilter struct {
+	Query         string `query:"q"`
+	Role          string `query:"role" validate:"omitempty,oneof=user moderator admin"`
+	AccountState  string `query:"state" validate:"omitempty,oneof=active pending_deletion suspended"`
+	EmailVerified *bool  `query:"email_verified"`
+	Limit         int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Offset        int    `query:"offset" validate:"omitempty,min=0"`
+}
+
+type DeleteAccountDTO struct {
+	Password string `json:"password" validate:"required"`
+}
+
 type ChangePasswordDTO struct {
 	CurrentPassword string `json:"current_password" validate:"required"`
 	NewPassword     string `json:"new_password" validate:"required,min=6"`
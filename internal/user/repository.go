@@ -3,6 +3,9 @@ package user
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -47,9 +50,10 @@ func (r *Repository) Create(ctx context.Context, user *User) error {
 func (r *Repository) FindByID(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
         SELECT id, username, first_name, last_name, email, password_hash, 
-               email_verified, email_verification_code, email_verification_expires,
+               email_verified, COALESCE(email_verification_code, ''), email_verification_expires,
                avatar_url, status, last_seen, created_at, updated_at,
-               phone, bio, date_of_birth, location, timezone
+               phone, phone_verified, bio, date_of_birth, location, timezone,
+               account_state, deletion_scheduled_at, role, suspended_at, suspension_reason
         FROM users WHERE id = $1
     `
 
@@ -60,7 +64,9 @@ func (r *Repository) FindByID(ctx context.Context, id uuid.UUID) (*User, error)
 		&user.EmailVerified, &user.EmailVerificationCode,
 		&user.EmailVerificationExpires, &user.AvatarURL,
 		&user.Status, &user.LastSeen, &user.CreatedAt, &user.UpdatedAt,
-		&user.Phone, &user.Bio, &user.DateOfBirth, &user.Location, &user.Timezone,
+		&user.Phone, &user.PhoneVerified, &user.Bio, &user.DateOfBirth, &user.Location, &user.Timezone,
+		&user.AccountState, &user.DeletionScheduledAt, &user.Role,
+		&user.SuspendedAt, &user.SuspensionReason,
 	)
 
 	if err == sql.ErrNoRows {
@@ -73,10 +79,11 @@ func (r *Repository) FindByID(ctx context.Context, id uuid.UUID) (*User, error)
 func (r *Repository) FindByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
         SELECT id, username, first_name, last_name, email, password_hash, 
-               email_verified, email_verification_code, email_verification_expires,
+               email_verified, COALESCE(email_verification_code, ''), email_verification_expires,
                avatar_url, status, last_seen, created_at, updated_at,
-               phone, bio, date_of_birth, location, timezone
-        FROM users WHERE email = $1
+               phone, phone_verified, bio, date_of_birth, location, timezone,
+               account_state, deletion_scheduled_at, role, suspended_at, suspension_reason
+        FROM users WHERE LOWER(email) = LOWER($1)
     `
 
 	user := &User{}
@@ -86,7 +93,9 @@ func (r *Repository) FindByEmail(ctx context.Context, email string) (*User, erro
 		&user.EmailVerified, &user.EmailVerificationCode,
 		&user.EmailVerificationExpires, &user.AvatarURL,
 		&user.Status, &user.LastSeen, &user.CreatedAt, &user.UpdatedAt,
-		&user.Phone, &user.Bio, &user.DateOfBirth, &user.Location, &user.Timezone,
+		&user.Phone, &user.PhoneVerified, &user.Bio, &user.DateOfBirth, &user.Location, &user.Timezone,
+		&user.AccountState, &user.DeletionScheduledAt, &user.Role,
+		&user.SuspendedAt, &user.SuspensionReason,
 	)
 
 	if err == sql.ErrNoRows {
@@ -116,7 +125,7 @@ func (r *Repository) FindByUsername(ctx context.Context, username string) (*User
 }
 
 func (r *Repository) EmailExists(ctx context.Context, email string) (bool, error) {
-	query := `SELECT COUNT(*) FROM users WHERE email = $1`
+	query := `SELECT COUNT(*) FROM users WHERE LOWER(email) = LOWER($1)`
 	var count int
 	err := r.db.QueryRowContext(ctx, query, email).Scan(&count)
 	return count > 0, err
@@ -164,6 +173,7 @@ func (r *Repository) Update(ctx context.Context, id uuid.UUID, updates *UpdateUs
             avatar_url = COALESCE($5, avatar_url),
             status = COALESCE($6, status),
             phone = COALESCE($7, phone),
+            phone_verified = CASE WHEN $7::varchar IS NULL OR $7 = phone THEN phone_verified ELSE FALSE END,
             bio = COALESCE($8, bio),
             date_of_birth = COALESCE($9, date_of_birth),
             location = COALESCE($10, location),
@@ -268,8 +278,274 @@ func (r *Repository) PhoneExists(ctx context.Context, phone string) (bool, error
 	return count > 0, err
 }
 
+// FindByVerifiedPhone ищет пользователя по подтвержденному номеру телефона
+func (r *Repository) FindByVerifiedPhone(ctx context.Context, phone string) (*User, error) {
+	var id uuid.UUID
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id FROM users WHERE phone = $1 AND phone_verified = true`, phone,
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return r.FindByID(ctx, id)
+}
+
+// MarkPhoneVerified подтверждает номер, только если он не изменился с момента отправки кода
+func (r *Repository) MarkPhoneVerified(ctx context.Context, id uuid.UUID, phone string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE users SET phone_verified = true, updated_at = NOW() WHERE id = $1 AND phone = $2`, id, phone,
+	)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// ChangeEmail заменяет email, только если он не изменился с момента запроса.
+// Новый адрес подтвержден кодом, поэтому email_verified выставляется сразу.
+func (r *Repository) ChangeEmail(ctx context.Context, id uuid.UUID, oldEmail, newEmail string) (bool, error) {
+	query := `
+        UPDATE users
+        SET email = $3,
+            email_verified = true,
+            email_verification_code = NULL,
+            email_verification_expires = NULL,
+            updated_at = NOW()
+        WHERE id = $1 AND email = $2
+    `
+	result, err := r.db.ExecContext(ctx, query, id, oldEmail, newEmail)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" { // unique_violation
+			return false, errors.New("email already exists")
+		}
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
 func (r *Repository) UpdatePassword(ctx context.Context, id uuid.UUID, newPasswordHash string) error {
 	query := `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, id, newPasswordHash)
 	return err
 }
+
+// ScheduleDeletion переводит аккаунт в состояние pending_deletion
+func (r *Repository) ScheduleDeletion(ctx context.Context, id uuid.UUID, at time.Time) error {
+	query := `
+        UPDATE users
+        SET account_state = 'pending_deletion', deletion_scheduled_at = $2, status = 'offline', updated_at = NOW()
+        WHERE id = $1
+    `
+	_, err := r.db.ExecContext(ctx, query, id, at)
+	return err
+}
+
+// CancelDeletion возвращает аккаунт в активное состояние; false, если удаление не было запланировано
+func (r *Repository) CancelDeletion(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+        UPDATE users
+        SET account_state = 'active', deletion_scheduled_at = NULL, updated_at = NOW()
+        WHERE id = $1 AND account_state = 'pending_deletion'
+    `
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// FindDueDeletions возвращает аккаунты, срок отмены удаления которых истек
+func (r *Repository) FindDueDeletions(ctx context.Context, limit int) ([]*User, error) {
+	query := `
+        SELECT id, email, avatar_url
+        FROM users
+        WHERE account_state = 'pending_deletion' AND deletion_scheduled_at <= NOW()
+        ORDER BY deletion_scheduled_at
+        LIMIT $1
+    `
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user := &User{}
+		if err := rows.Scan(&user.ID, &user.Email, &user.AvatarURL); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// Suspend блокирует аккаунт; запланированное удаление сохраняется и возобновляется после Unsuspend
+func (r *Repository) Suspend(ctx context.Context, id uuid.UUID, reason string) (bool, error) {
+	query := `
+        UPDATE users
+        SET account_state = 'suspended', suspended_at = NOW(), suspension_reason = NULLIF($2, ''),
+            status = 'offline', updated_at = NOW()
+        WHERE id = $1 AND account_state <> 'suspended'
+    `
+	result, err := r.db.ExecContext(ctx, query, id, reason)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Unsuspend снимает блокировку; false, если аккаунт не был заблокирован
+func (r *Repository) Unsuspend(ctx context.Context, id uuid.UUID) (bool, error) {
+	query := `
+        UPDATE users
+        SET account_state = CASE WHEN deletion_scheduled_at IS NULL THEN 'active' ELSE 'pending_deletion' END,
+            suspended_at = NULL, suspension_reason = NULL, updated_at = NOW()
+        WHERE id = $1 AND account_state = 'suspended'
+    `
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// FindSuspendedIDs возвращает ID всех заблокированных аккаунтов
+func (r *Repository) FindSuspendedIDs(ctx context.Context) ([]uuid.UUID, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM users WHERE account_state = 'suspended'`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (r *Repository) UpdateRole(ctx context.Context, id uuid.UUID, role string) error {
+	query := `UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id, role)
+	return err
+}
+
+// AdminSearch ищет пользователей по фильтрам и возвращает общее число найденных
+func (r *Repository) AdminSearch(ctx context.Context, filter *UserFilter) ([]*User, int, error) {
+	var conditions []string
+	var args []interface{}
+	addArg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if filter.Query != "" {
+		p := addArg("%" + filter.Query + "%")
+		conditions = append(conditions, fmt.Sprintf(
+			"(username ILIKE %[1]s OR email ILIKE %[1]s OR phone ILIKE %[1]s OR CONCAT(first_name, ' ', last_name) ILIKE %[1]s)", p,
+		))
+	}
+	if filter.Role != "" {
+		conditions = append(conditions, "role = "+addArg(filter.Role))
+	}
+	if filter.AccountState != "" {
+		conditions = append(conditions, "account_state = "+addArg(filter.AccountState))
+	}
+	if filter.EmailVerified != nil {
+		conditions = append(conditions, "email_verified = "+addArg(*filter.EmailVerified))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+        SELECT id, username, first_name, last_name, email, email_verified,
+               avatar_url, status, last_seen, created_at, updated_at,
+               phone, phone_verified, role, account_state, deletion_scheduled_at,
+               suspended_at, suspension_reason
+        FROM users ` + where + `
+        ORDER BY created_at DESC
+        LIMIT ` + addArg(filter.Limit) + ` OFFSET ` + addArg(filter.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user := &User{}
+		err := rows.Scan(
+			&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Email, &user.EmailVerified,
+			&user.AvatarURL, &user.Status, &user.LastSeen, &user.CreatedAt, &user.UpdatedAt,
+			&user.Phone, &user.PhoneVerified, &user.Role, &user.AccountState, &user.DeletionScheduledAt,
+			&user.SuspendedAt, &user.SuspensionReason,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// PurgeUser окончательно удаляет пользователя. История звонков и встреч остается у второй стороны:
+// ссылки на пользователя обнуляются (ON DELETE SET NULL), имя заменяется на "Deleted user".
+// Удаление выполняется, только если аккаунт все еще ожидает удаления (вход мог его отменить).
+func (r *Repository) PurgeUser(ctx context.Context, id uuid.UUID) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var pending bool
+	err = tx.QueryRowContext(ctx, `
+        SELECT account_state = 'pending_deletion' AND deletion_scheduled_at <= NOW()
+        FROM users WHERE id = $1 FOR UPDATE
+    `, id).Scan(&pending)
+	if err != nil || !pending {
+		return false, err
+	}
+
+	statements := []string{
+		`UPDATE calls SET caller_name = 'Deleted user' WHERE caller_id = $1`,
+		`UPDATE calls SET callee_name = 'Deleted user' WHERE callee_id = $1`,
+		`UPDATE call_participants SET display_name = 'Deleted user' WHERE user_id = $1`,
+		`UPDATE meeting_participants SET guest_name = 'Deleted user', is_active = false WHERE user_id = $1`,
+		`UPDATE meetings SET is_active = false, ended_at = COALESCE(ended_at, NOW()) WHERE host_id = $1`,
+		`DELETE FROM device_tokens WHERE user_id = $1`,
+		`DELETE FROM user_settings WHERE user_id = $1`,
+		`DELETE FROM sessions WHERE user_id = $1`,
+		`DELETE FROM users WHERE id = $1`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement, id); err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
@@ -3,51 +3,105 @@ package user
 import (
 	"context"
 	"errors"
+	"log"
 	"mime/multipart"
 	"regexp"
+	"time"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"q7o/config"
+	"q7o/internal/audit"
 	"q7o/internal/email"
 	"q7o/internal/upload"
 )
 
+// SessionRevoker завершает сессии и отзывает API ключи пользователя (реализуется auth.Service,
+// передается через setter, чтобы избежать циклической зависимости)
+type SessionRevoker interface {
+	RevokeOtherSessions(ctx context.Context, userID, currentSessionID uuid.UUID) (int, error)
+	RevokeAllSessions(ctx context.Context, userID uuid.UUID) error
+	RevokeAPIKeys(ctx context.Context, userID uuid.UUID) error
+}
+
+// PhoneVerifier отправляет SMS с кодом подтверждения номера (реализуется auth.Service)
+type PhoneVerifier interface {
+	SendPhoneVerification(ctx context.Context, userID uuid.UUID) error
+}
+
 type Service struct {
-	repo          *Repository
-	emailService  *email.Service
-	uploadService *upload.Service
+	repo            *Repository
+	emailService    *email.Service
+	uploadService   *upload.Service
+	sessionRevoker  SessionRevoker
+	phoneVerifier   PhoneVerifier
+	auditLog        *audit.Service
+	accountDeletion config.AccountDeletionConfig
 }
 
-func NewService(repo *Repository, emailService *email.Service, uploadService *upload.Service) *Service {
+func NewService(repo *Repository, emailService *email.Service, uploadService *upload.Service, accountDeletion config.AccountDeletionConfig) *Service {
 	return &Service{
-		repo:          repo,
-		emailService:  emailService,
-		uploadService: uploadService,
+		repo:            repo,
+		emailService:    emailService,
+		uploadService:   uploadService,
+		accountDeletion: accountDeletion,
 	}
 }
 
+// SetSessionRevoker устанавливает auth service после инициализации
+func (s *Service) SetSessionRevoker(sr SessionRevoker) {
+	s.sessionRevoker = sr
+}
+
+// SetPhoneVerifier устанавливает auth service после инициализации
+func (s *Service) SetPhoneVerifier(pv PhoneVerifier) {
+	s.phoneVerifier = pv
+}
+
+// SetAuditLog включает запись изменений профиля в журнал безопасности
+func (s *Service) SetAuditLog(auditLog *audit.Service) {
+	s.auditLog = auditLog
+}
+
 func (s *Service) GetUserByID(ctx context.Context, id uuid.UUID) (*UserResponse, error) {
 	user, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
+	return profileResponse(user), nil
+}
+
+// GetMe — профиль текущего пользователя; в отличие от GetUserByID включает роль
+func (s *Service) GetMe(ctx context.Context, id uuid.UUID) (*UserResponse, error) {
+	user, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := profileResponse(user)
+	resp.Role = user.Role
+	return resp, nil
+}
+
+func profileResponse(user *User) *UserResponse {
 	return &UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		Email:       user.Email,
-		AvatarURL:   user.AvatarURL,
-		Status:      user.Status,
-		LastSeen:    user.LastSeen,
-		CreatedAt:   user.CreatedAt,
-		Phone:       user.Phone,
-		Bio:         user.Bio,
-		DateOfBirth: user.DateOfBirth,
-		Location:    user.Location,
-		Timezone:    user.Timezone,
-	}, nil
+		ID:            user.ID,
+		Username:      user.Username,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		AvatarURL:     user.AvatarURL,
+		Status:        user.Status,
+		LastSeen:      user.LastSeen,
+		CreatedAt:     user.CreatedAt,
+		Phone:         user.Phone,
+		PhoneVerified: user.PhoneVerified,
+		Bio:           user.Bio,
+		DateOfBirth:   user.DateOfBirth,
+		Location:      user.Location,
+		Timezone:      user.Timezone,
+	}
 }
 
 func (s *Service) GetUserByUsername(ctx context.Context, username string) (*UserResponse, error) {
@@ -76,24 +130,32 @@ func (s *Service) GetUserByUsername(ctx context.Context, username string) (*User
 
 func (s *Service) UpdateProfile(ctx context.Context, userID uuid.UUID, updates *UpdateUserDTO) (*UserResponse, error) {
 	// Check if new username is taken
+	var oldUsername string
 	if updates.Username != nil {
-		exists, _ := s.repo.UsernameExists(ctx, *updates.Username)
-		if exists {
-			user, _ := s.repo.FindByID(ctx, userID)
-			if user.Username != *updates.Username {
+		user, err := s.repo.FindByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		oldUsername = user.Username
+
+		if user.Username != *updates.Username {
+			if exists, _ := s.repo.UsernameExists(ctx, *updates.Username); exists {
 				return nil, errors.New("username already taken")
 			}
 		}
 	}
 
 	// Check if new phone number is taken
+	phoneChanged := false
 	if updates.Phone != nil && *updates.Phone != "" {
-		exists, _ := s.repo.PhoneExists(ctx, *updates.Phone)
-		if exists {
-			user, _ := s.repo.FindByID(ctx, userID)
-			if user.Phone == nil || *user.Phone != *updates.Phone {
-				return nil, errors.New("phone number already taken")
-			}
+		user, err := s.repo.FindByID(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		phoneChanged = user.Phone == nil || *user.Phone != *updates.Phone
+
+		if exists, _ := s.repo.PhoneExists(ctx, *updates.Phone); exists && phoneChanged {
+			return nil, errors.New("phone number already taken")
 		}
 	}
 
@@ -101,7 +163,45 @@ func (s *Service) UpdateProfile(ctx context.Context, userID uuid.UUID, updates *
 		return nil, err
 	}
 
-	return s.GetUserByID(ctx, userID)
+	s.auditLog.Record(ctx, userID, audit.EventProfileUpdate, map[string]interface{}{
+		"fields": updatedFields(updates),
+	})
+	if updates.Username != nil && *updates.Username != oldUsername {
+		s.auditLog.Record(ctx, userID, audit.EventUsernameChange, map[string]interface{}{
+			"old_username": oldUsername,
+			"new_username": *updates.Username,
+		})
+	}
+
+	// Новый номер нужно подтвердить кодом из SMS
+	if phoneChanged && s.phoneVerifier != nil {
+		if err := s.phoneVerifier.SendPhoneVerification(ctx, userID); err != nil {
+			log.Printf("Failed to send phone verification for user %s: %v", userID, err)
+		}
+	}
+
+	return s.GetMe(ctx, userID)
+}
+
+// updatedFields — имена полей профиля, переданных в запросе на изменение (для журнала)
+func updatedFields(updates *UpdateUserDTO) []string {
+	fields := []string{}
+	add := func(name string, set bool) {
+		if set {
+			fields = append(fields, name)
+		}
+	}
+	add("username", updates.Username != nil)
+	add("first_name", updates.FirstName != nil)
+	add("last_name", updates.LastName != nil)
+	add("avatar_url", updates.AvatarURL != nil)
+	add("status", updates.Status != nil)
+	add("phone", updates.Phone != nil)
+	add("bio", updates.Bio != nil)
+	add("date_of_birth", updates.DateOfBirth != nil)
+	add("location", updates.Location != nil)
+	add("timezone", updates.Timezone != nil)
+	return fields
 }
 
 func (s *Service) UpdateStatus(ctx context.Context, userID uuid.UUID, status string) error {
@@ -146,7 +246,7 @@ func (s *Service) UpdateAvatarURL(ctx context.Context, userID uuid.UUID, avatarU
 		return nil, err
 	}
 
-	return s.GetUserByID(ctx, userID)
+	return s.GetMe(ctx, userID)
 }
 
 func (s *Service) UploadAvatar(ctx context.Context, userID uuid.UUID, file *multipart.FileHeader) (*UserResponse, error) {
@@ -176,7 +276,9 @@ func (s *Service) UploadAvatar(ctx context.Context, userID uuid.UUID, file *mult
 		return nil, err
 	}
 
-	return s.GetUserByID(ctx, userID)
+	s.auditLog.Record(ctx, userID, audit.EventAvatarChange, map[string]interface{}{"action": "upload"})
+
+	return s.GetMe(ctx, userID)
 }
 
 func (s *Service) DeleteAvatar(ctx context.Context, userID uuid.UUID) (*UserResponse, error) {
@@ -198,10 +300,13 @@ func (s *Service) DeleteAvatar(ctx context.Context, userID uuid.UUID) (*UserResp
 		return nil, err
 	}
 
-	return s.GetUserByID(ctx, userID)
+	s.auditLog.Record(ctx, userID, audit.EventAvatarChange, map[string]interface{}{"action": "delete"})
+
+	return s.GetMe(ctx, userID)
 }
 
-func (s *Service) ChangePassword(ctx context.Context, userID uuid.UUID, dto *ChangePasswordDTO) error {
+// ChangePassword меняет пароль и завершает все сессии, кроме текущей
+func (s *Service) ChangePassword(ctx context.Context, userID, currentSessionID uuid.UUID, dto *ChangePasswordDTO) error {
 	// Get current user
 	user, err := s.repo.FindByID(ctx, userID)
 	if err != nil {
@@ -220,7 +325,101 @@ func (s *Service) ChangePassword(ctx context.Context, userID uuid.UUID, dto *Cha
 	}
 
 	// Update password in database
-	return s.repo.UpdatePassword(ctx, userID, string(newPasswordHash))
+	if err := s.repo.UpdatePassword(ctx, userID, string(newPasswordHash)); err != nil {
+		return err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.EventPasswordChange, nil)
+
+	if s.sessionRevoker == nil {
+		return nil
+	}
+
+	// Токен без sid не позволяет определить текущую сессию — завершаем все
+	if currentSessionID == uuid.Nil {
+		return s.sessionRevoker.RevokeAllSessions(ctx, userID)
+	}
+
+	if _, err := s.sessionRevoker.RevokeOtherSessions(ctx, userID, currentSessionID); err != nil {
+		return err
+	}
+	return s.sessionRevoker.RevokeAPIKeys(ctx, userID)
+}
+
+// DeleteAccount планирует удаление аккаунта после подтверждения паролем.
+// Все сессии завершаются; вход в течение льготного периода отменяет удаление.
+func (s *Service) DeleteAccount(ctx context.Context, userID uuid.UUID, dto *DeleteAccountDTO) (time.Time, error) {
+	user, err := s.repo.FindByID(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(dto.Password)); err != nil {
+		return time.Time{}, errors.New("password is incorrect")
+	}
+
+	deleteAt := time.Now().Add(time.Duration(s.accountDeletion.GraceDays) * 24 * time.Hour)
+	if err := s.repo.ScheduleDeletion(ctx, userID, deleteAt); err != nil {
+		return time.Time{}, err
+	}
+
+	if s.sessionRevoker != nil {
+		if err := s.sessionRevoker.RevokeAllSessions(ctx, userID); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	fullName := user.FirstName + " " + user.LastName
+	go s.emailService.SendAccountDeletionScheduledEmail(user.Email, fullName, deleteAt)
+
+	return deleteAt, nil
+}
+
+// RunDeletionPurge периодически удаляет аккаунты, у которых истек льготный период
+func (s *Service) RunDeletionPurge(ctx context.Context) {
+	interval := time.Duration(s.accountDeletion.PurgeIntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeDueAccounts(ctx)
+		}
+	}
+}
+
+func (s *Service) purgeDueAccounts(ctx context.Context) {
+	users, err := s.repo.FindDueDeletions(ctx, 100)
+	if err != nil {
+		log.Printf("Failed to load accounts pending deletion: %v", err)
+		return
+	}
+
+	for _, user := range users {
+		purged, err := s.repo.PurgeUser(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to purge account %s: %v", user.ID, err)
+			continue
+		}
+		if !purged {
+			continue
+		}
+
+		if user.AvatarURL != nil && *user.AvatarURL != "" {
+			if err := s.uploadService.DeleteAvatar(*user.AvatarURL); err != nil {
+				log.Printf("Failed to delete avatar of purged account %s: %v", user.ID, err)
+			}
+		}
+
+		log.Printf("Account %s deleted after grace period", user.ID)
+	}
 }
 
 func (s *Service) ValidatePhoneNumber(phone string) error {
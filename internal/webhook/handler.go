@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/livekit/protocol/auth"
+	lkwebhook "github.com/livekit/protocol/webhook"
+	"q7o/config"
+	"q7o/internal/common/response"
+)
+
+type Handler struct {
+	service *Service
+	keys    auth.KeyProvider
+}
+
+func NewHandler(service *Service, cfg config.LiveKitConfig) *Handler {
+	return &Handler{
+		service: service,
+		keys:    auth.NewSimpleKeyProvider(cfg.APIKey, cfg.APISecret),
+	}
+}
+
+// LiveKit принимает вебхук LiveKit. Подпись — JWT в заголовке Authorization,
+// подписанный API ключом LiveKit и содержащий SHA-256 тела запроса.
+// POST /webhooks/livekit
+func (h *Handler) LiveKit(c *fiber.Ctx) error {
+	req, err := http.NewRequest(http.MethodPost, c.OriginalURL(), bytes.NewReader(c.Body()))
+	if err != nil {
+		return response.BadRequest(c, "Invalid request")
+	}
+	req.Header.Set("Authorization", c.Get(fiber.HeaderAuthorization))
+
+	event, err := lkwebhook.ReceiveWebhookEvent(req, h.keys)
+	if err != nil {
+		return response.Unauthorized(c, "Invalid webhook signature")
+	}
+
+	if err := h.service.HandleLiveKitEvent(c.Context(), event); err != nil {
+		log.Printf("Failed to handle LiveKit webhook %s for room %s: %v", event.GetEvent(), event.GetRoom().GetName(), err)
+		return response.InternalError(c, err)
+	}
+
+	return response.Success(c, nil)
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/livekit/protocol/livekit"
+	lkwebhook "github.com/livekit/protocol/webhook"
+	"q7o/internal/call"
+	"q7o/internal/meeting"
+)
+
+// Префикс комнат встреч (см. meeting.Service.CreateMeeting); остальные комнаты — звонки
+const meetingRoomPrefix = "meeting_"
+
+// Service переносит события LiveKit на звонки и встречи, чтобы состояние в БД
+// совпадало с тем, кто на самом деле находится в комнате
+type Service struct {
+	callService *call.Service
+	meetingRepo *meeting.Repository
+}
+
+func NewService(callService *call.Service, meetingRepo *meeting.Repository) *Service {
+	return &Service{
+		callService: callService,
+		meetingRepo: meetingRepo,
+	}
+}
+
+func (s *Service) HandleLiveKitEvent(ctx context.Context, event *livekit.WebhookEvent) error {
+	roomName := event.GetRoom().GetName()
+	if roomName == "" {
+		return nil
+	}
+
+	participant := event.GetParticipant()
+	// Участник переподключился с тем же identity — старое соединение закрыто, но он в комнате
+	if participant.GetDisconnectReason() == livekit.DisconnectReason_DUPLICATE_IDENTITY {
+		return nil
+	}
+
+	if strings.HasPrefix(roomName, meetingRoomPrefix) {
+		return s.handleMeetingEvent(ctx, event, roomName)
+	}
+	return s.handleCallEvent(ctx, event, roomName)
+}
+
+func (s *Service) handleCallEvent(ctx context.Context, event *livekit.WebhookEvent, roomName string) error {
+	switch event.GetEvent() {
+	case lkwebhook.EventParticipantLeft:
+		userID, ok := identityUserID(event.GetParticipant())
+		if !ok {
+			return nil
+		}
+		return s.callService.LeaveRoom(ctx, roomName, userID)
+	case lkwebhook.EventRoomFinished:
+		return s.callService.FinishRoom(ctx, roomName)
+	}
+	return nil
+}
+
+func (s *Service) handleMeetingEvent(ctx context.Context, event *livekit.WebhookEvent, roomName string) error {
+	m, err := s.meetingRepo.FindByRoomName(ctx, roomName)
+	if err != nil || m == nil {
+		return err
+	}
+
+	if event.GetEvent() == lkwebhook.EventRoomFinished {
+		if !m.IsActive {
+			return nil
+		}
+		return s.meetingRepo.EndMeeting(ctx, m.ID)
+	}
+
+	// Гости подключаются с identity guest_<...> и не привязаны к пользователю — их пропускаем
+	userID, ok := identityUserID(event.GetParticipant())
+	if !ok {
+		return nil
+	}
+
+	switch event.GetEvent() {
+	case lkwebhook.EventParticipantJoined:
+		if !m.IsActive {
+			return nil
+		}
+		return s.meetingRepo.RestoreParticipant(ctx, m.ID, userID, time.Unix(event.GetCreatedAt(), 0))
+	case lkwebhook.EventParticipantLeft:
+		return s.meetingRepo.RemoveParticipant(ctx, m.ID, userID, time.Unix(event.GetCreatedAt(), 0))
+	case lkwebhook.EventTrackPublished, lkwebhook.EventTrackUnpublished:
+		track := event.GetTrack()
+		enabled := event.GetEvent() == lkwebhook.EventTrackPublished && !track.GetMuted()
+		req := &meeting.UpdateParticipantRequest{}
+		switch track.GetSource() {
+		case livekit.TrackSource_MICROPHONE:
+			req.AudioEnabled = &enabled
+		case livekit.TrackSource_CAMERA:
+			req.VideoEnabled = &enabled
+		case livekit.TrackSource_SCREEN_SHARE:
+			req.ScreenSharing = &enabled
+		default:
+			return nil
+		}
+		return s.meetingRepo.UpdateParticipantStatus(ctx, m.ID, userID, req)
+	}
+	return nil
+}
+
+// identityUserID — identity участника совпадает с ID пользователя (см. GenerateToken в call и meeting)
+func identityUserID(p *livekit.ParticipantInfo) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(p.GetIdentity())
+	return userID, err == nil
+}
@@ -0,0 +1,2 @@
+-- Remove password resets table
+DROP TABLE IF EXISTS password_resets;
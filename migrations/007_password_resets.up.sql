@@ -0,0 +1,20 @@
+-- Password reset codes (stored hashed, single-use)
+CREATE TABLE password_resets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for password resets
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id, created_at DESC);
+CREATE INDEX idx_password_resets_expires_at ON password_resets(expires_at);
+
+-- Comments for documentation
+COMMENT ON TABLE password_resets IS 'One-time password reset codes sent by email';
+COMMENT ON COLUMN password_resets.code_hash IS 'SHA-256 hash of the reset code';
+COMMENT ON COLUMN password_resets.attempts IS 'Number of failed attempts to redeem the code';
+COMMENT ON COLUMN password_resets.used_at IS 'When the code was redeemed; NULL if still unused';
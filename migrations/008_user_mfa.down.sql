@@ -0,0 +1,3 @@
+-- Remove two-factor authentication tables
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_mfa;
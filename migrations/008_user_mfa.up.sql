@@ -0,0 +1,31 @@
+-- TOTP two-factor authentication
+CREATE TABLE user_mfa (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    confirmed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Recovery codes for TOTP (stored hashed, single-use)
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for recovery codes
+CREATE INDEX idx_mfa_recovery_codes_user_id ON mfa_recovery_codes(user_id);
+
+-- Trigger for updated_at
+CREATE TRIGGER update_user_mfa_updated_at BEFORE UPDATE ON user_mfa
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Comments for documentation
+COMMENT ON TABLE user_mfa IS 'TOTP (RFC 6238) second factor per user';
+COMMENT ON COLUMN user_mfa.secret IS 'Base32 encoded TOTP shared secret';
+COMMENT ON COLUMN user_mfa.enabled IS 'TRUE once enrollment was confirmed with a valid code';
+COMMENT ON TABLE mfa_recovery_codes IS 'One-time recovery codes used when the authenticator is unavailable';
@@ -0,0 +1,2 @@
+-- Remove passkeys table
+DROP TABLE IF EXISTS webauthn_credentials;
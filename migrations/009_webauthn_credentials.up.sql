@@ -0,0 +1,26 @@
+-- Passkeys (WebAuthn credentials)
+CREATE TABLE webauthn_credentials (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id BYTEA NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    attestation_type VARCHAR(32) NOT NULL DEFAULT 'none',
+    aaguid BYTEA,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports VARCHAR(255) NOT NULL DEFAULT '',
+    backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+    backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+    name VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+-- Indexes for credential lookup
+CREATE INDEX idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+
+-- Comments for documentation
+COMMENT ON TABLE webauthn_credentials IS 'Registered passkeys used for passwordless login';
+COMMENT ON COLUMN webauthn_credentials.credential_id IS 'Raw credential ID returned by the authenticator';
+COMMENT ON COLUMN webauthn_credentials.public_key IS 'COSE encoded credential public key';
+COMMENT ON COLUMN webauthn_credentials.sign_count IS 'Last seen signature counter, used to detect cloned authenticators';
+COMMENT ON COLUMN webauthn_credentials.transports IS 'Comma separated authenticator transports (internal, hybrid, usb...)';
@@ -0,0 +1,2 @@
+-- Remove session activity tracking
+ALTER TABLE sessions DROP COLUMN IF EXISTS last_refreshed_at;
@@ -0,0 +1,7 @@
+-- Track when a session last exchanged its refresh token
+ALTER TABLE sessions ADD COLUMN last_refreshed_at TIMESTAMP;
+
+UPDATE sessions SET last_refreshed_at = created_at WHERE last_refreshed_at IS NULL;
+
+COMMENT ON COLUMN sessions.device_info IS 'User-Agent of the client that owns the session';
+COMMENT ON COLUMN sessions.last_refreshed_at IS 'Last time the refresh token of this session was rotated';
@@ -0,0 +1,2 @@
+-- Remove refresh token families
+DROP TABLE IF EXISTS refresh_tokens;
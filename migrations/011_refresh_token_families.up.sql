@@ -0,0 +1,27 @@
+-- Refresh token families: every rotation is recorded so reuse of an old token can be detected
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    parent_id UUID REFERENCES refresh_tokens(id) ON DELETE SET NULL,
+    rotated_at TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for refresh tokens
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
+
+-- Existing sessions become single-member families
+INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at)
+SELECT id, user_id, encode(sha256(convert_to(refresh_token, 'UTF8')), 'hex'), expires_at
+FROM sessions
+ON CONFLICT (token_hash) DO NOTHING;
+
+-- Comments for documentation
+COMMENT ON TABLE refresh_tokens IS 'Issued refresh tokens; a session is one token family';
+COMMENT ON COLUMN refresh_tokens.token_hash IS 'SHA-256 hash of the refresh token';
+COMMENT ON COLUMN refresh_tokens.parent_id IS 'Token that was exchanged for this one';
+COMMENT ON COLUMN refresh_tokens.rotated_at IS 'Set when the token was exchanged; presenting it again revokes the family';
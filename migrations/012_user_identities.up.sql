@@ -0,0 +1,21 @@
+-- External identities (OpenID Connect providers) linked to local accounts
+CREATE TABLE user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+-- Indexes for identity lookup
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- Comments for documentation
+COMMENT ON TABLE user_identities IS 'Accounts at external OpenID Connect providers used to sign in';
+COMMENT ON COLUMN user_identities.provider IS 'Provider name from the OIDC provider registry';
+COMMENT ON COLUMN user_identities.subject IS 'Stable user identifier (sub claim) issued by the provider';
+COMMENT ON COLUMN user_identities.email IS 'Email reported by the provider at link time';
@@ -0,0 +1,2 @@
+-- Remove phone verification flag
+ALTER TABLE users DROP COLUMN IF EXISTS phone_verified;
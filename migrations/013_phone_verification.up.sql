@@ -0,0 +1,4 @@
+-- Phone numbers become verifiable and usable for login
+ALTER TABLE users ADD COLUMN phone_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN users.phone_verified IS 'Phone number confirmed by an SMS code; only verified numbers can be used to sign in';
@@ -0,0 +1,17 @@
+-- Restore cascading history deletion (rows of already deleted users are removed)
+DELETE FROM meetings WHERE host_id IS NULL;
+ALTER TABLE meetings DROP CONSTRAINT meetings_host_id_fkey;
+ALTER TABLE meetings ADD CONSTRAINT meetings_host_id_fkey FOREIGN KEY (host_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE meetings ALTER COLUMN host_id SET NOT NULL;
+
+DELETE FROM calls WHERE caller_id IS NULL OR callee_id IS NULL;
+ALTER TABLE calls DROP CONSTRAINT calls_caller_id_fkey;
+ALTER TABLE calls DROP CONSTRAINT calls_callee_id_fkey;
+ALTER TABLE calls ADD CONSTRAINT calls_caller_id_fkey FOREIGN KEY (caller_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE calls ADD CONSTRAINT calls_callee_id_fkey FOREIGN KEY (callee_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE calls ALTER COLUMN caller_id SET NOT NULL;
+ALTER TABLE calls ALTER COLUMN callee_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS account_state;
@@ -0,0 +1,21 @@
+-- Account deletion with a grace period
+ALTER TABLE users ADD COLUMN account_state VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMP;
+
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Call and meeting history survives the deletion of one party: the reference is cleared instead of cascading
+ALTER TABLE calls ALTER COLUMN caller_id DROP NOT NULL;
+ALTER TABLE calls ALTER COLUMN callee_id DROP NOT NULL;
+ALTER TABLE calls DROP CONSTRAINT calls_caller_id_fkey;
+ALTER TABLE calls DROP CONSTRAINT calls_callee_id_fkey;
+ALTER TABLE calls ADD CONSTRAINT calls_caller_id_fkey FOREIGN KEY (caller_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE calls ADD CONSTRAINT calls_callee_id_fkey FOREIGN KEY (callee_id) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE meetings ALTER COLUMN host_id DROP NOT NULL;
+ALTER TABLE meetings DROP CONSTRAINT meetings_host_id_fkey;
+ALTER TABLE meetings ADD CONSTRAINT meetings_host_id_fkey FOREIGN KEY (host_id) REFERENCES users(id) ON DELETE SET NULL;
+
+-- Comments for documentation
+COMMENT ON COLUMN users.account_state IS 'active or pending_deletion';
+COMMENT ON COLUMN users.deletion_scheduled_at IS 'When a pending deletion becomes final; logging in before that cancels it';
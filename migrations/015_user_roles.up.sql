@@ -0,0 +1,8 @@
+-- Role-based access control: one role per user, permissions are defined in code
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'moderator', 'admin'));
+
+CREATE INDEX idx_users_role ON users(role) WHERE role <> 'user';
+
+-- Comments for documentation
+COMMENT ON COLUMN users.role IS 'user, moderator or admin; the first admin is granted manually: UPDATE users SET role = ''admin'' WHERE email = ...';
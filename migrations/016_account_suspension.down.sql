@@ -0,0 +1,8 @@
+-- Remove account suspension
+UPDATE users SET account_state = 'active' WHERE account_state = 'suspended';
+
+DROP INDEX IF EXISTS idx_users_account_state;
+ALTER TABLE users DROP COLUMN IF EXISTS suspension_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_at;
+
+COMMENT ON COLUMN users.account_state IS 'active or pending_deletion';
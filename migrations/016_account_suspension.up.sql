@@ -0,0 +1,9 @@
+-- Accounts can be suspended by an administrator
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN suspension_reason TEXT;
+
+CREATE INDEX idx_users_account_state ON users(account_state) WHERE account_state <> 'active';
+
+-- Comments for documentation
+COMMENT ON COLUMN users.account_state IS 'active, pending_deletion or suspended';
+COMMENT ON COLUMN users.suspended_at IS 'When an administrator suspended the account; suspended accounts cannot sign in';
@@ -0,0 +1,41 @@
+-- Security audit log: authentication and account events, append-only
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event_type VARCHAR(64) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_events_user_created ON audit_events(user_id, created_at DESC);
+CREATE INDEX idx_audit_events_actor_created ON audit_events(actor_id, created_at DESC) WHERE actor_id IS NOT NULL;
+CREATE INDEX idx_audit_events_type_created ON audit_events(event_type, created_at DESC);
+CREATE INDEX idx_audit_events_created ON audit_events(created_at DESC);
+
+-- Events are never edited. The only allowed update is clearing actor_id
+-- when the administrator's account is deleted (ON DELETE SET NULL).
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    IF OLD.actor_id IS NOT NULL AND NEW.actor_id IS NULL
+       AND (NEW.id, NEW.user_id, NEW.event_type, NEW.ip_address, NEW.user_agent, NEW.metadata, NEW.created_at)
+           IS NOT DISTINCT FROM
+           (OLD.id, OLD.user_id, OLD.event_type, OLD.ip_address, OLD.user_agent, OLD.metadata, OLD.created_at) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update
+    BEFORE UPDATE ON audit_events
+    FOR EACH ROW
+    EXECUTE FUNCTION audit_events_append_only();
+
+-- Comments for documentation
+COMMENT ON TABLE audit_events IS 'Append-only log of authentication, account and admin events';
+COMMENT ON COLUMN audit_events.user_id IS 'Account the event is about; NULL for failed logins with an unknown email';
+COMMENT ON COLUMN audit_events.actor_id IS 'Administrator who performed the action; NULL when the user acted themselves';
+COMMENT ON COLUMN audit_events.event_type IS 'Dotted event name, e.g. login.success, password.change, admin.suspend';
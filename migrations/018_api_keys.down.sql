@@ -0,0 +1,2 @@
+-- Remove API keys table
+DROP TABLE IF EXISTS api_keys;
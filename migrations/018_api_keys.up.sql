@@ -0,0 +1,23 @@
+-- Personal API keys for scripts and integrations
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR(45),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for key lookup
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+
+-- Comments for documentation
+COMMENT ON TABLE api_keys IS 'User-scoped API keys accepted by RequireAuth instead of a Bearer JWT';
+COMMENT ON COLUMN api_keys.prefix IS 'Public part of the key (q7o_<prefix>_<secret>), shown in the key list';
+COMMENT ON COLUMN api_keys.key_hash IS 'SHA-256 of the full key; the key itself is shown only once at creation';
+COMMENT ON COLUMN api_keys.scopes IS 'Comma separated scopes (calls:read, meetings:write...)';
+COMMENT ON COLUMN api_keys.expires_at IS 'NULL for keys that never expire';
@@ -0,0 +1,2 @@
+-- Remove call participants table
+DROP TABLE IF EXISTS call_participants;
@@ -0,0 +1,39 @@
+-- Call participants: a 1:1 call can grow into a group call
+CREATE TABLE call_participants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    call_id UUID NOT NULL REFERENCES calls(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    display_name VARCHAR(255) NOT NULL DEFAULT '',
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'ringing'
+        CHECK (status IN ('ringing', 'joined', 'rejected', 'missed', 'left')),
+    invited_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    joined_at TIMESTAMP,
+    left_at TIMESTAMP,
+    UNIQUE (call_id, user_id)
+);
+
+-- Indexes for history lookup
+CREATE INDEX idx_call_participants_user_id ON call_participants(user_id);
+
+-- Existing calls: the caller and the callee become participants
+INSERT INTO call_participants (call_id, user_id, display_name, status, invited_at, joined_at, left_at)
+SELECT id, caller_id, COALESCE(caller_name, ''), 'left', started_at, started_at, COALESCE(ended_at, started_at)
+FROM calls;
+
+INSERT INTO call_participants (call_id, user_id, display_name, invited_by, status, invited_at, joined_at, left_at)
+SELECT id, callee_id, COALESCE(callee_name, ''), caller_id,
+       CASE
+           WHEN answered_at IS NOT NULL THEN 'left'
+           WHEN status = 'rejected' THEN 'rejected'
+           ELSE 'missed'
+       END,
+       started_at, answered_at, ended_at
+FROM calls
+WHERE callee_id IS DISTINCT FROM caller_id;
+
+-- Comments for documentation
+COMMENT ON TABLE call_participants IS 'Everyone who took part in or was invited to a call, including the caller';
+COMMENT ON COLUMN call_participants.status IS 'ringing, joined, rejected, missed or left';
+COMMENT ON COLUMN call_participants.invited_by IS 'Participant who invited this user; NULL for the caller';
+COMMENT ON COLUMN call_participants.display_name IS 'Name at the time of the call, kept when the account is deleted';
@@ -0,0 +1,2 @@
+-- Remove calls room name index
+DROP INDEX IF EXISTS idx_calls_room_name;
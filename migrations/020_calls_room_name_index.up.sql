@@ -0,0 +1,2 @@
+-- LiveKit webhooks look calls up by room name
+CREATE INDEX idx_calls_room_name ON calls(room_name);
@@ -0,0 +1,3 @@
+-- Remove call forwarding
+ALTER TABLE calls DROP COLUMN IF EXISTS forwarded_from_call_id;
+DROP TABLE IF EXISTS call_forwarding_rules;
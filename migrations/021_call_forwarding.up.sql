@@ -0,0 +1,22 @@
+-- Call forwarding: per-user rules and a link from a forwarded call to the original one
+CREATE TABLE call_forwarding_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    condition VARCHAR(20) NOT NULL
+        CHECK (condition IN ('always', 'busy', 'no_answer', 'offline')),
+    target_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    timeout_seconds INTEGER NOT NULL DEFAULT 20 CHECK (timeout_seconds BETWEEN 5 AND 60),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, condition),
+    CHECK (target_user_id <> user_id)
+);
+
+ALTER TABLE calls ADD COLUMN forwarded_from_call_id UUID REFERENCES calls(id) ON DELETE SET NULL;
+
+-- Comments for documentation
+COMMENT ON TABLE call_forwarding_rules IS 'Where to forward incoming calls; at most one rule per condition';
+COMMENT ON COLUMN call_forwarding_rules.condition IS 'always, busy (already in a call), no_answer (after timeout_seconds) or offline (no connected devices)';
+COMMENT ON COLUMN call_forwarding_rules.timeout_seconds IS 'Ringing time before a no_answer rule forwards the call';
+COMMENT ON COLUMN calls.forwarded_from_call_id IS 'Original call this one was forwarded from';
@@ -0,0 +1,2 @@
+-- Remove case-insensitive email index
+DROP INDEX IF EXISTS idx_users_email_lower;
@@ -0,0 +1,2 @@
+-- Email lookups are case-insensitive
+CREATE INDEX idx_users_email_lower ON users(LOWER(email));
@@ -0,0 +1,5 @@
+-- Allow deleting audit events again
+DROP TRIGGER IF EXISTS audit_events_no_delete ON audit_events;
+DROP FUNCTION IF EXISTS audit_events_no_delete();
+COMMENT ON COLUMN audit_events.ip_address IS NULL;
+COMMENT ON COLUMN audit_events.user_agent IS NULL;
@@ -0,0 +1,19 @@
+-- Audit events cannot be deleted either. Rows go away only together with
+-- the account they belong to (ON DELETE CASCADE when a user is purged).
+CREATE OR REPLACE FUNCTION audit_events_no_delete() RETURNS TRIGGER AS $$
+BEGIN
+    IF OLD.user_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM users WHERE id = OLD.user_id) THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_delete
+    BEFORE DELETE ON audit_events
+    FOR EACH ROW
+    EXECUTE FUNCTION audit_events_no_delete();
+
+-- Comments for documentation
+COMMENT ON COLUMN audit_events.ip_address IS 'Client IP of the user''s own request; empty for admin actions';
+COMMENT ON COLUMN audit_events.user_agent IS 'User-Agent of the user''s own request; empty for admin actions';
@@ -0,0 +1,3 @@
+-- Allow API keys without an expiry again
+ALTER TABLE api_keys ALTER COLUMN expires_at DROP NOT NULL;
+COMMENT ON COLUMN api_keys.expires_at IS 'NULL for keys that never expire';
@@ -0,0 +1,6 @@
+-- API keys always expire: existing keys without an expiry get the maximum lifetime
+UPDATE api_keys SET expires_at = NOW() + INTERVAL '365 days' WHERE expires_at IS NULL;
+ALTER TABLE api_keys ALTER COLUMN expires_at SET NOT NULL;
+
+-- Comments for documentation
+COMMENT ON COLUMN api_keys.expires_at IS 'Expiry time; at most 365 days after creation';
@@ -0,0 +1,2 @@
+-- Remove the session link from push tokens
+ALTER TABLE device_tokens DROP COLUMN IF EXISTS session_id;
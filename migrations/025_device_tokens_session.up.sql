@@ -0,0 +1,5 @@
+-- Link push tokens to the session that registered them
+ALTER TABLE device_tokens ADD COLUMN session_id UUID;
+
+-- Comments for documentation
+COMMENT ON COLUMN device_tokens.session_id IS 'Session that registered the token; the device that answered a call gets no cancellation push';